@@ -162,6 +162,35 @@ var (
 	// ErrUnbindFailed indicates that a TrackLocal was not able to be unbind.
 	ErrUnbindFailed = errors.New("failed to unbind TrackLocal from PeerConnection")
 
+	// ErrCodecMimeTypeMismatch indicates that a codec was registered with a MIME type of a different kind.
+	ErrCodecMimeTypeMismatch = errors.New("codec MIME type does not match the codec type")
+
+	// ErrCodecToggleAfterNegotiation indicates that a codec was enabled or disabled after its kind was negotiated.
+	ErrCodecToggleAfterNegotiation = errors.New("codecs can't be enabled or disabled after negotiation")
+
+	// ErrRepairedStreamIDWithoutStreamID indicates that the repaired-rtp-stream-id
+	// header extension was registered without the rtp-stream-id header extension.
+	ErrRepairedStreamIDWithoutStreamID = errors.New("repaired-rtp-stream-id requires rtp-stream-id")
+
+	// ErrInvalidPayloadType indicates that a codec was registered with a payload type outside of 0-127.
+	ErrInvalidPayloadType = errors.New("payload type must be between 0 and 127")
+
+	// ErrRIDTooLong indicates that a RID is longer than the MediaEngine allows, see MediaEngine.SetMaxRIDLength.
+	ErrRIDTooLong = errors.New("RID is longer than allowed")
+
+	// ErrNoCommonCodecs indicates that a media section of a remote description has no codec in common with us.
+	ErrNoCommonCodecs = errors.New("no codec in common with the remote")
+
+	// ErrNilCodecFunc indicates that MediaEngine.RegisterCodecFunc was called without a function.
+	ErrNilCodecFunc = errors.New("codec function must not be nil")
+
+	// ErrNoFreePayloadType indicates that all dynamic payload types are in use.
+	ErrNoFreePayloadType = errors.New("no free dynamic payload type")
+
+	// ErrInvalidCodecDirection indicates that a codec was restricted to a direction
+	// besides `sendrecv`, `sendonly` or `recvonly`.
+	ErrInvalidCodecDirection = errors.New("codecs can only be restricted to sendrecv, sendonly or recvonly")
+
 	// ErrNoPayloaderForCodec indicates that the requested codec does not have a payloader.
 	ErrNoPayloaderForCodec = errors.New("the requested codec does not have a payloader")
 
@@ -171,6 +200,10 @@ var (
 		"a header extension must be registered as 'recvonly', 'sendonly' or both",
 	)
 
+	// ErrHeaderExtensionInvalidKind indicates that a header extension was registered
+	// for a kind of media it can't be used with.
+	ErrHeaderExtensionInvalidKind = errors.New("header extension can't be registered for this kind of media")
+
 	// ErrSimulcastProbeOverflow indicates that too many Simulcast probe streams are in flight
 	// and the requested SSRC was ignored.
 	ErrSimulcastProbeOverflow = errors.New("simulcast probe limit has been reached, new SSRC has been discarded")
@@ -178,6 +211,12 @@ var (
 	// ErrSDPUnmarshalling indicates that the SDP could not be unmarshalled.
 	ErrSDPUnmarshalling = errors.New("failed to unmarshal SDP")
 
+	// ErrInvalidSVCLayers indicates that SVC layer counts outside of the supported range were provided.
+	ErrInvalidSVCLayers = errors.New("svc spatial and temporal layer counts must be between 1 and 8")
+
+	// ErrUnsupportedMultiopusChannels indicates that a multiopus channel count other than 6 or 8 was requested.
+	ErrUnsupportedMultiopusChannels = errors.New("multiopus only supports 6 (5.1) or 8 (7.1) channels")
+
 	errDetachNotEnabled                 = errors.New("enable detaching by calling webrtc.DetachDataChannels()")
 	errDetachBeforeOpened               = errors.New("datachannel not opened yet, try calling Detach from OnOpen")
 	errDtlsTransportNotStarted          = errors.New("the DTLS transport has not started yet")
@@ -292,5 +331,13 @@ var (
 
 	errRTPTooShort = errors.New("not long enough to be a RTP Packet")
 
+	errTransmissionOffsetTooShort   = errors.New("not long enough to be a transmission time offset")
+	errTransmissionOffsetOutOfRange = errors.New("transmission time offset does not fit in 24 bits")
+	errVideoContentTypeTooShort     = errors.New("not long enough to be a video content type")
+	errVideoTimingTooShort          = errors.New("not long enough to be a video timing")
+	errCSRCAudioLevelTooShort       = errors.New("not long enough to be a CSRC audio level")
+	errCSRCAudioLevelTooMany        = errors.New("more CSRC audio levels than CSRCs fit in a RTP packet")
+	errCSRCAudioLevelOutOfRange     = errors.New("CSRC audio level does not fit in 7 bits")
+
 	errExcessiveRetries = errors.New("excessive retries in CreateOffer")
 )
@@ -5,14 +5,16 @@
 package fmtp
 
 import (
+	"slices"
 	"strings"
 )
 
 func defaultClockRate(mimeType string) uint32 {
 	defaults := map[string]uint32{
-		"audio/opus": 48000,
-		"audio/pcmu": 8000,
-		"audio/pcma": 8000,
+		"audio/opus":      48000,
+		"audio/multiopus": 48000,
+		"audio/pcmu":      8000,
+		"audio/pcma":      8000,
 	}
 
 	if def, ok := defaults[strings.ToLower(mimeType)]; ok {
@@ -89,15 +91,17 @@ func ChannelsEqual(mimeType string, valA, valB uint16) bool {
 	return valA == valB
 }
 
-func paramsEqual(valA, valB map[string]string) bool {
+func paramsEqual(mimeType string, valA, valB map[string]string) bool {
+	ignored := NonDiscriminatingParameters(mimeType)
+
 	for k, v := range valA {
-		if vb, ok := valB[k]; ok && !strings.EqualFold(vb, v) {
+		if vb, ok := valB[k]; ok && !strings.EqualFold(vb, v) && !slices.Contains(ignored, k) {
 			return false
 		}
 	}
 
 	for k, v := range valB {
-		if va, ok := valA[k]; ok && !strings.EqualFold(va, v) {
+		if va, ok := valA[k]; ok && !strings.EqualFold(va, v) && !slices.Contains(ignored, k) {
 			return false
 		}
 	}
@@ -105,6 +109,26 @@ func paramsEqual(valA, valB map[string]string) bool {
 	return true
 }
 
+// NonDiscriminatingParameters returns the lowercase keys of the fmtp parameters of
+// mimeType that describe receiver capabilities instead of a media format, so they
+// may differ between two matching fmtp lines. For H264 and VP8 these are max-fr
+// and max-fs, see RFC 6184 section 8.1 and RFC 7741 section 6.1. For RTX it is
+// rtx-time, the time the sender keeps packets for retransmission, see RFC 4588.
+// For Opus it is usedtx, the receiver's preference for discontinuous transmission,
+// see RFC 7587 section 6.1.
+func NonDiscriminatingParameters(mimeType string) []string {
+	switch strings.ToLower(mimeType) {
+	case "video/h264", "video/vp8":
+		return []string{"max-fr", "max-fs"}
+	case "video/rtx", "audio/rtx":
+		return []string{"rtx-time"}
+	case "audio/opus":
+		return []string{"usedtx"}
+	default:
+		return nil
+	}
+}
+
 // FMTP interface for implementing custom
 // FMTP parsers based on MimeType.
 type FMTP interface {
@@ -141,6 +165,12 @@ func Parse(mimeType string, clockRate uint32, channels uint16, line string) FMTP
 			parameters: parameters,
 		}
 
+	case strings.EqualFold(mimeType, "audio/multiopus"):
+		fmtp = &multiopusFMTP{
+			channels:   channels,
+			parameters: parameters,
+		}
+
 	default:
 		fmtp = &genericFMTP{
 			mimeType:   mimeType,
@@ -175,11 +205,11 @@ func (g *genericFMTP) Match(b FMTP) bool {
 	return strings.EqualFold(g.mimeType, fmtp.MimeType()) &&
 		ClockRateEqual(g.mimeType, g.clockRate, fmtp.clockRate) &&
 		ChannelsEqual(g.mimeType, g.channels, fmtp.channels) &&
-		paramsEqual(g.parameters, fmtp.parameters)
+		paramsEqual(g.mimeType, g.parameters, fmtp.parameters)
 }
 
 func (g *genericFMTP) Parameter(key string) (string, bool) {
-	v, ok := g.parameters[key]
+	v, ok := g.parameters[strings.ToLower(key)]
 
 	return v, ok
 }
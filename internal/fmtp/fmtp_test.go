@@ -128,6 +128,19 @@ func TestParse(t *testing.T) {
 				},
 			},
 		},
+		{
+			"multiopus",
+			"audio/multiopus",
+			48000,
+			6,
+			"key-name=value",
+			&multiopusFMTP{
+				channels: 6,
+				parameters: map[string]string{
+					"key-name": "value",
+				},
+			},
+		},
 	} {
 		t.Run(ca.name, func(t *testing.T) {
 			f := Parse(ca.mimeType, ca.clockRate, ca.channels, ca.line)
@@ -715,3 +728,55 @@ func TestMatch(t *testing.T) { //nolint:maintidx
 		})
 	}
 }
+
+func TestParameterCaseInsensitive(t *testing.T) {
+	for _, mimeType := range []string{"audio/opus", "video/h264", "video/vp9", "video/av1"} {
+		t.Run(mimeType, func(t *testing.T) {
+			f := Parse(mimeType, 90000, 0, "APT=96;Profile-Level-ID=42e01f")
+
+			value, ok := f.Parameter("apt")
+			assert.True(t, ok)
+			assert.Equal(t, "96", value)
+
+			value, ok = f.Parameter("PROFILE-LEVEL-ID")
+			assert.True(t, ok)
+			assert.Equal(t, "42e01f", value)
+		})
+	}
+}
+
+func TestMultiopusMatch(t *testing.T) {
+	const surround51 = "channel_mapping=0,4,1,2,3,5;coupled_streams=2;num_streams=4"
+
+	local := Parse("audio/multiopus", 48000, 6, surround51+";minptime=10")
+	assert.True(t, local.Match(Parse("audio/multiopus", 48000, 6, surround51+";useinbandfec=1")))
+	assert.False(t, local.Match(Parse("audio/multiopus", 48000, 8, surround51)))
+	assert.False(t, local.Match(Parse("audio/multiopus", 48000, 6,
+		"channel_mapping=0,1,2,3,4,5;coupled_streams=2;num_streams=4")))
+	assert.False(t, local.Match(Parse("audio/multiopus", 48000, 6, "coupled_streams=2;num_streams=4")))
+	assert.False(t, local.Match(Parse("audio/opus", 48000, 2, "")))
+}
+
+func TestNonDiscriminatingParameters(t *testing.T) {
+	vp8A := Parse("video/VP8", 90000, 0, "max-fr=15;max-fs=1200")
+	vp8B := Parse("video/VP8", 90000, 0, "max-fr=30")
+	assert.True(t, vp8A.Match(vp8B))
+	assert.True(t, vp8B.Match(vp8A))
+
+	// Other generic codecs still compare every parameter
+	otherA := Parse("video/other", 90000, 0, "max-fr=15")
+	otherB := Parse("video/other", 90000, 0, "max-fr=30")
+	assert.False(t, otherA.Match(otherB))
+
+	rtxA := Parse("video/rtx", 90000, 0, "apt=96;rtx-time=1000")
+	rtxB := Parse("video/rtx", 90000, 0, "apt=96;rtx-time=3000")
+	assert.True(t, rtxA.Match(rtxB))
+
+	opusA := Parse("audio/opus", 48000, 2, "minptime=10;usedtx=1")
+	opusB := Parse("audio/opus", 48000, 2, "minptime=10;usedtx=0")
+	assert.True(t, opusA.Match(opusB))
+
+	assert.Equal(t, []string{"max-fr", "max-fs"}, NonDiscriminatingParameters("video/H264"))
+	assert.Equal(t, []string{"usedtx"}, NonDiscriminatingParameters("audio/opus"))
+	assert.Empty(t, NonDiscriminatingParameters("audio/PCMU"))
+}
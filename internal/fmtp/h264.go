@@ -5,6 +5,7 @@ package fmtp
 
 import (
 	"encoding/hex"
+	"strings"
 )
 
 func profileLevelIDMatches(a, b string) bool {
@@ -80,7 +81,7 @@ func (h *h264FMTP) Match(b FMTP) bool {
 }
 
 func (h *h264FMTP) Parameter(key string) (string, bool) {
-	v, ok := h.parameters[key]
+	v, ok := h.parameters[strings.ToLower(key)]
 
 	return v, ok
 }
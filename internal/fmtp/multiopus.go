@@ -0,0 +1,44 @@
+// SPDX-FileCopyrightText: 2026 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package fmtp
+
+import (
+	"strings"
+)
+
+type multiopusFMTP struct {
+	channels   uint16
+	parameters map[string]string
+}
+
+func (h *multiopusFMTP) MimeType() string {
+	return "audio/multiopus"
+}
+
+// Match requires the channel count and the stream layout to agree, audio laid out
+// for a different channel mapping can't be decoded correctly.
+func (h *multiopusFMTP) Match(b FMTP) bool {
+	c, ok := b.(*multiopusFMTP)
+	if !ok {
+		return false
+	}
+
+	if h.channels != c.channels {
+		return false
+	}
+
+	for _, key := range []string{"channel_mapping", "num_streams", "coupled_streams"} {
+		if h.parameters[key] != c.parameters[key] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (h *multiopusFMTP) Parameter(key string) (string, bool) {
+	v, ok := h.parameters[strings.ToLower(key)]
+
+	return v, ok
+}
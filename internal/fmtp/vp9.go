@@ -3,6 +3,10 @@
 
 package fmtp
 
+import (
+	"strings"
+)
+
 type vp9FMTP struct {
 	parameters map[string]string
 }
@@ -36,7 +40,7 @@ func (h *vp9FMTP) Match(b FMTP) bool {
 }
 
 func (h *vp9FMTP) Parameter(key string) (string, bool) {
-	v, ok := h.parameters[key]
+	v, ok := h.parameters[strings.ToLower(key)]
 
 	return v, ok
 }
@@ -6,19 +6,94 @@
 package webrtc
 
 import (
+	"bytes"
+	"cmp"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"maps"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/pion/logging"
 	"github.com/pion/rtp"
 	"github.com/pion/rtp/codecs"
 	"github.com/pion/sdp/v3"
 	"github.com/pion/webrtc/v4/internal/fmtp"
 )
 
+const (
+	// Range of IDs available to one-byte RTP header extensions, see RFC 8285.
+	minHeaderExtensionID = 1
+	maxHeaderExtensionID = 14
+	// Highest ID of two-byte RTP header extensions, see RFC 8285.
+	maxTwoByteHeaderExtensionID = 255
+)
+
+const (
+	// First payload type of the dynamic range, see RFC 3551 section 3.
+	minDynamicPayloadType = 96
+	// Highest payload type that fits in the 7-bit payload type field of the RTP header.
+	maxPayloadType = 127
+)
+
+// BWEPolicy decides which bandwidth estimation header extensions are used when
+// both abs-send-time and transport-cc are available.
+type BWEPolicy int
+
+const (
+	// BWEPolicyAllowBoth uses abs-send-time and transport-cc together, the default.
+	BWEPolicyAllowBoth BWEPolicy = iota
+	// BWEPolicyPreferTransportCC drops abs-send-time if transport-cc is available.
+	BWEPolicyPreferTransportCC
+	// BWEPolicyPreferAbsSendTime drops transport-cc if abs-send-time is available.
+	BWEPolicyPreferAbsSendTime
+)
+
+// Payload types of the codecs registered by RegisterDefaultCodecs. H264 is
+// registered with several profiles, DefaultPayloadTypeH264 is the constrained
+// baseline profile with packetization-mode=1.
+const (
+	DefaultPayloadTypeOpus        PayloadType = 111
+	DefaultPayloadTypeVP8         PayloadType = 96
+	DefaultPayloadTypeH264        PayloadType = 102
+	DefaultPayloadTypeVP9         PayloadType = 98
+	DefaultPayloadTypeVP9Profile2 PayloadType = 100
+	DefaultPayloadTypeAV1         PayloadType = 45
+	DefaultPayloadTypeH265        PayloadType = 116
+)
+
+// RTP clock rate of G722, half of its sample rate, see RFC 3551 section 4.5.2.
+const g722RTPClockRate = 8000
+
+// Maximum number of spatial and temporal layers accepted by SetSVCLayers.
+const maxSVCLayers = 8
+
+type svcLayers struct {
+	spatial, temporal int
+}
+
+type codecKey struct {
+	typ  RTPCodecType
+	mime string
+}
+
+// payloadTypeKey identifies a registered codec, audio and video codecs may share payload types.
+type payloadTypeKey struct {
+	typ         RTPCodecType
+	payloadType PayloadType
+}
+
+type negotiatedSection struct {
+	typ          RTPCodecType
+	payloadTypes []PayloadType
+}
+
 type mediaEngineHeaderExtension struct {
 	uri              string
 	isAudio, isVideo bool
@@ -27,22 +102,189 @@ type mediaEngineHeaderExtension struct {
 	allowedDirections []RTPTransceiverDirection
 }
 
+func (h mediaEngineHeaderExtension) hasKind(typ RTPCodecType) bool {
+	return h.isAudio && typ == RTPCodecTypeAudio || h.isVideo && typ == RTPCodecTypeVideo
+}
+
+// RegistrationObserver is notified of the codecs and header extensions registered
+// with a MediaEngine, see MediaEngine.AddRegistrationObserver.
+type RegistrationObserver interface {
+	OnCodecRegistered(codec RTPCodecParameters, typ RTPCodecType)
+	OnHeaderExtensionRegistered(extension RTPHeaderExtensionCapability, typ RTPCodecType)
+}
+
 // A MediaEngine defines the codecs supported by a PeerConnection, and the
 // configuration of those codecs.
 type MediaEngine struct {
 	// If we have attempted to negotiate a codec type yet.
 	negotiatedVideo, negotiatedAudio bool
-	negotiateMultiCodecs             bool
+	// If the remote signaled support for reduced-size RTCP.
+	negotiatedReducedSizeRTCP bool
+	negotiateMultiCodecs      bool
+	strictHeaderExtensions    bool
+	twoByteHeaderExtensionIDs bool
+	honorRemoteCodecOrder     bool
+
+	// Maximum number of codecs negotiated per kind, 0 means unlimited.
+	maxNegotiatedCodecs int
+	// Weakest match of a remote codec that is negotiated.
+	minMatchType CodecMatchType
+	// If a remote description leaving a negotiated kind without codecs is an error.
+	requireUsableCodecs bool
 
 	videoCodecs, audioCodecs                     []RTPCodecParameters
 	negotiatedVideoCodecs, negotiatedAudioCodecs []RTPCodecParameters
 
+	// How the negotiated codecs matched the local ones, keyed by kind and payload type.
+	negotiatedMatchTypes map[payloadTypeKey]CodecMatchType
+	// The local codecs the negotiated codecs matched, keyed by kind and payload type.
+	negotiatedLocalCodecs map[payloadTypeKey]RTPCodecCapability
+	// Payload types of the remote's Opus codecs that asked for DTX with usedtx=1. The
+	// negotiated codecs carry our usedtx instead, it doesn't affect matching.
+	remoteOpusDTX map[payloadTypeKey]bool
+
+	// Incremented every time the negotiated state changes.
+	negotiationVersion uint64
+	// Payload types pushed while applying the current remote description.
+	pushedPayloadTypes map[PayloadType]struct{}
+	// Payload types the remote codec filter rejected in the remote description being
+	// applied, keyed by media section index.
+	remoteCodecFilterRejections map[int]map[PayloadType]struct{}
+
+	// Remote codecs that didn't match any local codec.
+	unmatchedRemoteCodecs []RTPCodecParameters
+	// Cumulative match counts of the remote descriptions applied since the last reset.
+	negotiationMetrics NegotiationMetrics
+
+	// The directions, from our point of view, of the remote media sections listing
+	// each negotiated kind and payload type. A payload type the remote only sends is recvonly.
+	negotiatedCodecDirections map[payloadTypeKey]RTPTransceiverDirection
+	// Codecs negotiated by a sendonly or recvonly media section of a kind a section of the
+	// opposite direction already negotiated, while multiple codecs aren't negotiated. They
+	// are kept out of the negotiated codecs of the kind, only NegotiatedCodecsForDirection
+	// returns them.
+	negotiatedDirectionalCodecs map[RTPCodecType][]RTPCodecParameters
+	// Negotiated payload types listed by each remote media section, keyed by mid.
+	negotiatedSections map[string]negotiatedSection
+	// Mids of each a=group:BUNDLE of the remote description.
+	negotiatedBundleGroups [][]string
+	// Kinds the remote description rejected media sections of. Until a section negotiates
+	// a rejected kind it has no codecs.
+	rejectedKinds []RTPCodecType
+
 	headerExtensions           []mediaEngineHeaderExtension
 	negotiatedHeaderExtensions map[int]mediaEngineHeaderExtension
 
+	// Maximum number of header extensions offered per kind, kinds without an entry are unlimited.
+	maxHeaderExtensions map[RTPCodecType]int
+	bwePolicy           BWEPolicy
+
+	// Consulted for codecs of a kind that has none registered.
+	codecProvider func(typ RTPCodecType) []RTPCodecParameters
+	// Kinds the codec provider was consulted for, it's consulted once per kind.
+	providedKinds []RTPCodecType
+	// Remote codecs it returns false for are ignored.
+	remoteCodecFilter func(codec RTPCodecParameters, typ RTPCodecType) bool
+	// Codecs registered with RegisterCodecFunc that aren't generated yet.
+	lazyCodecs []*lazyCodec
+
+	// Application provided SVC layer configuration, keyed by lowercase MIME type.
+	svcLayers map[string]svcLayers
+	// Application provided bitrate caps in bits per second, keyed by lowercase MIME type.
+	codecMaxBitrates map[string]int
+	// Longest RID simulcast tracks may use, 0 for no limit.
+	maxRIDLength int
+	// Application provided payloader options, keyed by lowercase MIME type.
+	payloaderOptions map[string]PayloaderOptions
+	// Payload types offered codecs should use, keyed by MIME type and fmtp line.
+	seededPayloadTypes map[string]PayloadType
+
+	// fmtp parameters that override the remote's values, keyed by lowercase MIME type.
+	pinnedFmtpParameters map[string]map[string]string
+
+	// Canonical MIME types of remote MIME types, keyed by lowercase alias.
+	mimeAliases map[string]string
+
+	// Additional fmtp lines accepted when receiving, keyed by kind and payload type of the registered codec.
+	receiveAlternatives map[payloadTypeKey][]string
+
+	// Registered codecs that are neither offered nor accepted, keyed by kind and lowercase MIME type.
+	disabledCodecs map[codecKey]struct{}
+
+	// MIME types of the codecs header extensions are restricted to, keyed by URI.
+	headerExtensionCodecs map[string][]string
+
+	// MIME types of the media codecs FEC codecs are restricted to, keyed by lowercase FEC MIME type.
+	fecCodecs map[string][]string
+
+	// Directions registered codecs are restricted to, keyed by kind and payload type.
+	// Codecs without an entry can be used for both sending and receiving.
+	codecDirections map[payloadTypeKey]RTPTransceiverDirection
+
+	// Tags of registered codecs, keyed by kind and payload type.
+	codecTags map[payloadTypeKey][]string
+	// If set only codecs with this tag are offered and matched.
+	offerTag string
+
+	onHeaderExtensionNegotiated func(uri string, id int, typ RTPCodecType)
+	onCodecMatch                func(remote, local RTPCodecParameters, matchType CodecMatchType)
+	registrationObservers       []RegistrationObserver
+
+	// Callbacks queued while holding mu, fired once it is released.
+	pendingCallbacks []func()
+
+	log logging.LeveledLogger
+	now func() time.Time
+	// Number of codec stats IDs generated, it keeps them unique when codecs are
+	// registered within the same tick of the clock, or with a fixed clock.
+	codecStatsIDs uint64
+
 	mu sync.RWMutex
 }
 
+// SetLogger sets the logger the MediaEngine reports problems to, e.g. remote
+// codecs that were dropped or header extensions that couldn't be negotiated while
+// applying a remote description.
+func (m *MediaEngine) SetLogger(log logging.LeveledLogger) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.log = log
+}
+
+func (m *MediaEngine) logger() logging.LeveledLogger {
+	if m.log == nil {
+		return logging.NewDefaultLoggerFactory().NewLogger("mediaengine")
+	}
+
+	return m.log
+}
+
+func (m *MediaEngine) clock() time.Time {
+	if m.now == nil {
+		return time.Now()
+	}
+
+	return m.now()
+}
+
+// newCodecStatsID returns a unique ID for the CodecStats of a registered codec.
+// The caller must hold mu for writing.
+func (m *MediaEngine) newCodecStatsID() string {
+	m.codecStatsIDs++
+
+	return fmt.Sprintf("RTPCodec-%d-%d", m.clock().UnixNano(), m.codecStatsIDs)
+}
+
+// SetClock sets the clock used for the timestamps of codec stats and the
+// generation of codec stats IDs. It defaults to time.Now.
+func (m *MediaEngine) SetClock(now func() time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.now = now
+}
+
 // setMultiCodecNegotiation enables or disables the negotiation of multiple codecs.
 func (m *MediaEngine) setMultiCodecNegotiation(negotiateMultiCodecs bool) {
 	m.mu.Lock()
@@ -59,14 +301,139 @@ func (m *MediaEngine) multiCodecNegotiation() bool {
 	return m.negotiateMultiCodecs
 }
 
+// RegisterMultiopusCodec registers multi-channel Opus, as used by Chrome for 5.1
+// (6 channels) and 7.1 (8 channels) surround sound. Multiopus isn't part of the
+// default codecs and must be registered explicitly.
+func (m *MediaEngine) RegisterMultiopusCodec(channels uint16, payloadType PayloadType) error {
+	var sdpFmtpLine string
+	switch channels {
+	case 6:
+		sdpFmtpLine = "channel_mapping=0,4,1,2,3,5;coupled_streams=2;minptime=10;num_streams=4;useinbandfec=1"
+	case 8:
+		sdpFmtpLine = "channel_mapping=0,6,1,2,3,4,5,7;coupled_streams=3;minptime=10;num_streams=5;useinbandfec=1"
+	default:
+		return fmt.Errorf("%w: %d", ErrUnsupportedMultiopusChannels, channels)
+	}
+
+	return m.RegisterCodec(RTPCodecParameters{
+		RTPCodecCapability: RTPCodecCapability{MimeTypeMultiopus, 48000, channels, sdpFmtpLine, nil},
+		PayloadType:        payloadType,
+	}, RTPCodecTypeAudio)
+}
+
+// SetHonorRemoteCodecOrder makes the negotiated codecs follow the order of the
+// remote description, instead of the order they were matched in. RTX and FEC
+// codecs offered before their primary codec then keep their position too.
+func (m *MediaEngine) SetHonorRemoteCodecOrder(honor bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.honorRemoteCodecOrder = honor
+}
+
+// SetMaxNegotiatedCodecs limits how many codecs are negotiated per kind, codecs
+// matched beyond the limit are dropped. This protects against remotes offering an
+// excessive amount of codecs. 0, the default, means unlimited.
+func (m *MediaEngine) SetMaxNegotiatedCodecs(n int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.maxNegotiatedCodecs = max(n, 0)
+}
+
+// SetRequireUsableCodecs makes applying a remote description fail with
+// ErrNoCommonCodecs if a kind it offers ends up without negotiated codecs,
+// instead of failing later when a track of that kind is set up.
+func (m *MediaEngine) SetRequireUsableCodecs(require bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.requireUsableCodecs = require
+}
+
+// SetBWEExtensionPolicy sets which of the abs-send-time and transport-cc header extensions
+// are offered and used when both are registered and negotiated. Some bandwidth
+// estimators get confused by both of them.
+func (m *MediaEngine) SetBWEExtensionPolicy(policy BWEPolicy) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.bwePolicy = policy
+}
+
+// SetMaxHeaderExtensions limits how many header extensions are offered for typ, to
+// keep the SDP small for peers that can't handle long extmap lists. The header
+// extensions registered first are kept. n <= 0 removes the limit.
+func (m *MediaEngine) SetMaxHeaderExtensions(typ RTPCodecType, n int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if n <= 0 {
+		delete(m.maxHeaderExtensions, typ)
+
+		return
+	}
+	if m.maxHeaderExtensions == nil {
+		m.maxHeaderExtensions = map[RTPCodecType]int{}
+	}
+	m.maxHeaderExtensions[typ] = n
+}
+
+// SetMinMatchStrength sets the weakest match of a remote codec that is negotiated.
+// With CodecMatchExact, remote codecs whose fmtp parameters differ from the local
+// codec are not negotiated. The default, CodecMatchPartial, falls back to those when
+// no codec matches exactly.
+func (m *MediaEngine) SetMinMatchStrength(matchType CodecMatchType) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.minMatchType = matchType
+}
+
+// DefaultCodecOptions customizes the codecs registered by RegisterDefaultCodecsWithOptions.
+type DefaultCodecOptions struct {
+	// DisableREMB leaves the goog-remb feedback out of the video codecs.
+	DisableREMB bool
+	// TransportCC adds the transport-cc feedback to the video codecs. The transport-cc
+	// header extension and interceptor still have to be registered.
+	TransportCC bool
+	// DisabledCodecs lists the MIME types of default codecs not to register, e.g.
+	// MimeTypeH264 for all H264 profiles. Their RTX codecs aren't registered either.
+	DisabledCodecs []string
+}
+
 // RegisterDefaultCodecs registers the default codecs supported by Pion WebRTC.
 // RegisterDefaultCodecs is not safe for concurrent use.
 func (m *MediaEngine) RegisterDefaultCodecs() error {
+	return m.RegisterDefaultCodecsWithOptions(DefaultCodecOptions{})
+}
+
+// RegisterDefaultCodecsWithOptions registers the default codecs supported by Pion
+// WebRTC, customized by opts. RegisterDefaultCodecsWithOptions is not safe for
+// concurrent use.
+func (m *MediaEngine) RegisterDefaultCodecsWithOptions(opts DefaultCodecOptions) error {
+	disabled := map[PayloadType]struct{}{}
+	register := func(codec RTPCodecParameters, typ RTPCodecType) error {
+		isDisabled := slices.ContainsFunc(opts.DisabledCodecs, func(mime string) bool {
+			return strings.EqualFold(mime, codec.MimeType)
+		})
+		if apt, isRTX := rtxAssociatedPayloadType(codec); isRTX {
+			_, isDisabled = disabled[apt]
+		}
+		if isDisabled {
+			disabled[codec.PayloadType] = struct{}{}
+
+			return nil
+		}
+
+		return m.RegisterCodec(codec, typ)
+	}
+
 	// Default Pion Audio Codecs
 	for _, codec := range []RTPCodecParameters{
 		{
 			RTPCodecCapability: RTPCodecCapability{MimeTypeOpus, 48000, 2, "minptime=10;useinbandfec=1", nil},
-			PayloadType:        111,
+			PayloadType:        DefaultPayloadTypeOpus,
 		},
 		{
 			RTPCodecCapability: RTPCodecCapability{MimeTypeG722, 8000, 0, "", nil},
@@ -81,16 +448,22 @@ func (m *MediaEngine) RegisterDefaultCodecs() error {
 			PayloadType:        rtp.PayloadTypePCMA,
 		},
 	} {
-		if err := m.RegisterCodec(codec, RTPCodecTypeAudio); err != nil {
+		if err := register(codec, RTPCodecTypeAudio); err != nil {
 			return err
 		}
 	}
 
 	videoRTCPFeedback := []RTCPFeedback{{"goog-remb", ""}, {"ccm", "fir"}, {"nack", ""}, {"nack", "pli"}}
+	if opts.DisableREMB {
+		videoRTCPFeedback = videoRTCPFeedback[1:]
+	}
+	if opts.TransportCC {
+		videoRTCPFeedback = append(videoRTCPFeedback, RTCPFeedback{Type: TypeRTCPFBTransportCC})
+	}
 	for _, codec := range []RTPCodecParameters{
 		{
 			RTPCodecCapability: RTPCodecCapability{MimeTypeVP8, 90000, 0, "", videoRTCPFeedback},
-			PayloadType:        96,
+			PayloadType:        DefaultPayloadTypeVP8,
 		},
 		{
 			RTPCodecCapability: RTPCodecCapability{MimeTypeRTX, 90000, 0, "apt=96", nil},
@@ -103,7 +476,7 @@ func (m *MediaEngine) RegisterDefaultCodecs() error {
 				"level-asymmetry-allowed=1;packetization-mode=1;profile-level-id=42001f",
 				videoRTCPFeedback,
 			},
-			PayloadType: 102,
+			PayloadType: DefaultPayloadTypeH264,
 		},
 		{
 			RTPCodecCapability: RTPCodecCapability{MimeTypeRTX, 90000, 0, "apt=102", nil},
@@ -181,7 +554,7 @@ func (m *MediaEngine) RegisterDefaultCodecs() error {
 				ClockRate:    90000,
 				RTCPFeedback: videoRTCPFeedback,
 			},
-			PayloadType: 116,
+			PayloadType: DefaultPayloadTypeH265,
 		},
 		{
 			RTPCodecCapability: RTPCodecCapability{MimeTypeRTX, 90000, 0, "apt=116", nil},
@@ -189,7 +562,7 @@ func (m *MediaEngine) RegisterDefaultCodecs() error {
 		},
 		{
 			RTPCodecCapability: RTPCodecCapability{MimeTypeAV1, 90000, 0, "", videoRTCPFeedback},
-			PayloadType:        45,
+			PayloadType:        DefaultPayloadTypeAV1,
 		},
 		{
 			RTPCodecCapability: RTPCodecCapability{MimeTypeRTX, 90000, 0, "apt=45", nil},
@@ -198,7 +571,7 @@ func (m *MediaEngine) RegisterDefaultCodecs() error {
 
 		{
 			RTPCodecCapability: RTPCodecCapability{MimeTypeVP9, 90000, 0, "profile-id=0", videoRTCPFeedback},
-			PayloadType:        98,
+			PayloadType:        DefaultPayloadTypeVP9,
 		},
 		{
 			RTPCodecCapability: RTPCodecCapability{MimeTypeRTX, 90000, 0, "apt=98", nil},
@@ -207,7 +580,7 @@ func (m *MediaEngine) RegisterDefaultCodecs() error {
 
 		{
 			RTPCodecCapability: RTPCodecCapability{MimeTypeVP9, 90000, 0, "profile-id=2", videoRTCPFeedback},
-			PayloadType:        100,
+			PayloadType:        DefaultPayloadTypeVP9Profile2,
 		},
 		{
 			RTPCodecCapability: RTPCodecCapability{MimeTypeRTX, 90000, 0, "apt=100", nil},
@@ -227,7 +600,7 @@ func (m *MediaEngine) RegisterDefaultCodecs() error {
 			PayloadType:        113,
 		},
 	} {
-		if err := m.RegisterCodec(codec, RTPCodecTypeVideo); err != nil {
+		if err := register(codec, RTPCodecTypeVideo); err != nil {
 			return err
 		}
 	}
@@ -239,9 +612,7 @@ func (m *MediaEngine) RegisterDefaultCodecs() error {
 func (m *MediaEngine) addCodec(codecs []RTPCodecParameters, codec RTPCodecParameters) ([]RTPCodecParameters, error) {
 	for _, c := range codecs {
 		if c.PayloadType == codec.PayloadType {
-			if strings.EqualFold(c.MimeType, codec.MimeType) &&
-				fmtp.ClockRateEqual(c.MimeType, c.ClockRate, codec.ClockRate) &&
-				fmtp.ChannelsEqual(c.MimeType, c.Channels, codec.Channels) {
+			if sameCodec(c, codec) {
 				return codecs, nil
 			}
 
@@ -252,14 +623,34 @@ func (m *MediaEngine) addCodec(codecs []RTPCodecParameters, codec RTPCodecParame
 	return append(codecs, codec), nil
 }
 
+// sameCodec returns true if a and b have the same MIME type, clock rate and channels.
+func sameCodec(a, b RTPCodecParameters) bool {
+	return strings.EqualFold(a.MimeType, b.MimeType) &&
+		fmtp.ClockRateEqual(a.MimeType, a.ClockRate, b.ClockRate) &&
+		fmtp.ChannelsEqual(a.MimeType, a.Channels, b.Channels)
+}
+
 // RegisterCodec adds codec to the MediaEngine
 // These are the list of codecs supported by this PeerConnection.
+// The MimeType of codec must start with the kind of typ, e.g. "audio/" for audio codecs,
+// and its PayloadType must fit in the 7 bits of the RTP header.
 func (m *MediaEngine) RegisterCodec(codec RTPCodecParameters, typ RTPCodecType) error {
 	m.mu.Lock()
-	defer m.mu.Unlock()
+	defer m.unlockAndFireCallbacks()
+
+	return m.registerCodec(codec, typ)
+}
+
+func (m *MediaEngine) registerCodec(codec RTPCodecParameters, typ RTPCodecType) error {
+	if err := validateCodecMimeType(codec.MimeType, typ); err != nil {
+		return err
+	}
+	if codec.PayloadType > maxPayloadType {
+		return fmt.Errorf("%w: %d", ErrInvalidPayloadType, codec.PayloadType)
+	}
 
 	var err error
-	codec.statsID = fmt.Sprintf("RTPCodec-%d", time.Now().UnixNano())
+	codec.statsID = m.newCodecStatsID()
 	switch typ {
 	case RTPCodecTypeAudio:
 		m.audioCodecs, err = m.addCodec(m.audioCodecs, codec)
@@ -268,476 +659,3357 @@ func (m *MediaEngine) RegisterCodec(codec RTPCodecParameters, typ RTPCodecType)
 	default:
 		return ErrUnknownType
 	}
+	if err == nil {
+		m.queueCodecRegisteredCallbacks(codec, typ)
+	}
 
 	return err
 }
 
-// RegisterHeaderExtension adds a header extension to the MediaEngine
-// To determine the negotiated value use `GetHeaderExtensionID` after signaling is complete.
-//
-//nolint:cyclop
-func (m *MediaEngine) RegisterHeaderExtension(
-	extension RTPHeaderExtensionCapability,
-	typ RTPCodecType,
-	allowedDirections ...RTPTransceiverDirection,
-) error {
+// lazyCodec is a codec registered with RegisterCodecFunc. It is shared by the copies
+// of a MediaEngine, so the codec is generated once for all of them.
+type lazyCodec struct {
+	typ      RTPCodecType
+	generate func() RTPCodecParameters
+
+	once  sync.Once
+	codec RTPCodecParameters
+}
+
+func (l *lazyCodec) resolve() RTPCodecParameters {
+	l.once.Do(func() {
+		l.codec = l.generate()
+	})
+
+	return l.codec
+}
+
+// RegisterCodecFunc registers the codec returned by generate, like RegisterCodec.
+// generate is called once the codecs of the MediaEngine are first needed, i.e. when
+// the first offer or answer is built or a remote description is applied, rather than
+// at registration. This allows e.g. probing the hardware for the supported H264 level
+// only when it's needed. generate is called once, its result is shared by all
+// PeerConnections using the MediaEngine. generate must not call into the MediaEngine.
+// Invalid codecs returned by generate are logged and ignored. The generated codecs are
+// registered after the codecs registered by RegisterCodec, whenever those were
+// registered, so they are preferred less.
+func (m *MediaEngine) RegisterCodecFunc(generate func() RTPCodecParameters, typ RTPCodecType) error {
+	if typ != RTPCodecTypeAudio && typ != RTPCodecTypeVideo {
+		return ErrUnknownType
+	}
+	if generate == nil {
+		return ErrNilCodecFunc
+	}
+
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	if m.negotiatedHeaderExtensions == nil {
-		m.negotiatedHeaderExtensions = map[int]mediaEngineHeaderExtension{}
-	}
+	m.lazyCodecs = append(m.lazyCodecs, &lazyCodec{typ: typ, generate: generate})
 
-	if len(allowedDirections) == 0 {
-		allowedDirections = []RTPTransceiverDirection{RTPTransceiverDirectionRecvonly, RTPTransceiverDirectionSendonly}
-	}
+	return nil
+}
 
-	for _, direction := range allowedDirections {
-		if direction != RTPTransceiverDirectionRecvonly && direction != RTPTransceiverDirectionSendonly {
-			return ErrRegisterHeaderExtensionInvalidDirection
-		}
+// resolveLazyCodecs registers the codecs of RegisterCodecFunc that aren't registered yet.
+func (m *MediaEngine) resolveLazyCodecs() {
+	m.mu.RLock()
+	pending := len(m.lazyCodecs) != 0
+	m.mu.RUnlock()
+	if !pending {
+		return
 	}
 
-	extensionIndex := -1
-	for i := range m.headerExtensions {
-		if extension.URI == m.headerExtensions[i].uri {
-			extensionIndex = i
+	m.mu.Lock()
+	defer m.unlockAndFireCallbacks()
+
+	m.resolveLazyCodecsLocked()
+}
+
+func (m *MediaEngine) resolveLazyCodecsLocked() {
+	for _, lazy := range m.lazyCodecs {
+		if err := m.registerCodec(lazy.resolve(), lazy.typ); err != nil {
+			m.logger().Warnf("failed to register generated %s codec: %v", lazy.typ, err)
 		}
 	}
+	m.lazyCodecs = nil
+}
 
-	if extensionIndex == -1 {
-		m.headerExtensions = append(m.headerExtensions, mediaEngineHeaderExtension{})
-		extensionIndex = len(m.headerExtensions) - 1
-	}
+// AddRegistrationObserver adds an observer that is notified of every codec and
+// header extension registered from now on, including the RTX codecs registered
+// by AutoRegisterRTX. The observer is called once the registration is done and
+// the MediaEngine is unlocked, it may register further codecs itself.
+func (m *MediaEngine) AddRegistrationObserver(observer RegistrationObserver) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 
-	if typ == RTPCodecTypeAudio {
-		m.headerExtensions[extensionIndex].isAudio = true
-	} else if typ == RTPCodecTypeVideo {
-		m.headerExtensions[extensionIndex].isVideo = true
+	m.registrationObservers = append(m.registrationObservers, observer)
+}
+
+// queueCodecRegisteredCallbacks queues a call of the registration observers for codec.
+func (m *MediaEngine) queueCodecRegisteredCallbacks(codec RTPCodecParameters, typ RTPCodecType) {
+	for _, observer := range m.registrationObservers {
+		m.pendingCallbacks = append(m.pendingCallbacks, func() { observer.OnCodecRegistered(codec, typ) })
 	}
+}
 
-	m.headerExtensions[extensionIndex].uri = extension.URI
-	m.headerExtensions[extensionIndex].allowedDirections = allowedDirections
+// unlockAndFireCallbacks releases mu and calls the callbacks queued while holding it.
+func (m *MediaEngine) unlockAndFireCallbacks() {
+	callbacks := m.pendingCallbacks
+	m.pendingCallbacks = nil
+	m.mu.Unlock()
 
-	return nil
+	for _, callback := range callbacks {
+		callback()
+	}
 }
 
-// RegisterFeedback adds feedback mechanism to already registered codecs.
-func (m *MediaEngine) RegisterFeedback(feedback RTCPFeedback, typ RTPCodecType) {
+// RegisterCodecWithTags registers codec like RegisterCodec and tags it, e.g. with
+// "mobile" for the codecs offered to mobile clients. See CodecsByTag and SetOfferTag.
+// Registering an already registered codec again adds tags to the ones it has.
+func (m *MediaEngine) RegisterCodecWithTags(codec RTPCodecParameters, typ RTPCodecType, tags ...string) error {
 	m.mu.Lock()
-	defer m.mu.Unlock()
-
-	addUniqueFeedback := func(existing []RTCPFeedback) []RTCPFeedback {
-		for _, f := range existing {
-			if strings.EqualFold(f.Type, feedback.Type) && strings.EqualFold(f.Parameter, feedback.Parameter) {
-				return existing
-			}
-		}
+	defer m.unlockAndFireCallbacks()
 
-		return append(existing, feedback)
+	if err := m.registerCodec(codec, typ); err != nil {
+		return err
 	}
 
-	switch typ {
-	case RTPCodecTypeVideo:
-		for i, v := range m.videoCodecs {
-			v.RTCPFeedback = addUniqueFeedback(v.RTCPFeedback)
-			m.videoCodecs[i] = v
-		}
-	case RTPCodecTypeAudio:
-		for i, v := range m.audioCodecs {
-			v.RTCPFeedback = addUniqueFeedback(v.RTCPFeedback)
-			m.audioCodecs[i] = v
+	if m.codecTags == nil {
+		m.codecTags = map[payloadTypeKey][]string{}
+	}
+	key := payloadTypeKey{typ, codec.PayloadType}
+	for _, tag := range tags {
+		if !slices.Contains(m.codecTags[key], tag) {
+			m.codecTags[key] = append(slices.Clip(m.codecTags[key]), tag)
 		}
-	default:
 	}
+
+	return nil
 }
 
-// getHeaderExtensionID returns the negotiated ID for a header extension.
-// If the Header Extension isn't enabled ok will be false.
-func (m *MediaEngine) getHeaderExtensionID(extension RTPHeaderExtensionCapability) (
-	val int,
-	audioNegotiated, videoNegotiated bool,
-) {
+// CodecsByTag returns copies of the registered codecs of typ tagged with tag. RTX
+// codecs have the tags of the codec they repair.
+func (m *MediaEngine) CodecsByTag(tag string, typ RTPCodecType) []RTPCodecParameters {
+	m.resolveLazyCodecs()
+
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
-	if m.negotiatedHeaderExtensions == nil {
-		return 0, false, false
+	codecs := m.videoCodecs
+	if typ == RTPCodecTypeAudio {
+		codecs = m.audioCodecs
+	} else if typ != RTPCodecTypeVideo {
+		return nil
 	}
 
-	for id, h := range m.negotiatedHeaderExtensions {
-		if extension.URI == h.uri {
-			return id, h.isAudio, h.isVideo
+	var matches []RTPCodecParameters
+	for _, codec := range codecs {
+		if m.codecHasTag(codec, codecs, typ, tag) {
+			codec.RTCPFeedback = slices.Clone(codec.RTCPFeedback)
+			matches = append(matches, codec)
 		}
 	}
 
-	return
+	return matches
 }
 
-// copy copies any user modifiable state of the MediaEngine
-// all internal state is reset.
-func (m *MediaEngine) copy() *MediaEngine {
+// SetOfferTag restricts the codecs that are offered and matched with the remote
+// to those tagged with tag, e.g. to serve a class of clients a codec profile with
+// a copy of the MediaEngine. An empty tag removes the restriction.
+func (m *MediaEngine) SetOfferTag(tag string) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
-	cloned := &MediaEngine{
-		videoCodecs:      append([]RTPCodecParameters{}, m.videoCodecs...),
-		audioCodecs:      append([]RTPCodecParameters{}, m.audioCodecs...),
-		headerExtensions: append([]mediaEngineHeaderExtension{}, m.headerExtensions...),
-	}
-	if len(m.headerExtensions) > 0 {
-		cloned.negotiatedHeaderExtensions = map[int]mediaEngineHeaderExtension{}
-	}
 
-	return cloned
+	m.offerTag = tag
 }
 
-func findCodecByPayload(codecs []RTPCodecParameters, payloadType PayloadType) *RTPCodecParameters {
-	for _, codec := range codecs {
-		if codec.PayloadType == payloadType {
-			return &codec
-		}
+// codecHasTag returns true if codec of typ, or the primary codec in codecs it repairs, is tagged with tag.
+func (m *MediaEngine) codecHasTag(
+	codec RTPCodecParameters,
+	codecs []RTPCodecParameters,
+	typ RTPCodecType,
+	tag string,
+) bool {
+	if apt, isRTX := rtxAssociatedPayloadType(codec); isRTX && findCodecByPayload(codecs, apt) != nil {
+		return slices.Contains(m.codecTags[payloadTypeKey{typ, apt}], tag)
 	}
 
-	return nil
+	return slices.Contains(m.codecTags[payloadTypeKey{typ, codec.PayloadType}], tag)
 }
 
-func (m *MediaEngine) getCodecByPayload(payloadType PayloadType) (RTPCodecParameters, RTPCodecType, error) {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
+// AutoRegisterRTX registers an RTX codec for every registered codec of typ that
+// has nack feedback and no RTX codec yet. Each RTX codec gets a free dynamic
+// payload type and an apt of the codec it repairs, registered codecs keep their
+// payload types. Call it after registering the media codecs, codecs registered
+// later don't get an RTX codec.
+func (m *MediaEngine) AutoRegisterRTX(typ RTPCodecType) error {
+	m.mu.Lock()
+	defer m.unlockAndFireCallbacks()
 
-	// if we've negotiated audio or video, check the negotiated types before our
-	// built-in payload types, to ensure we pick the codec the other side wants.
-	if m.negotiatedVideo {
-		if codec := findCodecByPayload(m.negotiatedVideoCodecs, payloadType); codec != nil {
-			return *codec, RTPCodecTypeVideo, nil
-		}
+	m.resolveLazyCodecsLocked()
+
+	codecs := &m.videoCodecs
+	switch typ {
+	case RTPCodecTypeVideo:
+	case RTPCodecTypeAudio:
+		codecs = &m.audioCodecs
+	default:
+		return ErrUnknownType
 	}
-	if m.negotiatedAudio {
-		if codec := findCodecByPayload(m.negotiatedAudioCodecs, payloadType); codec != nil {
-			return *codec, RTPCodecTypeAudio, nil
+
+	for _, codec := range *codecs {
+		_, isRTX := rtxAssociatedPayloadType(codec)
+		if isRTX || findRTXPayloadType(codec.PayloadType, *codecs) != 0 ||
+			!slices.Contains(codec.RTCPFeedback, RTCPFeedback{Type: TypeRTCPFBNACK}) {
+			continue
+		}
+
+		payloadType, ok := m.freePayloadType()
+		if !ok {
+			return ErrNoFreePayloadType
+		}
+
+		rtxCodec := RTPCodecParameters{
+			RTPCodecCapability: RTPCodecCapability{
+				MimeType:    MimeTypeRTX,
+				ClockRate:   codec.ClockRate,
+				SDPFmtpLine: fmt.Sprintf("apt=%d", codec.PayloadType),
+			},
+			PayloadType: payloadType,
+			statsID:     m.newCodecStatsID(),
+		}
+		var err error
+		if *codecs, err = m.addCodec(*codecs, rtxCodec); err != nil {
+			return err
 		}
+		m.queueCodecRegisteredCallbacks(rtxCodec, typ)
 	}
-	if !m.negotiatedVideo {
-		if codec := findCodecByPayload(m.videoCodecs, payloadType); codec != nil {
-			return *codec, RTPCodecTypeVideo, nil
+
+	return nil
+}
+
+// freePayloadType returns the lowest dynamic payload type no registered codec uses.
+func (m *MediaEngine) freePayloadType() (PayloadType, bool) {
+	for payloadType := PayloadType(minDynamicPayloadType); payloadType <= maxPayloadType; payloadType++ {
+		if findCodecByPayload(m.videoCodecs, payloadType) == nil && findCodecByPayload(m.audioCodecs, payloadType) == nil {
+			return payloadType, true
 		}
 	}
-	if !m.negotiatedAudio {
-		if codec := findCodecByPayload(m.audioCodecs, payloadType); codec != nil {
-			return *codec, RTPCodecTypeAudio, nil
+
+	return 0, false
+}
+
+// ForceSingleCodec unregisters every codec of typ except the ones with the MIME
+// type mime and their RTX codecs. This is meant for troubleshooting, to make sure
+// a call uses a single codec. The tags, directions and receive alternatives of the
+// unregistered codecs are removed with them. It returns ErrCodecNotFound if no codec
+// with the MIME type mime is registered for typ.
+func (m *MediaEngine) ForceSingleCodec(mime string, typ RTPCodecType) error {
+	m.mu.Lock()
+	defer m.unlockAndFireCallbacks()
+
+	m.resolveLazyCodecsLocked()
+
+	codecs := &m.videoCodecs
+	switch typ {
+	case RTPCodecTypeVideo:
+	case RTPCodecTypeAudio:
+		codecs = &m.audioCodecs
+	default:
+		return ErrUnknownType
+	}
+
+	kept := func(codec RTPCodecParameters) bool { return strings.EqualFold(codec.MimeType, mime) }
+	if !slices.ContainsFunc(*codecs, kept) {
+		return fmt.Errorf("%w: %s", ErrCodecNotFound, mime)
+	}
+
+	*codecs = slices.DeleteFunc(slices.Clone(*codecs), func(codec RTPCodecParameters) bool {
+		removed := !kept(codec)
+		if apt, isRTX := rtxAssociatedPayloadType(codec); isRTX {
+			primary := findCodecByPayload(*codecs, apt)
+			removed = primary == nil || !kept(*primary)
+		}
+
+		// A codec registered later with the payload type doesn't inherit its settings
+		if removed {
+			key := payloadTypeKey{typ, codec.PayloadType}
+			delete(m.codecTags, key)
+			delete(m.codecDirections, key)
+			delete(m.receiveAlternatives, key)
 		}
+
+		return removed
+	})
+
+	return nil
+}
+
+// SetCodecEnabled enables or disables the registered codecs of typ with the MIME
+// type mime. Disabled codecs are neither offered nor accepted but stay registered,
+// so they can be enabled again later. Codecs are enabled by default.
+// Codecs can't be toggled once typ has been negotiated.
+func (m *MediaEngine) SetCodecEnabled(mime string, typ RTPCodecType, enabled bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if typ == RTPCodecTypeAudio && m.negotiatedAudio || typ == RTPCodecTypeVideo && m.negotiatedVideo {
+		return ErrCodecToggleAfterNegotiation
 	}
 
-	return RTPCodecParameters{}, 0, ErrCodecNotFound
+	key := codecKey{typ, strings.ToLower(mime)}
+	if enabled {
+		delete(m.disabledCodecs, key)
+
+		return nil
+	}
+
+	if m.disabledCodecs == nil {
+		m.disabledCodecs = map[codecKey]struct{}{}
+	}
+	m.disabledCodecs[key] = struct{}{}
+
+	return nil
 }
 
-func (m *MediaEngine) collectStats(collector *statsReportCollector) {
+// SetCodecDirection restricts the registered codec of typ with payloadType to direction,
+// e.g. recvonly for a codec that can be decoded but not encoded.
+func (m *MediaEngine) SetCodecDirection(
+	payloadType PayloadType,
+	typ RTPCodecType,
+	direction RTPTransceiverDirection,
+) error {
+	switch direction {
+	case RTPTransceiverDirectionSendrecv, RTPTransceiverDirectionSendonly, RTPTransceiverDirectionRecvonly:
+	default:
+		return ErrInvalidCodecDirection
+	}
+	if typ != RTPCodecTypeAudio && typ != RTPCodecTypeVideo {
+		return ErrUnknownType
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.codecDirections == nil {
+		m.codecDirections = map[payloadTypeKey]RTPTransceiverDirection{}
+	}
+	m.codecDirections[payloadTypeKey{typ, payloadType}] = direction
+
+	return nil
+}
+
+// NegotiatedCodecsForDirection returns the codecs of typ usable by a transceiver
+// in direction: codecs restricted to recvonly are left out for sendonly, and the
+// other way around. Sendrecv only returns codecs usable for both. Negotiated
+// codecs are mapped back to the registered codec they matched to find their
+// direction, RTX codecs follow the codec they repair. Codecs the remote only
+// listed in sendonly media sections are only used for receiving, and codecs of
+// recvonly sections only for sending.
+//
+// Unless multiple codecs are negotiated, the codecs a sendonly or recvonly media
+// section adds after a section of the opposite direction negotiated the kind are
+// only returned here. Transceivers keep sending and receiving the codecs
+// negotiated for the kind, the split is for applications that pick codecs with
+// SetCodecPreferences.
+func (m *MediaEngine) NegotiatedCodecsForDirection(
+	typ RTPCodecType,
+	direction RTPTransceiverDirection,
+) []RTPCodecParameters {
+	switch direction {
+	case RTPTransceiverDirectionSendrecv, RTPTransceiverDirectionSendonly, RTPTransceiverDirectionRecvonly:
+	default:
+		return nil
+	}
+
+	codecs := m.getCodecsByKind(typ)
+
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
-	statsLoop := func(codecs []RTPCodecParameters) {
+	negotiated := typ == RTPCodecTypeVideo && m.negotiatedVideo || typ == RTPCodecTypeAudio && m.negotiatedAudio
+	if negotiated {
+		codecs = append(slices.Clone(codecs), m.negotiatedDirectionalCodecs[typ]...)
+	}
+	registered := m.videoCodecs
+	if typ == RTPCodecTypeAudio {
+		registered = m.audioCodecs
+	}
+
+	// The remote may send and receive different codecs of a kind, e.g. in a sendonly
+	// and a recvonly media section
+	remoteDirection := func(codec RTPCodecParameters) RTPTransceiverDirection {
+		if remoteDirection, ok := m.negotiatedCodecDirections[payloadTypeKey{typ, codec.PayloadType}]; ok && negotiated {
+			return remoteDirection
+		}
+
+		return RTPTransceiverDirectionSendrecv
+	}
+	codecDirection := func(codec RTPCodecParameters) RTPTransceiverDirection {
+		remote := remoteDirection(codec)
+		if negotiated {
+			localCodec, matchType := codecParametersFuzzySearch(codec, registered)
+			if matchType == CodecMatchNone {
+				return remote
+			}
+			codec = localCodec
+		} else {
+			codec.PayloadType = m.registeredPayloadType(codec.PayloadType, typ)
+		}
+		if codecDirection, ok := m.codecDirections[payloadTypeKey{typ, codec.PayloadType}]; ok {
+			return intersectCodecDirections(codecDirection, remote)
+		}
+
+		return remote
+	}
+
+	result := []RTPCodecParameters{}
+	for _, codec := range codecs {
+		primary := codec
+		if apt, isRTX := rtxAssociatedPayloadType(codec); isRTX {
+			if aptCodec := findCodecByPayload(codecs, apt); aptCodec != nil {
+				primary = *aptCodec
+			}
+		}
+
+		switch codecDirection(primary) {
+		case RTPTransceiverDirectionSendonly:
+			if direction == RTPTransceiverDirectionSendonly {
+				result = append(result, codec)
+			}
+		case RTPTransceiverDirectionRecvonly:
+			if direction == RTPTransceiverDirectionRecvonly {
+				result = append(result, codec)
+			}
+		case RTPTransceiverDirectionInactive:
+		default:
+			result = append(result, codec)
+		}
+	}
+
+	return result
+}
+
+// recordNegotiatedCodecDirections adds the direction of media, from our point of view,
+// to the directions of the negotiated codecs it lists.
+func (m *MediaEngine) recordNegotiatedCodecDirections(media *sdp.MediaDescription, typ RTPCodecType) {
+	negotiatedCodecs := m.negotiatedVideoCodecs
+	if typ == RTPCodecTypeAudio {
+		negotiatedCodecs = m.negotiatedAudioCodecs
+	}
+
+	direction := RTPTransceiverDirectionSendrecv
+	if peerDirection := getPeerDirection(media); peerDirection != RTPTransceiverDirectionUnknown {
+		direction = peerDirection.Revers()
+	}
+
+	for _, format := range media.MediaName.Formats {
+		payloadType, err := strconv.ParseUint(format, 10, 8)
+		if err != nil || findCodecByPayload(negotiatedCodecs, PayloadType(payloadType)) == nil &&
+			findCodecByPayload(m.negotiatedDirectionalCodecs[typ], PayloadType(payloadType)) == nil {
+			continue
+		}
+
+		if m.negotiatedCodecDirections == nil {
+			m.negotiatedCodecDirections = map[payloadTypeKey]RTPTransceiverDirection{}
+		}
+		key := payloadTypeKey{typ, PayloadType(payloadType)}
+		if previous, ok := m.negotiatedCodecDirections[key]; ok && previous != direction {
+			m.negotiatedCodecDirections[key] = RTPTransceiverDirectionSendrecv
+		} else {
+			m.negotiatedCodecDirections[key] = direction
+		}
+	}
+}
+
+// isAsymmetricMediaSection reports whether media is sendonly or recvonly and codecs of
+// typ were negotiated by a section of the opposite direction.
+func (m *MediaEngine) isAsymmetricMediaSection(media *sdp.MediaDescription, typ RTPCodecType) bool {
+	peerDirection := getPeerDirection(media)
+	if peerDirection != RTPTransceiverDirectionSendonly && peerDirection != RTPTransceiverDirectionRecvonly {
+		return false
+	}
+
+	negotiatedCodecs := m.negotiatedVideoCodecs
+	if typ == RTPCodecTypeAudio {
+		negotiatedCodecs = m.negotiatedAudioCodecs
+	}
+	for _, codec := range negotiatedCodecs {
+		if m.negotiatedCodecDirections[payloadTypeKey{typ, codec.PayloadType}] == peerDirection {
+			return true
+		}
+	}
+
+	return false
+}
+
+// pushDirectionalCodecs adds codecs negotiated by a media section isAsymmetricMediaSection
+// reported to the directional codecs of typ. Codecs replace directional codecs with the
+// same payload type, payload types negotiated for the kind are left alone.
+func (m *MediaEngine) pushDirectionalCodecs(codecs []RTPCodecParameters, typ RTPCodecType) {
+	negotiatedCodecs := m.negotiatedVideoCodecs
+	if typ == RTPCodecTypeAudio {
+		negotiatedCodecs = m.negotiatedAudioCodecs
+	}
+
+	if m.negotiatedDirectionalCodecs == nil {
+		m.negotiatedDirectionalCodecs = map[RTPCodecType][]RTPCodecParameters{}
+	}
+	directionalCodecs := m.negotiatedDirectionalCodecs[typ]
+	for _, codec := range codecs {
+		if findCodecByPayload(negotiatedCodecs, codec.PayloadType) != nil {
+			continue
+		}
+
+		if i := slices.IndexFunc(directionalCodecs, func(directional RTPCodecParameters) bool {
+			return directional.PayloadType == codec.PayloadType
+		}); i >= 0 {
+			directionalCodecs[i] = codec
+		} else {
+			directionalCodecs = append(directionalCodecs, codec)
+		}
+	}
+	m.negotiatedDirectionalCodecs[typ] = directionalCodecs
+}
+
+// intersectCodecDirections returns the direction a codec usable in a and b may be used in,
+// inactive if there is none.
+func intersectCodecDirections(a, b RTPTransceiverDirection) RTPTransceiverDirection {
+	switch {
+	case a == RTPTransceiverDirectionSendrecv:
+		return b
+	case b == RTPTransceiverDirectionSendrecv, a == b:
+		return a
+	default:
+		return RTPTransceiverDirectionInactive
+	}
+}
+
+// RegisterNamedCodec is like RegisterCodec, name is reported in the CodecStats of
+// the codec and by RTPCodecParameters.Name of the local codecs passed to the
+// OnCodecMatch handler. This helps telling apart codecs with many variants,
+// e.g. "H264-CB-mode1".
+func (m *MediaEngine) RegisterNamedCodec(codec RTPCodecParameters, typ RTPCodecType, name string) error {
+	codec.name = name
+
+	return m.RegisterCodec(codec, typ)
+}
+
+// validateCodecMimeType checks that the MIME type prefix matches the kind of typ.
+// RTX is exempt, it is commonly registered as "video/rtx" for audio too.
+func validateCodecMimeType(mimeType string, typ RTPCodecType) error {
+	kind, subtype, _ := strings.Cut(mimeType, "/")
+	if strings.EqualFold(subtype, "rtx") || typ != RTPCodecTypeAudio && typ != RTPCodecTypeVideo {
+		return nil
+	}
+
+	if !strings.EqualFold(kind, typ.String()) {
+		return fmt.Errorf("%w: %s registered as %s", ErrCodecMimeTypeMismatch, mimeType, typ)
+	}
+
+	return nil
+}
+
+// CodecsByMimeType returns copies of all registered codecs of typ with the MIME
+// type mime, e.g. every H264 profile and packetization mode.
+func (m *MediaEngine) CodecsByMimeType(mime string, typ RTPCodecType) []RTPCodecParameters {
+	m.resolveLazyCodecs()
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	codecs := m.videoCodecs
+	if typ == RTPCodecTypeAudio {
+		codecs = m.audioCodecs
+	} else if typ != RTPCodecTypeVideo {
+		return nil
+	}
+
+	var matches []RTPCodecParameters
+	for _, codec := range codecs {
+		if strings.EqualFold(codec.MimeType, mime) {
+			codec.RTCPFeedback = slices.Clone(codec.RTCPFeedback)
+			matches = append(matches, codec)
+		}
+	}
+
+	return matches
+}
+
+// RTPClockRate returns the rate RTP timestamps of the registered codec with the
+// MIME type mime advance at, 0 if no such codec is registered. This is usually
+// the clock rate of the codec, but not always its sample rate: G722 samples at
+// 16000Hz while its RTP clock rate is 8000Hz for historical reasons, see
+// RFC 3551 section 4.5.2, so 8000 is returned for G722 whatever it was
+// registered with.
+func (m *MediaEngine) RTPClockRate(mime string) uint32 {
+	m.resolveLazyCodecs()
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, codecs := range [][]RTPCodecParameters{m.audioCodecs, m.videoCodecs} {
 		for _, codec := range codecs {
-			collector.Collecting()
-			stats := CodecStats{
-				Timestamp:   statsTimestampFrom(time.Now()),
-				Type:        StatsTypeCodec,
-				ID:          codec.statsID,
-				PayloadType: codec.PayloadType,
-				MimeType:    codec.MimeType,
-				ClockRate:   codec.ClockRate,
-				Channels:    uint8(codec.Channels), //nolint:gosec // G115
-				SDPFmtpLine: codec.SDPFmtpLine,
+			if !strings.EqualFold(codec.MimeType, mime) {
+				continue
+			}
+			if strings.EqualFold(mime, MimeTypeG722) {
+				return g722RTPClockRate
 			}
 
-			collector.Collect(stats.ID, stats)
+			return codec.ClockRate
 		}
 	}
 
-	statsLoop(m.videoCodecs)
-	statsLoop(m.audioCodecs)
+	return 0
 }
 
-// Look up a codec and enable if it exists.
-//
-//nolint:cyclop
-func (m *MediaEngine) matchRemoteCodec(
-	remoteCodec RTPCodecParameters,
-	typ RTPCodecType,
-	exactMatches, partialMatches []RTPCodecParameters,
-) (RTPCodecParameters, codecMatchType, error) {
+// ScalabilityModeSupported returns true if a codec with the MIME type mime is
+// registered and supports the scalability mode mode, e.g. "L3T3", see
+// https://www.w3.org/TR/webrtc-svc/#scalabilitymodes*. VP8 and H264 only support
+// temporal scalability, VP9 and AV1 support every mode.
+func (m *MediaEngine) ScalabilityModeSupported(mime, mode string) bool {
+	temporalModes := []string{"L1T1", "L1T2", "L1T3"}
+	svcModes := append(slices.Clone(temporalModes),
+		"L2T1", "L2T1h", "L2T1_KEY", "L2T2", "L2T2h", "L2T2_KEY", "L2T2_KEY_SHIFT",
+		"L2T3", "L2T3h", "L2T3_KEY", "L2T3_KEY_SHIFT",
+		"L3T1", "L3T1h", "L3T1_KEY", "L3T2", "L3T2h", "L3T2_KEY", "L3T2_KEY_SHIFT",
+		"L3T3", "L3T3h", "L3T3_KEY", "L3T3_KEY_SHIFT",
+		"S2T1", "S2T1h", "S2T2", "S2T2h", "S2T3", "S2T3h",
+		"S3T1", "S3T1h", "S3T2", "S3T2h", "S3T3", "S3T3h",
+	)
+
+	var modes []string
+	switch strings.ToLower(mime) {
+	case strings.ToLower(MimeTypeVP8), strings.ToLower(MimeTypeH264):
+		modes = temporalModes
+	case strings.ToLower(MimeTypeVP9), strings.ToLower(MimeTypeAV1):
+		modes = svcModes
+	default:
+		return false
+	}
+	if !slices.Contains(modes, mode) {
+		return false
+	}
+
+	m.resolveLazyCodecs()
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return slices.ContainsFunc(m.videoCodecs, func(codec RTPCodecParameters) bool {
+		return strings.EqualFold(codec.MimeType, mime)
+	})
+}
+
+// CodecsWithFeedback returns copies of all registered codecs of typ that have the
+// RTCP feedback feedback, e.g. every codec supporting transport-cc.
+func (m *MediaEngine) CodecsWithFeedback(feedback RTCPFeedback, typ RTPCodecType) []RTPCodecParameters {
+	m.resolveLazyCodecs()
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
 	codecs := m.videoCodecs
 	if typ == RTPCodecTypeAudio {
 		codecs = m.audioCodecs
+	} else if typ != RTPCodecTypeVideo {
+		return nil
 	}
 
-	remoteFmtp := fmtp.Parse(
-		remoteCodec.RTPCodecCapability.MimeType,
-		remoteCodec.RTPCodecCapability.ClockRate,
-		remoteCodec.RTPCodecCapability.Channels,
-		remoteCodec.RTPCodecCapability.SDPFmtpLine)
+	var matches []RTPCodecParameters
+	for _, codec := range codecs {
+		if slices.ContainsFunc(codec.RTCPFeedback, func(f RTCPFeedback) bool {
+			return strings.EqualFold(f.Type, feedback.Type) && strings.EqualFold(f.Parameter, feedback.Parameter)
+		}) {
+			codec.RTCPFeedback = slices.Clone(codec.RTCPFeedback)
+			matches = append(matches, codec)
+		}
+	}
 
-	if apt, hasApt := remoteFmtp.Parameter("apt"); hasApt { //nolint:nestif
-		payloadType, err := strconv.ParseUint(apt, 10, 8)
-		if err != nil {
-			return RTPCodecParameters{}, codecMatchNone, err
+	return matches
+}
+
+// SetCodecProvider sets a callback that supplies the codecs of a kind on demand.
+// The provider is only consulted for kinds that have no codecs registered, once the
+// codecs of that kind are first needed. It's consulted once per kind, its result is
+// registered with the MediaEngine like with RegisterCodec. Invalid codecs it returns
+// are logged and ignored. The provider must not call into the MediaEngine.
+func (m *MediaEngine) SetCodecProvider(provider func(typ RTPCodecType) []RTPCodecParameters) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.codecProvider = provider
+	m.providedKinds = nil
+}
+
+// resolveProvidedCodecs registers the codecs supplied by the codec provider
+// if no codecs of typ are registered yet.
+func (m *MediaEngine) resolveProvidedCodecs(typ RTPCodecType) {
+	m.mu.RLock()
+	pending := m.needsProvidedCodecs(typ)
+	m.mu.RUnlock()
+	if !pending {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.unlockAndFireCallbacks()
+
+	m.resolveProvidedCodecsLocked(typ)
+}
+
+func (m *MediaEngine) needsProvidedCodecs(typ RTPCodecType) bool {
+	if m.codecProvider == nil || slices.Contains(m.providedKinds, typ) {
+		return false
+	}
+
+	switch typ {
+	case RTPCodecTypeAudio:
+		return len(m.audioCodecs) == 0
+	case RTPCodecTypeVideo:
+		return len(m.videoCodecs) == 0
+	default:
+		return false
+	}
+}
+
+func (m *MediaEngine) resolveProvidedCodecsLocked(typ RTPCodecType) {
+	if !m.needsProvidedCodecs(typ) {
+		return
+	}
+
+	m.providedKinds = append(m.providedKinds, typ)
+	for _, codec := range m.codecProvider(typ) {
+		if err := m.registerCodec(codec, typ); err != nil {
+			m.logger().Warnf("failed to register provided %s codec: %v", typ, err)
 		}
+	}
+}
 
-		aptMatch := codecMatchNone
-		var aptCodec RTPCodecParameters
-		for _, codec := range exactMatches {
-			if codec.PayloadType == PayloadType(payloadType) {
-				aptMatch = codecMatchExact
-				aptCodec = codec
+// SetSVCLayers records how many spatial and temporal layers the encoder of the codec
+// with the given MIME type is configured for. This isn't signaled in SDP, it allows
+// forwarding logic to decide which layers can be dropped.
+func (m *MediaEngine) SetSVCLayers(mime string, spatial, temporal int) error {
+	if spatial < 1 || spatial > maxSVCLayers || temporal < 1 || temporal > maxSVCLayers {
+		return ErrInvalidSVCLayers
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.svcLayers == nil {
+		m.svcLayers = map[string]svcLayers{}
+	}
+	m.svcLayers[strings.ToLower(mime)] = svcLayers{spatial: spatial, temporal: temporal}
+
+	return nil
+}
+
+// SVCLayers returns the number of spatial and temporal layers set by SetSVCLayers
+// for the given MIME type. If none were set ok will be false.
+func (m *MediaEngine) SVCLayers(mime string) (spatial, temporal int, ok bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	layers, ok := m.svcLayers[strings.ToLower(mime)]
+
+	return layers.spatial, layers.temporal, ok
+}
+
+// SetCodecMaxBitrate caps the bitrate of the codec with the given MIME type at bps bits
+// per second, e.g. 32000 to never send Opus above 32 kbps. The MediaEngine only stores
+// the cap, it is up to the sender and the congestion controller to enforce it, see
+// CodecMaxBitrate. A bps of zero or less removes the cap.
+func (m *MediaEngine) SetCodecMaxBitrate(mime string, bps int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if bps <= 0 {
+		delete(m.codecMaxBitrates, strings.ToLower(mime))
+
+		return
+	}
+
+	if m.codecMaxBitrates == nil {
+		m.codecMaxBitrates = map[string]int{}
+	}
+	m.codecMaxBitrates[strings.ToLower(mime)] = bps
+}
+
+// CodecMaxBitrate returns the bitrate cap set by SetCodecMaxBitrate for the codec with
+// payloadType, in bits per second. If the codec isn't capped ok will be false.
+func (m *MediaEngine) CodecMaxBitrate(payloadType PayloadType) (bps int, ok bool) {
+	codec, _, err := m.getCodecByPayload(payloadType)
+	if err != nil {
+		return 0, false
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	bps, ok = m.codecMaxBitrates[strings.ToLower(codec.MimeType)]
+
+	return bps, ok
+}
+
+// SetMaxRIDLength limits the RIDs of simulcast tracks to n characters, e.g. for peers
+// with a fixed size buffer for the RTP stream ID header extension. Adding a track with
+// a longer RID to a RTPSender fails with ErrRIDTooLong. An n of zero or less removes
+// the limit.
+func (m *MediaEngine) SetMaxRIDLength(n int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.maxRIDLength = max(n, 0)
+}
+
+// validateRID returns an error if rid is longer than allowed by SetMaxRIDLength.
+func (m *MediaEngine) validateRID(rid string) error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if m.maxRIDLength > 0 && len(rid) > m.maxRIDLength {
+		return fmt.Errorf("%w: %q has %d characters, at most %d are allowed", ErrRIDTooLong, rid, len(rid), m.maxRIDLength)
+	}
+
+	return nil
+}
+
+// PinFmtpParameter makes negotiated codecs of the given MIME type always use value for
+// the fmtp parameter key, regardless of the value the remote offered. For example pinning
+// useinbandfec=0 for Opus disables in-band FEC even if the remote prefers it.
+func (m *MediaEngine) PinFmtpParameter(mime, key, value string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.pinnedFmtpParameters == nil {
+		m.pinnedFmtpParameters = map[string]map[string]string{}
+	}
+
+	mime = strings.ToLower(mime)
+	if m.pinnedFmtpParameters[mime] == nil {
+		m.pinnedFmtpParameters[mime] = map[string]string{}
+	}
+	m.pinnedFmtpParameters[mime][strings.ToLower(key)] = value
+}
+
+// AddReceiveAlternative adds an fmtp line the registered codec of typ with payloadType
+// accepts from the remote in addition to its own, e.g. another H264 profile the
+// decoder supports. Alternatives aren't offered, so the offer keeps a single
+// entry for the codec.
+func (m *MediaEngine) AddReceiveAlternative(payloadType PayloadType, typ RTPCodecType, fmtpLine string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.receiveAlternatives == nil {
+		m.receiveAlternatives = map[payloadTypeKey][]string{}
+	}
+	key := payloadTypeKey{typ, payloadType}
+	m.receiveAlternatives[key] = append(m.receiveAlternatives[key], fmtpLine)
+}
+
+// RegisterMimeAlias makes remote codecs with the MIME type alias match as if
+// they were offered with the canonical MIME type, e.g. "video/x-vp8" as
+// "video/VP8". Negotiated codecs use the canonical MIME type.
+func (m *MediaEngine) RegisterMimeAlias(canonical, alias string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.mimeAliases == nil {
+		m.mimeAliases = map[string]string{}
+	}
+	m.mimeAliases[strings.ToLower(alias)] = canonical
+}
+
+// RegisterHeaderExtension adds a header extension to the MediaEngine
+// To determine the negotiated value use `HeaderExtensionID` after signaling is complete.
+func (m *MediaEngine) RegisterHeaderExtension(
+	extension RTPHeaderExtensionCapability,
+	typ RTPCodecType,
+	allowedDirections ...RTPTransceiverDirection,
+) error {
+	m.mu.Lock()
+	defer m.unlockAndFireCallbacks()
+
+	return m.registerHeaderExtension(extension, typ, allowedDirections...)
+}
+
+// RegisterHeaderExtensions adds multiple header extensions to the MediaEngine.
+// If any of them can't be registered none of them are.
+func (m *MediaEngine) RegisterHeaderExtensions(
+	extensions []RTPHeaderExtensionCapability,
+	typ RTPCodecType,
+	allowedDirections ...RTPTransceiverDirection,
+) error {
+	m.mu.Lock()
+	defer m.unlockAndFireCallbacks()
+
+	headerExtensions := append([]mediaEngineHeaderExtension{}, m.headerExtensions...)
+	pendingCallbacks := len(m.pendingCallbacks)
+	for _, extension := range extensions {
+		if err := m.registerHeaderExtension(extension, typ, allowedDirections...); err != nil {
+			m.headerExtensions = headerExtensions
+			m.pendingCallbacks = m.pendingCallbacks[:pendingCallbacks]
+
+			return err
+		}
+	}
+
+	return nil
+}
+
+//nolint:cyclop
+func (m *MediaEngine) registerHeaderExtension(
+	extension RTPHeaderExtensionCapability,
+	typ RTPCodecType,
+	allowedDirections ...RTPTransceiverDirection,
+) error {
+	if m.negotiatedHeaderExtensions == nil {
+		m.negotiatedHeaderExtensions = map[int]mediaEngineHeaderExtension{}
+	}
+
+	if len(allowedDirections) == 0 {
+		allowedDirections = []RTPTransceiverDirection{RTPTransceiverDirectionRecvonly, RTPTransceiverDirectionSendonly}
+	}
+
+	for _, direction := range allowedDirections {
+		if direction != RTPTransceiverDirectionRecvonly && direction != RTPTransceiverDirectionSendonly {
+			return ErrRegisterHeaderExtensionInvalidDirection
+		}
+	}
+
+	if !headerExtensionKindAllowed(extension.URI, typ) {
+		return ErrHeaderExtensionInvalidKind
+	}
+
+	extensionIndex := -1
+	for i := range m.headerExtensions {
+		if extension.URI == m.headerExtensions[i].uri {
+			extensionIndex = i
+		}
+	}
+
+	if extensionIndex == -1 {
+		m.headerExtensions = append(m.headerExtensions, mediaEngineHeaderExtension{})
+		extensionIndex = len(m.headerExtensions) - 1
+	}
+
+	if typ == RTPCodecTypeAudio {
+		m.headerExtensions[extensionIndex].isAudio = true
+	} else if typ == RTPCodecTypeVideo {
+		m.headerExtensions[extensionIndex].isVideo = true
+	}
+
+	m.headerExtensions[extensionIndex].uri = extension.URI
+	m.headerExtensions[extensionIndex].allowedDirections = allowedDirections
+
+	for _, observer := range m.registrationObservers {
+		m.pendingCallbacks = append(m.pendingCallbacks, func() { observer.OnHeaderExtensionRegistered(extension, typ) })
+	}
+
+	return nil
+}
+
+// UnregisterHeaderExtension removes a header extension from the MediaEngine.
+// If nothing has been negotiated yet it is removed from the negotiated header extensions as well.
+// It is a no-op if the header extension isn't registered.
+func (m *MediaEngine) UnregisterHeaderExtension(uri string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.headerExtensions = slices.DeleteFunc(m.headerExtensions, func(extension mediaEngineHeaderExtension) bool {
+		return extension.uri == uri
+	})
+
+	if m.negotiatedAudio || m.negotiatedVideo {
+		return
+	}
+
+	maps.DeleteFunc(m.negotiatedHeaderExtensions, func(_ int, extension mediaEngineHeaderExtension) bool {
+		return extension.uri == uri
+	})
+}
+
+// ClearHeaderExtensions removes all header extensions from the MediaEngine, so none are
+// offered or accepted. Like UnregisterHeaderExtension it should be called before
+// negotiation, afterwards the negotiated header extensions are kept.
+func (m *MediaEngine) ClearHeaderExtensions() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.headerExtensions = nil
+
+	if m.negotiatedAudio || m.negotiatedVideo {
+		return
+	}
+
+	m.negotiatedHeaderExtensions = map[int]mediaEngineHeaderExtension{}
+}
+
+// SetTwoByteHeaderExtensionIDs enables or disables assigning the two-byte header extension
+// IDs 15-255 once the one-byte IDs 1-14 are used up, see RFC 8285. It is disabled by default,
+// header extensions that don't get a one-byte ID aren't offered. Offers with two-byte IDs
+// include a=extmap-allow-mixed and TrackLocalStaticRTP and TrackLocalStaticSample write
+// the header extensions they add with the two-byte profile. Interceptors adding header
+// extensions to packets must do the same, see RequiresTwoByteExtensions.
+func (m *MediaEngine) SetTwoByteHeaderExtensionIDs(enabled bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.twoByteHeaderExtensionIDs = enabled
+}
+
+// RequiresTwoByteExtensions returns true if a header extension of typ has an ID that
+// doesn't fit in a one-byte header extension, so packets of typ need two-byte header
+// extensions and the description needs a=extmap-allow-mixed. Before typ has been
+// negotiated the IDs are the ones the next offer assigns, more than 14 header
+// extensions need two-byte IDs if SetTwoByteHeaderExtensionIDs enabled them.
+func (m *MediaEngine) RequiresTwoByteExtensions(typ RTPCodecType) bool {
+	params := m.getRTPParametersByKind(typ, []RTPTransceiverDirection{RTPTransceiverDirectionSendrecv})
+
+	return slices.ContainsFunc(params.HeaderExtensions, func(extension RTPHeaderExtensionParameter) bool {
+		return extension.ID > maxHeaderExtensionID
+	})
+}
+
+// AvailableHeaderExtensionIDs returns how many one-byte header extension IDs are still free.
+// IDs taken by negotiated header extensions and IDs that registered header extensions
+// will be assigned when the next offer is generated are not available.
+func (m *MediaEngine) AvailableHeaderExtensionIDs() int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	used := 0
+	for id := range m.negotiatedHeaderExtensions {
+		if id >= minHeaderExtensionID && id <= maxHeaderExtensionID {
+			used++
+		}
+	}
+
+	for _, extension := range m.headerExtensions {
+		negotiated := false
+		for _, negotiatedExtension := range m.negotiatedHeaderExtensions {
+			if negotiatedExtension.uri == extension.uri {
+				negotiated = true
+
+				break
+			}
+		}
+
+		if !negotiated {
+			used++
+		}
+	}
+
+	return max(maxHeaderExtensionID-minHeaderExtensionID+1-used, 0)
+}
+
+// SetStrictHeaderExtensions enables or disables strict header extension negotiation.
+// In strict mode header extensions offered by the remote are ignored unless they are
+// registered for the kind of the media section they appear in, so they never end up
+// in the negotiated state or take up an ID.
+func (m *MediaEngine) SetStrictHeaderExtensions(strict bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.strictHeaderExtensions = strict
+}
+
+// OnHeaderExtensionNegotiated sets a handler that is called every time a header
+// extension is negotiated for a kind under an ID it wasn't negotiated with before.
+// The handler is called once the MediaEngine has finished processing the remote
+// description, it is safe to call methods of the MediaEngine from it.
+func (m *MediaEngine) OnHeaderExtensionNegotiated(f func(uri string, id int, typ RTPCodecType)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.onHeaderExtensionNegotiated = f
+}
+
+// OnCodecMatch sets a handler that is called for every codec of every media section
+// of a remote description, in order, with the local codec it matched and how well.
+// local is empty if the remote codec didn't match. Like OnHeaderExtensionNegotiated
+// the handler is called once the MediaEngine has finished processing the remote
+// description.
+func (m *MediaEngine) OnCodecMatch(f func(remote, local RTPCodecParameters, matchType CodecMatchType)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.onCodecMatch = f
+}
+
+// SetRemoteCodecFilter sets a filter the codecs of remote descriptions are passed to
+// before they are matched with the registered codecs. Codecs f returns false for are
+// ignored, as if the remote hadn't offered them, e.g. to reject H264 below a level.
+// RTX codecs are passed to f as well, RTX of a rejected codec isn't negotiated.
+// f is called without the MediaEngine locked, before the remote description is applied.
+func (m *MediaEngine) SetRemoteCodecFilter(f func(codec RTPCodecParameters, typ RTPCodecType) bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.remoteCodecFilter = f
+}
+
+// runRemoteCodecFilter returns the payload types the remote codec filter rejects in
+// each media section of desc. The lock is only held to read the filter, so the
+// filter may call into the MediaEngine.
+func (m *MediaEngine) runRemoteCodecFilter(desc sdp.SessionDescription) map[int]map[PayloadType]struct{} {
+	m.mu.RLock()
+	filter := m.remoteCodecFilter
+	m.mu.RUnlock()
+
+	if filter == nil {
+		return nil
+	}
+
+	rejections := map[int]map[PayloadType]struct{}{}
+	for mediaIndex, media := range desc.MediaDescriptions {
+		typ := NewRTPCodecType(media.MediaName.Media)
+		if typ != RTPCodecTypeAudio && typ != RTPCodecTypeVideo {
+			continue
+		}
+
+		codecs, err := codecsFromMediaDescription(media)
+		if err != nil {
+			continue
+		}
+
+		for _, codec := range codecs {
+			if filter(codec, typ) {
+				continue
+			}
+			if rejections[mediaIndex] == nil {
+				rejections[mediaIndex] = map[PayloadType]struct{}{}
+			}
+			rejections[mediaIndex][codec.PayloadType] = struct{}{}
+		}
+	}
+
+	return rejections
+}
+
+// filterRemoteCodecs removes the codecs listed in rejected from codecs.
+func filterRemoteCodecs(codecs []RTPCodecParameters, rejected map[PayloadType]struct{}) []RTPCodecParameters {
+	return slices.DeleteFunc(codecs, func(codec RTPCodecParameters) bool {
+		_, ok := rejected[codec.PayloadType]
+
+		return ok
+	})
+}
+
+// HeaderExtensionAllowsDirection returns true if the registered header extension may be
+// used by transceivers of the given direction. Sendrecv requires both sendonly and recvonly
+// to be allowed. Unknown header extensions return false.
+func (m *MediaEngine) HeaderExtensionAllowsDirection(uri string, direction RTPTransceiverDirection) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, extension := range m.headerExtensions {
+		if extension.uri != uri {
+			continue
+		}
+
+		if direction == RTPTransceiverDirectionSendrecv {
+			return slices.Contains(extension.allowedDirections, RTPTransceiverDirectionSendonly) &&
+				slices.Contains(extension.allowedDirections, RTPTransceiverDirectionRecvonly)
+		}
+
+		return slices.Contains(extension.allowedDirections, direction)
+	}
+
+	return false
+}
+
+// ValidateHeaderExtensions checks the registered header extensions for
+// combinations that can't work. repaired-rtp-stream-id names the stream an RTX
+// packet repairs by its rtp-stream-id, so it's useless without rtp-stream-id.
+func (m *MediaEngine) ValidateHeaderExtensions() error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, typ := range []RTPCodecType{RTPCodecTypeAudio, RTPCodecTypeVideo} {
+		if m.headerExtensionRegistered(sdp.SDESRepairRTPStreamIDURI, typ) &&
+			!m.headerExtensionRegistered(sdp.SDESRTPStreamIDURI, typ) {
+			return fmt.Errorf("%w: %s", ErrRepairedStreamIDWithoutStreamID, typ)
+		}
+	}
+
+	return nil
+}
+
+// RestrictHeaderExtensionToCodecs makes the header extension with uri only be
+// offered and answered when a codec with one of the MIME types mimes is, e.g.
+// the dependency descriptor for AV1. Passing no MIME types lifts the restriction.
+func (m *MediaEngine) RestrictHeaderExtensionToCodecs(uri string, mimes []string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if len(mimes) == 0 {
+		delete(m.headerExtensionCodecs, uri)
+
+		return
+	}
+
+	if m.headerExtensionCodecs == nil {
+		m.headerExtensionCodecs = map[string][]string{}
+	}
+	m.headerExtensionCodecs[uri] = slices.Clone(mimes)
+}
+
+// headerExtensionUsable returns false if the header extension with uri is restricted
+// to codecs none of which are in codecs.
+func (m *MediaEngine) headerExtensionUsable(uri string, codecs []RTPCodecParameters) bool {
+	mimes, restricted := m.headerExtensionCodecs[uri]
+	if !restricted {
+		return true
+	}
+
+	return slices.ContainsFunc(codecs, func(codec RTPCodecParameters) bool {
+		return slices.ContainsFunc(mimes, func(mime string) bool { return strings.EqualFold(mime, codec.MimeType) })
+	})
+}
+
+// headerExtensionRegistered returns true if uri is registered for typ.
+func (m *MediaEngine) headerExtensionRegistered(uri string, typ RTPCodecType) bool {
+	for _, extension := range m.headerExtensions {
+		if extension.uri == uri && extension.hasKind(typ) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// headerExtensionKindAllowed returns false for header extensions that are only defined for one kind of media.
+func headerExtensionKindAllowed(uri string, typ RTPCodecType) bool {
+	switch uri {
+	case GenericFrameDescriptorURI, DependencyDescriptorURI, VideoContentTypeURI, VideoTimingURI,
+		VideoLayersAllocationURI:
+		return typ == RTPCodecTypeVideo
+	case CSRCAudioLevelURI:
+		return typ == RTPCodecTypeAudio
+	default:
+		return true
+	}
+}
+
+// RegisterFeedback adds feedback mechanism to already registered codecs.
+func (m *MediaEngine) RegisterFeedback(feedback RTCPFeedback, typ RTPCodecType) {
+	m.mu.Lock()
+	defer m.unlockAndFireCallbacks()
+
+	m.resolveLazyCodecsLocked()
+
+	addUniqueFeedback := func(existing []RTCPFeedback) []RTCPFeedback {
+		for _, f := range existing {
+			if strings.EqualFold(f.Type, feedback.Type) && strings.EqualFold(f.Parameter, feedback.Parameter) {
+				return existing
+			}
+		}
+
+		return append(existing, feedback)
+	}
+
+	switch typ {
+	case RTPCodecTypeVideo:
+		for i, v := range m.videoCodecs {
+			v.RTCPFeedback = addUniqueFeedback(v.RTCPFeedback)
+			m.videoCodecs[i] = v
+		}
+	case RTPCodecTypeAudio:
+		for i, v := range m.audioCodecs {
+			v.RTCPFeedback = addUniqueFeedback(v.RTCPFeedback)
+			m.audioCodecs[i] = v
+		}
+	default:
+	}
+}
+
+// Merge adds the codecs and header extensions registered in other to the MediaEngine.
+// Codecs are deduplicated the same way RegisterCodec does it, RTCPFeedback of codecs
+// present in both MediaEngines is unioned. Codecs that use an already registered
+// payload type for a different codec are not added and reported as errors.
+func (m *MediaEngine) Merge(other *MediaEngine) error {
+	if other == nil || other == m {
+		return nil
+	}
+
+	other.resolveLazyCodecs()
+	other.mu.RLock()
+	videoCodecs := append([]RTPCodecParameters{}, other.videoCodecs...)
+	audioCodecs := append([]RTPCodecParameters{}, other.audioCodecs...)
+	headerExtensions := append([]mediaEngineHeaderExtension{}, other.headerExtensions...)
+	other.mu.RUnlock()
+
+	m.mu.Lock()
+	defer m.unlockAndFireCallbacks()
+
+	m.resolveLazyCodecsLocked()
+
+	var videoErr, audioErr error
+	m.videoCodecs, videoErr = m.mergeCodecs(m.videoCodecs, videoCodecs)
+	m.audioCodecs, audioErr = m.mergeCodecs(m.audioCodecs, audioCodecs)
+
+	if len(headerExtensions) > 0 && m.negotiatedHeaderExtensions == nil {
+		m.negotiatedHeaderExtensions = map[int]mediaEngineHeaderExtension{}
+	}
+
+	for _, extension := range headerExtensions {
+		extensionIndex := -1
+		for i := range m.headerExtensions {
+			if extension.uri == m.headerExtensions[i].uri {
+				extensionIndex = i
+			}
+		}
+
+		if extensionIndex == -1 {
+			extension.allowedDirections = append([]RTPTransceiverDirection{}, extension.allowedDirections...)
+			m.headerExtensions = append(m.headerExtensions, extension)
+
+			continue
+		}
+
+		existing := &m.headerExtensions[extensionIndex]
+		existing.isAudio = existing.isAudio || extension.isAudio
+		existing.isVideo = existing.isVideo || extension.isVideo
+		for _, direction := range extension.allowedDirections {
+			if !slices.Contains(existing.allowedDirections, direction) {
+				existing.allowedDirections = append(existing.allowedDirections, direction)
+			}
+		}
+	}
+
+	return errors.Join(videoErr, audioErr)
+}
+
+// mergeCodecs adds others to codecs, unioning the RTCPFeedback of codecs that already exist.
+func (m *MediaEngine) mergeCodecs(codecs, others []RTPCodecParameters) ([]RTPCodecParameters, error) {
+	var joinedErr error
+	for _, codec := range others {
+		var err error
+		if codecs, err = m.addCodec(codecs, codec); err != nil {
+			joinedErr = errors.Join(joinedErr, err)
+
+			continue
+		}
+
+		for i := range codecs {
+			if codecs[i].PayloadType == codec.PayloadType {
+				codecs[i].RTCPFeedback = rtcpFeedbackUnion(codecs[i].RTCPFeedback, codec.RTCPFeedback)
+			}
+		}
+	}
+
+	return codecs, joinedErr
+}
+
+// getHeaderExtensionID returns the negotiated ID for a header extension.
+// If the Header Extension isn't enabled ok will be false.
+func (m *MediaEngine) getHeaderExtensionID(extension RTPHeaderExtensionCapability) (
+	val int,
+	audioNegotiated, videoNegotiated bool,
+) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if m.negotiatedHeaderExtensions == nil {
+		return 0, false, false
+	}
+
+	// Prefer the lowest ID so the result is deterministic
+	for id, h := range m.negotiatedHeaderExtensions {
+		if extension.URI == h.uri && (val == 0 || id < val) {
+			val, audioNegotiated, videoNegotiated = id, h.isAudio, h.isVideo
+		}
+	}
+
+	return
+}
+
+// RTXPayloadType returns the payload type of the RTX codec negotiated for the media
+// codec of typ with payload type mediaPT. If RTX wasn't negotiated for it ok will be false.
+func (m *MediaEngine) RTXPayloadType(mediaPT PayloadType, typ RTPCodecType) (rtxPT PayloadType, ok bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	codecs := m.negotiatedVideoCodecs
+	if typ == RTPCodecTypeAudio {
+		codecs = m.negotiatedAudioCodecs
+	} else if typ != RTPCodecTypeVideo {
+		return 0, false
+	}
+
+	for _, codec := range codecs {
+		if apt, isRTX := rtxAssociatedPayloadType(codec); isRTX && apt == mediaPT {
+			return codec.PayloadType, true
+		}
+	}
+
+	return 0, false
+}
+
+// ReducedSizeRTCPNegotiated returns true if the remote signaled support for
+// reduced-size RTCP with a=rtcp-rsize, see RFC 5506.
+func (m *MediaEngine) ReducedSizeRTCPNegotiated() bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.negotiatedReducedSizeRTCP
+}
+
+// NegotiatedBundleGroups returns the mids of each BUNDLE group of the last
+// applied remote description, see RFC 9143.
+func (m *MediaEngine) NegotiatedBundleGroups() [][]string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	groups := make([][]string, 0, len(m.negotiatedBundleGroups))
+	for _, group := range m.negotiatedBundleGroups {
+		groups = append(groups, slices.Clone(group))
+	}
+
+	return groups
+}
+
+// bundleGroups returns the mids of each a=group:BUNDLE attribute of desc.
+func bundleGroups(desc sdp.SessionDescription) [][]string {
+	var groups [][]string
+	for _, attr := range desc.Attributes {
+		if attr.Key != sdp.AttrKeyGroup {
+			continue
+		}
+		fields := strings.Fields(attr.Value)
+		if len(fields) == 0 || !strings.EqualFold(fields[0], "BUNDLE") {
+			continue
+		}
+		groups = append(groups, fields[1:])
+	}
+
+	return groups
+}
+
+// NegotiatedMatchType returns whether the codec of typ negotiated with payloadType was
+// an exact or a partial match of a local codec. A partial match means the fmtp
+// parameters, e.g. the H264 profile, differ from the registered codec.
+func (m *MediaEngine) NegotiatedMatchType(payloadType PayloadType, typ RTPCodecType) (CodecMatchType, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	matchType, ok := m.negotiatedMatchTypes[payloadTypeKey{typ, payloadType}]
+
+	return matchType, ok
+}
+
+// NegotiatedPayloadTypes returns the payload types of the negotiated audio and video
+// codecs in ascending order, e.g. to build a table demultiplexing incoming packets.
+// Kinds that haven't been negotiated yet don't contribute.
+func (m *MediaEngine) NegotiatedPayloadTypes() []PayloadType {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	payloadTypes := make([]PayloadType, 0, len(m.negotiatedAudioCodecs)+len(m.negotiatedVideoCodecs))
+	for _, codec := range m.negotiatedAudioCodecs {
+		payloadTypes = append(payloadTypes, codec.PayloadType)
+	}
+	for _, codec := range m.negotiatedVideoCodecs {
+		payloadTypes = append(payloadTypes, codec.PayloadType)
+	}
+	slices.Sort(payloadTypes)
+
+	return slices.Compact(payloadTypes)
+}
+
+// LocalCapabilityForPayloadType returns the registered codec the codec of typ negotiated
+// with payloadType matched. The negotiated codec carries the remote's payload type
+// and fmtp line, the returned capability is the one the application registered,
+// e.g. to pick the encoder for payloadType.
+func (m *MediaEngine) LocalCapabilityForPayloadType(
+	payloadType PayloadType,
+	typ RTPCodecType,
+) (RTPCodecCapability, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	capability, ok := m.negotiatedLocalCodecs[payloadTypeKey{typ, payloadType}]
+	if !ok {
+		return RTPCodecCapability{}, false
+	}
+	capability.RTCPFeedback = slices.Clone(capability.RTCPFeedback)
+
+	return capability, true
+}
+
+// PayloadTypeForCodec returns the payload type of the codec matching capability, the
+// inverse of looking up a codec by payload type. Once the kind of capability has been
+// negotiated the payload type the remote expects is returned, before the registered
+// one. Codecs with differing fmtp parameters, e.g. another H264 profile, only match
+// if no codec matches exactly.
+func (m *MediaEngine) PayloadTypeForCodec(capability RTPCodecCapability) (PayloadType, bool) {
+	kind, _, _ := strings.Cut(capability.MimeType, "/")
+	typ := NewRTPCodecType(kind)
+	if typ == RTPCodecType(0) {
+		return 0, false
+	}
+
+	codec, matchType := codecParametersFuzzySearch(
+		RTPCodecParameters{RTPCodecCapability: capability}, m.getCodecsByKind(typ),
+	)
+	if matchType == CodecMatchNone {
+		return 0, false
+	}
+
+	return codec.PayloadType, true
+}
+
+// RTXServesSimulcast returns true if the RTX codec repairing the video codec with
+// mediaPayloadType is used by every simulcast layer. Each layer is sent with its own
+// SSRC and RTX SSRC, but there is one RTX payload type per codec, the repaired RTP
+// stream ID tells the layers apart. This requires the RTP stream ID header extension
+// to be negotiated and an RTX codec for mediaPayloadType.
+func (m *MediaEngine) RTXServesSimulcast(mediaPayloadType PayloadType) bool {
+	codecs := m.getCodecsByKind(RTPCodecTypeVideo)
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if _, ok := m.negotiatedHeaderExtensionID(sdp.SDESRTPStreamIDURI, RTPCodecTypeVideo); !ok {
+		return false
+	}
+
+	return findRTXPayloadType(mediaPayloadType, codecs) != 0
+}
+
+// HeaderExtensionID returns the ID a header extension has been negotiated with for typ.
+// If the header extension hasn't been negotiated for typ ok will be false.
+func (m *MediaEngine) HeaderExtensionID(uri string, typ RTPCodecType) (id int, ok bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.negotiatedHeaderExtensionID(uri, typ)
+}
+
+// ConfigFingerprint returns a hash of the registered codecs and header extensions.
+// It doesn't depend on the order things were registered in, so MediaEngines
+// configured the same way have the same fingerprint.
+func (m *MediaEngine) ConfigFingerprint() string {
+	m.resolveLazyCodecs()
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	lines := []string{}
+	for _, kind := range []struct {
+		typ    RTPCodecType
+		codecs []RTPCodecParameters
+	}{
+		{RTPCodecTypeAudio, m.audioCodecs},
+		{RTPCodecTypeVideo, m.videoCodecs},
+	} {
+		for _, codec := range kind.codecs {
+			feedback := make([]string, 0, len(codec.RTCPFeedback))
+			for _, f := range codec.RTCPFeedback {
+				feedback = append(feedback, strings.ToLower(f.Type+" "+f.Parameter))
+			}
+			slices.Sort(feedback)
+
+			lines = append(lines, fmt.Sprintf("codec %s %d %s/%d/%d %s [%s]",
+				kind.typ, codec.PayloadType, strings.ToLower(codec.MimeType), codec.ClockRate, codec.Channels,
+				codec.SDPFmtpLine, strings.Join(feedback, ",")))
+		}
+	}
+
+	for _, extension := range m.headerExtensions {
+		directions := make([]string, 0, len(extension.allowedDirections))
+		for _, direction := range extension.allowedDirections {
+			directions = append(directions, direction.String())
+		}
+		slices.Sort(directions)
+
+		lines = append(lines, fmt.Sprintf("extension %s audio=%t video=%t [%s]",
+			extension.uri, extension.isAudio, extension.isVideo, strings.Join(directions, ",")))
+	}
+	slices.Sort(lines)
+
+	sum := sha256.Sum256([]byte(strings.Join(lines, "\n")))
+
+	return hex.EncodeToString(sum[:])
+}
+
+// copy copies any user modifiable state of the MediaEngine
+// all internal state is reset.
+func (m *MediaEngine) copy() *MediaEngine {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	cloned := &MediaEngine{
+		videoCodecs:               append([]RTPCodecParameters{}, m.videoCodecs...),
+		audioCodecs:               append([]RTPCodecParameters{}, m.audioCodecs...),
+		headerExtensions:          append([]mediaEngineHeaderExtension{}, m.headerExtensions...),
+		codecProvider:             m.codecProvider,
+		providedKinds:             slices.Clone(m.providedKinds),
+		lazyCodecs:                slices.Clone(m.lazyCodecs),
+		remoteCodecFilter:         m.remoteCodecFilter,
+		strictHeaderExtensions:    m.strictHeaderExtensions,
+		twoByteHeaderExtensionIDs: m.twoByteHeaderExtensionIDs,
+		honorRemoteCodecOrder:     m.honorRemoteCodecOrder,
+		maxNegotiatedCodecs:       m.maxNegotiatedCodecs,
+		minMatchType:              m.minMatchType,
+		requireUsableCodecs:       m.requireUsableCodecs,
+		svcLayers:                 maps.Clone(m.svcLayers),
+		codecMaxBitrates:          maps.Clone(m.codecMaxBitrates),
+		maxRIDLength:              m.maxRIDLength,
+		payloaderOptions:          maps.Clone(m.payloaderOptions),
+		seededPayloadTypes:        maps.Clone(m.seededPayloadTypes),
+		mimeAliases:               maps.Clone(m.mimeAliases),
+		disabledCodecs:            maps.Clone(m.disabledCodecs),
+		codecDirections:           maps.Clone(m.codecDirections),
+		codecTags:                 maps.Clone(m.codecTags),
+		offerTag:                  m.offerTag,
+		headerExtensionCodecs:     maps.Clone(m.headerExtensionCodecs),
+		fecCodecs:                 maps.Clone(m.fecCodecs),
+		maxHeaderExtensions:       maps.Clone(m.maxHeaderExtensions),
+		bwePolicy:                 m.bwePolicy,
+		pinnedFmtpParameters:      make(map[string]map[string]string, len(m.pinnedFmtpParameters)),
+		log:                       m.log,
+		now:                       m.now,
+		codecStatsIDs:             m.codecStatsIDs,
+
+		onHeaderExtensionNegotiated: m.onHeaderExtensionNegotiated,
+		onCodecMatch:                m.onCodecMatch,
+		registrationObservers:       slices.Clone(m.registrationObservers),
+	}
+	if len(m.headerExtensions) > 0 {
+		cloned.negotiatedHeaderExtensions = map[int]mediaEngineHeaderExtension{}
+	}
+	for mime, params := range m.pinnedFmtpParameters {
+		cloned.pinnedFmtpParameters[mime] = maps.Clone(params)
+	}
+	if m.receiveAlternatives != nil {
+		cloned.receiveAlternatives = make(map[payloadTypeKey][]string, len(m.receiveAlternatives))
+		for key, fmtpLines := range m.receiveAlternatives {
+			cloned.receiveAlternatives[key] = slices.Clone(fmtpLines)
+		}
+	}
+
+	return cloned
+}
+
+type mediaEngineJSON struct {
+	AudioCodecs          []codecJSON                  `json:"audioCodecs"`
+	VideoCodecs          []codecJSON                  `json:"videoCodecs"`
+	HeaderExtensions     []headerExtensionJSON        `json:"headerExtensions"`
+	DisabledAudioCodecs  []string                     `json:"disabledAudioCodecs,omitempty"`
+	DisabledVideoCodecs  []string                     `json:"disabledVideoCodecs,omitempty"`
+	PinnedFmtpParameters map[string]map[string]string `json:"pinnedFmtpParameters,omitempty"`
+}
+
+type codecJSON struct {
+	MimeType            string         `json:"mimeType"`
+	ClockRate           uint32         `json:"clockRate"`
+	Channels            uint16         `json:"channels,omitempty"`
+	SDPFmtpLine         string         `json:"sdpFmtpLine,omitempty"`
+	RTCPFeedback        []feedbackJSON `json:"rtcpFeedback,omitempty"`
+	PayloadType         PayloadType    `json:"payloadType"`
+	Name                string         `json:"name,omitempty"`
+	Tags                []string       `json:"tags,omitempty"`
+	Direction           string         `json:"direction,omitempty"`
+	ReceiveAlternatives []string       `json:"receiveAlternatives,omitempty"`
+}
+
+type feedbackJSON struct {
+	Type      string `json:"type"`
+	Parameter string `json:"parameter,omitempty"`
+}
+
+type headerExtensionJSON struct {
+	URI               string   `json:"uri"`
+	Audio             bool     `json:"audio,omitempty"`
+	Video             bool     `json:"video,omitempty"`
+	AllowedDirections []string `json:"allowedDirections"`
+}
+
+// MarshalJSON returns the JSON encoding of the registered codecs, including their
+// feedback, names, tags, directions and receive alternatives, the disabled codecs,
+// the pinned fmtp parameters and the registered header extensions. Negotiated state
+// and other configuration of the MediaEngine aren't encoded.
+func (m *MediaEngine) MarshalJSON() ([]byte, error) {
+	m.resolveLazyCodecs()
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	encodeCodecs := func(codecs []RTPCodecParameters, typ RTPCodecType) []codecJSON {
+		encoded := make([]codecJSON, 0, len(codecs))
+		for _, codec := range codecs {
+			feedback := make([]feedbackJSON, 0, len(codec.RTCPFeedback))
+			for _, f := range codec.RTCPFeedback {
+				feedback = append(feedback, feedbackJSON{Type: f.Type, Parameter: f.Parameter})
+			}
+			var direction string
+			if d, ok := m.codecDirections[payloadTypeKey{typ, codec.PayloadType}]; ok {
+				direction = d.String()
+			}
+			encoded = append(encoded, codecJSON{
+				MimeType:            codec.MimeType,
+				ClockRate:           codec.ClockRate,
+				Channels:            codec.Channels,
+				SDPFmtpLine:         codec.SDPFmtpLine,
+				RTCPFeedback:        feedback,
+				PayloadType:         codec.PayloadType,
+				Name:                codec.name,
+				Tags:                m.codecTags[payloadTypeKey{typ, codec.PayloadType}],
+				Direction:           direction,
+				ReceiveAlternatives: m.receiveAlternatives[payloadTypeKey{typ, codec.PayloadType}],
+			})
+		}
+
+		return encoded
+	}
+
+	encoded := mediaEngineJSON{
+		AudioCodecs:          encodeCodecs(m.audioCodecs, RTPCodecTypeAudio),
+		VideoCodecs:          encodeCodecs(m.videoCodecs, RTPCodecTypeVideo),
+		HeaderExtensions:     make([]headerExtensionJSON, 0, len(m.headerExtensions)),
+		PinnedFmtpParameters: m.pinnedFmtpParameters,
+	}
+	for key := range m.disabledCodecs {
+		if key.typ == RTPCodecTypeAudio {
+			encoded.DisabledAudioCodecs = append(encoded.DisabledAudioCodecs, key.mime)
+		} else {
+			encoded.DisabledVideoCodecs = append(encoded.DisabledVideoCodecs, key.mime)
+		}
+	}
+	slices.Sort(encoded.DisabledAudioCodecs)
+	slices.Sort(encoded.DisabledVideoCodecs)
+	for _, extension := range m.headerExtensions {
+		directions := make([]string, 0, len(extension.allowedDirections))
+		for _, direction := range extension.allowedDirections {
+			directions = append(directions, direction.String())
+		}
+		encoded.HeaderExtensions = append(encoded.HeaderExtensions, headerExtensionJSON{
+			URI:               extension.uri,
+			Audio:             extension.isAudio,
+			Video:             extension.isVideo,
+			AllowedDirections: directions,
+		})
+	}
+
+	return json.Marshal(encoded)
+}
+
+// UnmarshalJSON replaces the registered codecs, header extensions and the configuration
+// of codecs with the ones encoded by MarshalJSON. They are validated like by RegisterCodec,
+// SetCodecDirection and RegisterHeaderExtension, the MediaEngine is left unchanged if any
+// is invalid.
+func (m *MediaEngine) UnmarshalJSON(b []byte) error { //nolint:cyclop
+	var decoded mediaEngineJSON
+	if err := json.Unmarshal(b, &decoded); err != nil {
+		return err
+	}
+
+	registered := MediaEngine{now: m.now, codecStatsIDs: m.codecStatsIDs}
+	for _, kind := range []struct {
+		typ      RTPCodecType
+		codecs   []codecJSON
+		disabled []string
+	}{
+		{RTPCodecTypeAudio, decoded.AudioCodecs, decoded.DisabledAudioCodecs},
+		{RTPCodecTypeVideo, decoded.VideoCodecs, decoded.DisabledVideoCodecs},
+	} {
+		for _, codec := range kind.codecs {
+			var feedback []RTCPFeedback
+			for _, f := range codec.RTCPFeedback {
+				feedback = append(feedback, RTCPFeedback{Type: f.Type, Parameter: f.Parameter})
+			}
+			if err := registered.registerCodec(RTPCodecParameters{
+				RTPCodecCapability: RTPCodecCapability{
+					MimeType:     codec.MimeType,
+					ClockRate:    codec.ClockRate,
+					Channels:     codec.Channels,
+					SDPFmtpLine:  codec.SDPFmtpLine,
+					RTCPFeedback: feedback,
+				},
+				PayloadType: codec.PayloadType,
+				name:        codec.Name,
+			}, kind.typ); err != nil {
+				return err
+			}
+
+			if len(codec.Tags) > 0 {
+				if registered.codecTags == nil {
+					registered.codecTags = map[payloadTypeKey][]string{}
+				}
+				registered.codecTags[payloadTypeKey{kind.typ, codec.PayloadType}] = codec.Tags
+			}
+			if codec.Direction != "" {
+				if err := registered.SetCodecDirection(
+					codec.PayloadType, kind.typ, NewRTPTransceiverDirection(codec.Direction),
+				); err != nil {
+					return err
+				}
+			}
+			for _, fmtpLine := range codec.ReceiveAlternatives {
+				registered.AddReceiveAlternative(codec.PayloadType, kind.typ, fmtpLine)
+			}
+		}
+
+		for _, mime := range kind.disabled {
+			if registered.disabledCodecs == nil {
+				registered.disabledCodecs = map[codecKey]struct{}{}
+			}
+			registered.disabledCodecs[codecKey{kind.typ, strings.ToLower(mime)}] = struct{}{}
+		}
+	}
+	for mime, parameters := range decoded.PinnedFmtpParameters {
+		for key, value := range parameters {
+			registered.PinFmtpParameter(mime, key, value)
+		}
+	}
+
+	for _, extension := range decoded.HeaderExtensions {
+		directions := make([]RTPTransceiverDirection, 0, len(extension.AllowedDirections))
+		for _, direction := range extension.AllowedDirections {
+			directions = append(directions, NewRTPTransceiverDirection(direction))
+		}
+		for _, typ := range []RTPCodecType{RTPCodecTypeAudio, RTPCodecTypeVideo} {
+			if typ == RTPCodecTypeAudio && !extension.Audio || typ == RTPCodecTypeVideo && !extension.Video {
+				continue
+			}
+
+			if err := registered.registerHeaderExtension(
+				RTPHeaderExtensionCapability{URI: extension.URI}, typ, directions...,
+			); err != nil {
+				return err
+			}
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.audioCodecs, m.videoCodecs = registered.audioCodecs, registered.videoCodecs
+	m.codecStatsIDs = registered.codecStatsIDs
+	m.codecTags, m.codecDirections = registered.codecTags, registered.codecDirections
+	m.receiveAlternatives, m.disabledCodecs = registered.receiveAlternatives, registered.disabledCodecs
+	m.pinnedFmtpParameters = registered.pinnedFmtpParameters
+	m.headerExtensions = registered.headerExtensions
+	// The decoded codecs replace the ones RegisterCodecFunc would have generated
+	m.lazyCodecs = nil
+	if m.negotiatedHeaderExtensions == nil {
+		m.negotiatedHeaderExtensions = map[int]mediaEngineHeaderExtension{}
+	}
+
+	return nil
+}
+
+// Equal returns true if m and other have the same registered codecs, header extensions
+// and configuration of codecs, i.e. everything MarshalJSON encodes. Codecs and header
+// extensions registered in another order aren't equal, the order is their preference.
+func (m *MediaEngine) Equal(other *MediaEngine) bool {
+	encoded, err := m.MarshalJSON()
+	if err != nil {
+		return false
+	}
+	otherEncoded, err := other.MarshalJSON()
+	if err != nil {
+		return false
+	}
+
+	return bytes.Equal(encoded, otherEncoded)
+}
+
+// ResetNegotiation clears the state negotiated with a remote, while keeping all
+// registered codecs, header extensions and configuration. This allows reusing a
+// MediaEngine for a new PeerConnection. ResetNegotiation must not be called while
+// a PeerConnection using the MediaEngine is active.
+func (m *MediaEngine) ResetNegotiation() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.negotiatedVideo, m.negotiatedAudio = false, false
+	m.negotiatedReducedSizeRTCP = false
+	m.negotiatedVideoCodecs, m.negotiatedAudioCodecs = nil, nil
+	m.negotiatedMatchTypes = nil
+	m.negotiatedLocalCodecs = nil
+	m.remoteOpusDTX = nil
+	m.negotiationVersion++
+	m.unmatchedRemoteCodecs = nil
+	m.negotiationMetrics = NegotiationMetrics{}
+	m.negotiatedSections = nil
+	m.negotiatedBundleGroups = nil
+	m.rejectedKinds = nil
+	m.negotiatedCodecDirections = nil
+	m.negotiatedDirectionalCodecs = nil
+	m.negotiatedHeaderExtensions = nil
+	if len(m.headerExtensions) > 0 {
+		m.negotiatedHeaderExtensions = map[int]mediaEngineHeaderExtension{}
+	}
+}
+
+// NegotiationVersion returns a number that increases every time a remote description
+// is applied or the negotiation is reset. A remote description can map a payload
+// type to another codec than before, comparing the version a codec was looked up
+// with to the current one tells whether that lookup is still valid. The handover
+// happens at once: lookups racing with a remote description see either the old
+// or the new mapping, never a mix of both.
+func (m *MediaEngine) NegotiationVersion() uint64 {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.negotiationVersion
+}
+
+func findCodecByPayload(codecs []RTPCodecParameters, payloadType PayloadType) *RTPCodecParameters {
+	for _, codec := range codecs {
+		if codec.PayloadType == payloadType {
+			return &codec
+		}
+	}
+
+	return nil
+}
+
+func (m *MediaEngine) getCodecByPayload(payloadType PayloadType) (RTPCodecParameters, RTPCodecType, error) {
+	m.resolveLazyCodecs()
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	// if we've negotiated audio or video, check the negotiated types before our
+	// built-in payload types, to ensure we pick the codec the other side wants.
+	if m.negotiatedVideo {
+		if codec := findCodecByPayload(m.negotiatedVideoCodecs, payloadType); codec != nil {
+			return *codec, RTPCodecTypeVideo, nil
+		}
+	}
+	if m.negotiatedAudio {
+		if codec := findCodecByPayload(m.negotiatedAudioCodecs, payloadType); codec != nil {
+			return *codec, RTPCodecTypeAudio, nil
+		}
+	}
+	// Offers use the seeded payload types, look them up before the registered ones
+	if !m.negotiatedVideo {
+		if codec := findCodecByPayload(m.seedPayloadTypes(m.enabledCodecs(RTPCodecTypeVideo), RTPCodecTypeVideo),
+			payloadType); codec != nil {
+			return *codec, RTPCodecTypeVideo, nil
+		}
+		if codec := findCodecByPayload(m.videoCodecs, payloadType); codec != nil {
+			return *codec, RTPCodecTypeVideo, nil
+		}
+	}
+	if !m.negotiatedAudio {
+		if codec := findCodecByPayload(m.seedPayloadTypes(m.enabledCodecs(RTPCodecTypeAudio), RTPCodecTypeAudio),
+			payloadType); codec != nil {
+			return *codec, RTPCodecTypeAudio, nil
+		}
+		if codec := findCodecByPayload(m.audioCodecs, payloadType); codec != nil {
+			return *codec, RTPCodecTypeAudio, nil
+		}
+	}
+
+	return RTPCodecParameters{}, 0, ErrCodecNotFound
+}
+
+// RTXTime returns the rtx-time of the RTX codec with rtxPayloadType, the time
+// packets are kept available for retransmission, see RFC 4588 section 8.6.
+// ok is false if rtxPayloadType isn't an RTX codec or has no rtx-time.
+func (m *MediaEngine) RTXTime(rtxPayloadType PayloadType) (rtxTime time.Duration, ok bool) {
+	codec, _, err := m.getCodecByPayload(rtxPayloadType)
+	if err != nil || !strings.EqualFold(codec.MimeType, MimeTypeRTX) {
+		return 0, false
+	}
+
+	value, ok := fmtp.Parse(codec.MimeType, codec.ClockRate, codec.Channels, codec.SDPFmtpLine).Parameter("rtx-time")
+	if !ok {
+		return 0, false
+	}
+	milliseconds, err := strconv.ParseUint(value, 10, 32)
+	if err != nil {
+		return 0, false
+	}
+
+	return time.Duration(milliseconds) * time.Millisecond, true
+}
+
+// PLISupported returns true if the codec with payloadType uses the nack pli feedback,
+// so Picture Loss Indication may be sent for it. Once negotiated this requires both
+// peers to support it, some only support plain nack. RTCP senders should request
+// keyframes by other means, or not at all, if it's false.
+func (m *MediaEngine) PLISupported(payloadType PayloadType) bool {
+	codec, _, err := m.getCodecByPayload(payloadType)
+	if err != nil {
+		return false
+	}
+
+	return slices.ContainsFunc(codec.RTCPFeedback, func(feedback RTCPFeedback) bool {
+		return strings.EqualFold(feedback.Type, TypeRTCPFBNACK) && strings.EqualFold(feedback.Parameter, "pli")
+	})
+}
+
+// NegotiatedClockRate returns the clock rate of the negotiated codec of typ with payloadType,
+// which is the rate of the remote's rtpmap. It may differ from the registered clock
+// rate, codecs registered without one match the remote's rate. As with RTPClockRate
+// 8000 is returned for G722. It returns false if payloadType hasn't been negotiated for typ.
+func (m *MediaEngine) NegotiatedClockRate(payloadType PayloadType, typ RTPCodecType) (uint32, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	codecs := m.negotiatedVideoCodecs
+	if typ == RTPCodecTypeAudio {
+		codecs = m.negotiatedAudioCodecs
+	} else if typ != RTPCodecTypeVideo {
+		return 0, false
+	}
+
+	codec := findCodecByPayload(codecs, payloadType)
+	if codec == nil {
+		return 0, false
+	}
+	if strings.EqualFold(codec.MimeType, MimeTypeG722) {
+		return g722RTPClockRate, true
+	}
+
+	return codec.ClockRate, true
+}
+
+// OpusDTXNegotiated returns true if the remote asked for discontinuous transmission
+// with usedtx=1 for the preferred negotiated Opus codec, see RFC 7587 section 6.1.
+// The Opus encoder should enable DTX then. Our own usedtx only tells the remote
+// whether we prefer receiving DTX. It is false before audio has been negotiated.
+func (m *MediaEngine) OpusDTXNegotiated() bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if !m.negotiatedAudio {
+		return false
+	}
+
+	for _, codec := range m.negotiatedAudioCodecs {
+		if strings.EqualFold(codec.MimeType, MimeTypeOpus) {
+			return m.remoteOpusDTX[payloadTypeKey{RTPCodecTypeAudio, codec.PayloadType}]
+		}
+	}
+
+	return false
+}
+
+// recordRemoteOpusDTX remembers which of the remote codecs are Opus with usedtx=1.
+func (m *MediaEngine) recordRemoteOpusDTX(codecs []RTPCodecParameters, typ RTPCodecType) {
+	for _, codec := range codecs {
+		if !strings.EqualFold(codec.MimeType, MimeTypeOpus) {
+			continue
+		}
+
+		useDTX, _ := fmtp.Parse(codec.MimeType, codec.ClockRate, codec.Channels, codec.SDPFmtpLine).Parameter("usedtx")
+		if m.remoteOpusDTX == nil {
+			m.remoteOpusDTX = map[payloadTypeKey]bool{}
+		}
+		m.remoteOpusDTX[payloadTypeKey{typ, codec.PayloadType}] = useDTX == "1"
+	}
+}
+
+func (m *MediaEngine) collectStats(collector *statsReportCollector) {
+	m.resolveLazyCodecs()
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	statsLoop := func(codecs []RTPCodecParameters) {
+		for _, codec := range codecs {
+			collector.Collecting()
+			stats := CodecStats{
+				Timestamp:   statsTimestampFrom(m.clock()),
+				Type:        StatsTypeCodec,
+				ID:          codec.statsID,
+				PayloadType: codec.PayloadType,
+				MimeType:    codec.MimeType,
+				ClockRate:   codec.ClockRate,
+				Channels:    uint8(codec.Channels), //nolint:gosec // G115
+				SDPFmtpLine: codec.SDPFmtpLine,
+				Name:        codec.displayName(),
+			}
+			if apt, ok := rtxAssociatedPayloadType(codec); ok {
+				stats.AssociatedPayloadType = &apt
+			}
+
+			collector.Collect(stats.ID, stats)
+		}
+	}
+
+	statsLoop(m.videoCodecs)
+	statsLoop(m.audioCodecs)
+}
+
+// Look up a codec and enable if it exists.
+//
+//nolint:cyclop
+func (m *MediaEngine) matchRemoteCodec(
+	remoteCodec RTPCodecParameters,
+	typ RTPCodecType,
+	exactMatches, partialMatches []RTPCodecParameters,
+) (RTPCodecParameters, CodecMatchType, error) {
+	codecs := m.enabledCodecs(typ)
+
+	remoteFmtp := fmtp.Parse(
+		remoteCodec.RTPCodecCapability.MimeType,
+		remoteCodec.RTPCodecCapability.ClockRate,
+		remoteCodec.RTPCodecCapability.Channels,
+		remoteCodec.RTPCodecCapability.SDPFmtpLine)
+
+	if apt, hasApt := remoteFmtp.Parameter("apt"); hasApt { //nolint:nestif
+		payloadType, err := strconv.ParseUint(apt, 10, 8)
+		if err != nil {
+			return RTPCodecParameters{}, CodecMatchNone, &NegotiationError{
+				MediaIndex:     -1,
+				Kind:           typ,
+				PayloadType:    remoteCodec.PayloadType,
+				HasPayloadType: true,
+				Err:            fmt.Errorf("invalid apt %q: %w", apt, err),
+			}
+		}
+
+		aptMatch := CodecMatchNone
+		var aptCodec RTPCodecParameters
+		for _, codec := range exactMatches {
+			if codec.PayloadType == PayloadType(payloadType) {
+				aptMatch = CodecMatchExact
+				aptCodec = codec
+
+				break
+			}
+		}
+
+		if aptMatch == CodecMatchNone {
+			for _, codec := range partialMatches {
+				if codec.PayloadType == PayloadType(payloadType) {
+					aptMatch = CodecMatchPartial
+					aptCodec = codec
+
+					break
+				}
+			}
+		}
+
+		if aptMatch == CodecMatchNone {
+			return RTPCodecParameters{}, CodecMatchNone, nil // not an error, we just ignore this codec we don't support
+		}
+
+		// replace the apt value with the original codec's payload type
+		toMatchCodec := remoteCodec
+		if aptMatched, mt := codecParametersFuzzySearch(aptCodec, codecs); mt == aptMatch {
+			toMatchCodec.SDPFmtpLine = setFmtpParameter(
+				toMatchCodec.SDPFmtpLine, "apt", strconv.Itoa(int(aptMatched.PayloadType)),
+			)
+		}
+
+		// if apt's media codec is partial match, then apt codec must be partial match too.
+		localCodec, matchType := codecParametersFuzzySearch(toMatchCodec, codecs)
+		if matchType == CodecMatchExact && aptMatch == CodecMatchPartial {
+			matchType = CodecMatchPartial
+		}
+
+		return localCodec, matchType, nil
+	}
+
+	localCodec, matchType := codecParametersFuzzySearch(remoteCodec, codecs)
+	if matchType != CodecMatchExact {
+		if alternativeCodec, ok := m.matchReceiveAlternative(remoteCodec, typ, codecs); ok {
+			return alternativeCodec, CodecMatchExact, nil
+		}
+	}
+
+	return localCodec, matchType, nil
+}
+
+// matchReceiveAlternative looks for a codec in codecs, the registered codecs of typ,
+// with a receive alternative that exactly matches remoteCodec.
+func (m *MediaEngine) matchReceiveAlternative(
+	remoteCodec RTPCodecParameters,
+	typ RTPCodecType,
+	codecs []RTPCodecParameters,
+) (RTPCodecParameters, bool) {
+	for _, codec := range codecs {
+		for _, fmtpLine := range m.receiveAlternatives[payloadTypeKey{typ, codec.PayloadType}] {
+			alternative := codec
+			alternative.SDPFmtpLine = fmtpLine
+			if _, matchType := codecParametersFuzzySearch(
+				remoteCodec, []RTPCodecParameters{alternative},
+			); matchType == CodecMatchExact {
+				return codec, true
+			}
+		}
+	}
+
+	return RTPCodecParameters{}, false
+}
+
+// Update header extensions from a remote media section.
+func (m *MediaEngine) updateHeaderExtensionFromMediaSection(
+	media *sdp.MediaDescription,
+	typ RTPCodecType,
+	extensions map[string]int,
+) error {
+	if typ != RTPCodecTypeAudio && typ != RTPCodecTypeVideo {
+		return nil
+	}
+
+	extmapCount := 0
+	for _, attr := range media.Attributes {
+		if attr.Key == sdp.AttrKeyExtMap {
+			extmapCount++
+		}
+	}
+	if extmapCount > len(extensions) {
+		m.logger().Warnf("%s media section declares header extension URIs multiple times, using the lowest IDs", typ)
+	}
+
+	for extension, id := range extensions {
+		if m.strictHeaderExtensions && !m.headerExtensionRegistered(extension, typ) {
+			continue
+		}
+
+		if err := m.updateHeaderExtension(id, extension, typ); err != nil {
+			return &NegotiationError{MediaIndex: -1, Kind: typ, URI: extension, Err: err}
+		}
+	}
+
+	return nil
+}
+
+// negotiatedHeaderExtensionID returns the ID a header extension has been negotiated with for typ.
+func (m *MediaEngine) negotiatedHeaderExtensionID(uri string, typ RTPCodecType) (int, bool) {
+	for id, h := range m.negotiatedHeaderExtensions {
+		if h.uri == uri && h.hasKind(typ) {
+			return id, true
+		}
+	}
+
+	return 0, false
+}
+
+// Look up a header extension and enable if it exists.
+func (m *MediaEngine) updateHeaderExtension(id int, extension string, typ RTPCodecType) error {
+	if m.negotiatedHeaderExtensions == nil {
+		return nil
+	}
+
+	for _, localExtension := range m.headerExtensions {
+		if localExtension.uri == extension {
+			if existingID, ok := m.negotiatedHeaderExtensionID(extension, typ); ok && existingID != id {
+				m.logger().Warnf("header extension %s negotiated with IDs %d and %d, using the lowest", extension, existingID, id)
+				if existingID < id {
+					continue
+				}
+
+				// Move the kind over to the lower ID
+				existing := m.negotiatedHeaderExtensions[existingID]
+				if typ == RTPCodecTypeAudio {
+					existing.isAudio = false
+				} else {
+					existing.isVideo = false
+				}
+				if existing.isAudio || existing.isVideo {
+					m.negotiatedHeaderExtensions[existingID] = existing
+				} else {
+					delete(m.negotiatedHeaderExtensions, existingID)
+				}
+			}
+
+			h := mediaEngineHeaderExtension{uri: extension, allowedDirections: localExtension.allowedDirections}
+			if existingValue, ok := m.negotiatedHeaderExtensions[id]; ok {
+				h = existingValue
+			}
+
+			wasNegotiated := h.hasKind(typ)
+			switch {
+			case localExtension.isAudio && typ == RTPCodecTypeAudio:
+				h.isAudio = true
+			case localExtension.isVideo && typ == RTPCodecTypeVideo:
+				h.isVideo = true
+			}
+
+			m.negotiatedHeaderExtensions[id] = h
+
+			if !wasNegotiated && h.hasKind(typ) && m.onHeaderExtensionNegotiated != nil {
+				handler := m.onHeaderExtensionNegotiated
+				m.pendingCallbacks = append(m.pendingCallbacks, func() { handler(extension, id, typ) })
+			}
+		}
+	}
+
+	return nil
+}
+
+func (m *MediaEngine) pushCodecs(codecs []RTPCodecParameters, typ RTPCodecType, matchType CodecMatchType) error {
+	var negotiatedCodecs *[]RTPCodecParameters
+	switch typ {
+	case RTPCodecTypeAudio:
+		negotiatedCodecs = &m.negotiatedAudioCodecs
+	case RTPCodecTypeVideo:
+		negotiatedCodecs = &m.negotiatedVideoCodecs
+	default:
+		return nil
+	}
+
+	var joinedErr error
+	dropped := 0
+	duplicates := map[PayloadType]struct{}{}
+	for _, codec := range codecs {
+		if m.isDuplicateCodec(*negotiatedCodecs, codec, duplicates) {
+			m.logger().Debugf("ignoring payload type %d, it duplicates another negotiated %s codec",
+				codec.PayloadType, codec.MimeType)
+			duplicates[codec.PayloadType] = struct{}{}
+
+			continue
+		}
+
+		if m.maxNegotiatedCodecs > 0 && len(*negotiatedCodecs) >= m.maxNegotiatedCodecs &&
+			findCodecByPayload(*negotiatedCodecs, codec.PayloadType) == nil {
+			dropped++
+
+			continue
+		}
+
+		localCodec, _, _ := m.matchRemoteCodec(codec, typ, codecs, codecs)
+
+		params := m.pinnedFmtpParameters[strings.ToLower(codec.MimeType)]
+		for _, key := range slices.Sorted(maps.Keys(params)) {
+			codec.SDPFmtpLine = setFmtpParameter(codec.SDPFmtpLine, key, params[key])
+		}
+
+		// Each primary codec gets at most one RTX codec
+		if apt, isRTX := rtxAssociatedPayloadType(codec); isRTX {
+			if rtxPayloadType := findRTXPayloadType(apt, *negotiatedCodecs); rtxPayloadType != 0 &&
+				rtxPayloadType != codec.PayloadType {
+				m.logger().Debugf("ignoring RTX payload type %d, %d already repairs %d",
+					codec.PayloadType, rtxPayloadType, apt)
+
+				continue
+			}
+		}
+
+		// A payload type negotiated by an earlier remote description may now be used for another codec
+		_, pushed := m.pushedPayloadTypes[codec.PayloadType]
+		if i := slices.IndexFunc(*negotiatedCodecs, func(c RTPCodecParameters) bool {
+			return c.PayloadType == codec.PayloadType
+		}); i >= 0 && !pushed && !sameCodec((*negotiatedCodecs)[i], codec) && !codec.HasStaticPayloadType() {
+			(*negotiatedCodecs)[i] = codec
+			delete(m.negotiatedMatchTypes, payloadTypeKey{typ, codec.PayloadType})
+			delete(m.negotiatedLocalCodecs, payloadTypeKey{typ, codec.PayloadType})
+		}
+
+		var err error
+		if *negotiatedCodecs, err = m.addCodec(*negotiatedCodecs, codec); err != nil {
+			joinedErr = errors.Join(joinedErr, err)
+
+			continue
+		}
+		if m.pushedPayloadTypes != nil {
+			m.pushedPayloadTypes[codec.PayloadType] = struct{}{}
+		}
+
+		key := payloadTypeKey{typ, codec.PayloadType}
+		if _, ok := m.negotiatedMatchTypes[key]; !ok {
+			if m.negotiatedMatchTypes == nil {
+				m.negotiatedMatchTypes = map[payloadTypeKey]CodecMatchType{}
+			}
+			m.negotiatedMatchTypes[key] = matchType
+
+			if m.negotiatedLocalCodecs == nil {
+				m.negotiatedLocalCodecs = map[payloadTypeKey]RTPCodecCapability{}
+			}
+			m.negotiatedLocalCodecs[key] = localCodec.RTPCodecCapability
+		}
+	}
+
+	if dropped > 0 {
+		m.logger().Warnf("dropped %d %s codecs, at most %d codecs are negotiated", dropped, typ, m.maxNegotiatedCodecs)
+	}
+
+	return joinedErr
+}
+
+// isDuplicateCodec returns true if codec is negotiated already with another payload
+// type and the same fmtp line, e.g. Firefox may list H264 twice like this. RTX codecs
+// are duplicates if the codec they repair is one of duplicates. Multi codec
+// negotiation keeps all of them.
+func (m *MediaEngine) isDuplicateCodec(
+	negotiatedCodecs []RTPCodecParameters,
+	codec RTPCodecParameters,
+	duplicates map[PayloadType]struct{},
+) bool {
+	if m.negotiateMultiCodecs {
+		return false
+	}
+
+	if apt, isRTX := rtxAssociatedPayloadType(codec); isRTX {
+		_, ok := duplicates[apt]
+
+		return ok
+	}
+
+	return slices.ContainsFunc(negotiatedCodecs, func(c RTPCodecParameters) bool {
+		return c.PayloadType != codec.PayloadType && sameCodec(c, codec) && c.SDPFmtpLine == codec.SDPFmtpLine
+	})
+}
+
+// sortNegotiatedCodecs orders the negotiated codecs of typ like the remote codecs,
+// negotiated codecs the remote didn't offer keep their order at the end.
+func (m *MediaEngine) sortNegotiatedCodecs(remoteCodecs []RTPCodecParameters, typ RTPCodecType) {
+	negotiatedCodecs := m.negotiatedVideoCodecs
+	if typ == RTPCodecTypeAudio {
+		negotiatedCodecs = m.negotiatedAudioCodecs
+	}
+
+	remoteIndex := func(codec RTPCodecParameters) int {
+		if i := slices.IndexFunc(remoteCodecs, func(c RTPCodecParameters) bool {
+			return c.PayloadType == codec.PayloadType
+		}); i >= 0 {
+			return i
+		}
+
+		return len(remoteCodecs)
+	}
+
+	slices.SortStableFunc(negotiatedCodecs, func(a, b RTPCodecParameters) int {
+		return remoteIndex(a) - remoteIndex(b)
+	})
+}
+
+// matchRemoteCodecs matches the codecs of a remote media section against the local
+// codecs of typ. It does not modify the MediaEngine.
+func (m *MediaEngine) matchRemoteCodecs(
+	codecs []RTPCodecParameters,
+	typ RTPCodecType,
+) (exactMatches, partialMatches []RTPCodecParameters, err error) {
+	addIfNew := func(existingCodecs []RTPCodecParameters, codec RTPCodecParameters) []RTPCodecParameters {
+		found := false
+		for _, existingCodec := range existingCodecs {
+			if existingCodec.PayloadType == codec.PayloadType {
+				found = true
+
+				break
+			}
+		}
+
+		if !found {
+			existingCodecs = append(existingCodecs, codec)
+		}
+
+		return existingCodecs
+	}
+
+	codecs = m.applyMimeAliases(codecs)
+
+	exactMatches = make([]RTPCodecParameters, 0, len(codecs))
+	partialMatches = make([]RTPCodecParameters, 0, len(codecs))
+
+	// two passes, the second one catches RTX codecs listed before their primary codec
+	for range 2 {
+		for _, remoteCodec := range codecs {
+			localCodec, matchType, mErr := m.matchRemoteCodec(remoteCodec, typ, exactMatches, partialMatches)
+			if mErr != nil {
+				return nil, nil, mErr
+			}
+
+			remoteCodec.RTCPFeedback = rtcpFeedbackIntersection(localCodec.RTCPFeedback, remoteCodec.RTCPFeedback)
+			if matchType != CodecMatchNone {
+				remoteCodec.SDPFmtpLine = carryNonDiscriminatingParameters(localCodec, remoteCodec)
+			}
+
+			if matchType == CodecMatchExact {
+				exactMatches = addIfNew(exactMatches, remoteCodec)
+			} else if matchType == CodecMatchPartial {
+				partialMatches = addIfNew(partialMatches, remoteCodec)
+			}
+		}
+	}
+
+	return exactMatches, partialMatches, nil
+}
+
+// applyMimeAliases returns codecs with aliased MIME types replaced by their canonical
+// MIME type. codecs is copied before it is modified.
+func (m *MediaEngine) applyMimeAliases(codecs []RTPCodecParameters) []RTPCodecParameters {
+	if len(m.mimeAliases) == 0 {
+		return codecs
+	}
+
+	codecs = slices.Clone(codecs)
+	for i := range codecs {
+		if canonical, ok := m.mimeAliases[strings.ToLower(codecs[i].MimeType)]; ok {
+			codecs[i].MimeType = canonical
+		}
+	}
+
+	return codecs
+}
+
+// queueCodecMatchCallbacks queues a call of the OnCodecMatch handler for each remote codec.
+func (m *MediaEngine) queueCodecMatchCallbacks(
+	codecs, exactMatches, partialMatches []RTPCodecParameters,
+	typ RTPCodecType,
+) {
+	if m.onCodecMatch == nil {
+		return
+	}
+
+	handler := m.onCodecMatch
+	for i, aliasedCodec := range m.applyMimeAliases(codecs) {
+		localCodec, matchType, err := m.matchRemoteCodec(aliasedCodec, typ, exactMatches, partialMatches)
+		if err != nil || matchType == CodecMatchNone {
+			localCodec, matchType = RTPCodecParameters{}, CodecMatchNone
+		}
+
+		remoteCodec := codecs[i]
+		m.pendingCallbacks = append(m.pendingCallbacks, func() { handler(remoteCodec, localCodec, matchType) })
+	}
+}
+
+// carryNonDiscriminatingParameters returns the fmtp line of remoteCodec with the
+// values of localCodec for parameters that don't affect matching, e.g. max-fr,
+// so our receive limits end up in the negotiated codec.
+func carryNonDiscriminatingParameters(localCodec, remoteCodec RTPCodecParameters) string {
+	keys := fmtp.NonDiscriminatingParameters(remoteCodec.MimeType)
+	if len(keys) == 0 {
+		return remoteCodec.SDPFmtpLine
+	}
+
+	line := remoteCodec.SDPFmtpLine
+	local := fmtp.Parse(localCodec.MimeType, localCodec.ClockRate, localCodec.Channels, localCodec.SDPFmtpLine)
+	for _, key := range keys {
+		if value, ok := local.Parameter(key); ok {
+			line = setFmtpParameter(line, key, value)
+		}
+	}
+
+	return line
+}
+
+// recordUnmatchedRemoteCodecs remembers the remote codecs that are in neither match list.
+func (m *MediaEngine) recordUnmatchedRemoteCodecs(codecs, exactMatches, partialMatches []RTPCodecParameters) {
+	for _, codec := range codecs {
+		if findCodecByPayload(exactMatches, codec.PayloadType) != nil ||
+			findCodecByPayload(partialMatches, codec.PayloadType) != nil {
+			continue
+		}
+
+		if slices.ContainsFunc(m.unmatchedRemoteCodecs, func(c RTPCodecParameters) bool {
+			return c.PayloadType == codec.PayloadType && strings.EqualFold(c.MimeType, codec.MimeType)
+		}) {
+			continue
+		}
+
+		m.logger().Warnf("dropped remote codec %s with payload type %d, it doesn't match any registered codec",
+			codec.MimeType, codec.PayloadType)
+		m.unmatchedRemoteCodecs = append(m.unmatchedRemoteCodecs, codec)
+	}
+}
+
+// UnmatchedRemoteCodecs returns the codecs offered by the remote that didn't
+// match any registered codec, with the remote's payload type and fmtp line.
+// Codecs that matched but weren't negotiated, e.g. partial matches while
+// exact matches exist, aren't included.
+func (m *MediaEngine) UnmatchedRemoteCodecs() []RTPCodecParameters {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return slices.Clone(m.unmatchedRemoteCodecs)
+}
+
+// NegotiationMetrics counts how the codecs of remote descriptions matched the
+// registered codecs, see MediaEngine.NegotiationMetrics.
+type NegotiationMetrics struct {
+	// RemoteDescriptions is the number of remote descriptions applied.
+	RemoteDescriptions uint64
+	// ExactMatches is the number of remote codecs that matched a registered codec exactly.
+	ExactMatches uint64
+	// PartialMatches is the number of remote codecs that only matched the MIME type
+	// of a registered codec, they are counted even if exact matches were negotiated instead.
+	PartialMatches uint64
+	// DroppedCodecs is the number of remote codecs that didn't match any registered
+	// codec or were rejected by the remote codec filter.
+	DroppedCodecs uint64
+}
+
+// NegotiationMetrics returns the cumulative match counts of the remote descriptions
+// applied since the MediaEngine was created or ResetNegotiation was called. Codecs
+// are counted once for every audio and video media section listing them, including
+// sections that don't add codecs to the negotiated ones. Remote descriptions that
+// fail to apply aren't counted.
+func (m *MediaEngine) NegotiationMetrics() NegotiationMetrics {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.negotiationMetrics
+}
+
+// recordNegotiationMetrics adds how the codecs listed by the media section at mediaIndex
+// match the registered codecs of typ to metrics.
+func (m *MediaEngine) recordNegotiationMetrics(
+	metrics *NegotiationMetrics,
+	mediaIndex int,
+	media *sdp.MediaDescription,
+	typ RTPCodecType,
+) {
+	codecs, err := codecsFromMediaDescription(media)
+	if err != nil {
+		return
+	}
+
+	exactMatches, partialMatches, err := m.matchRemoteCodecs(
+		filterRemoteCodecs(slices.Clone(codecs), m.remoteCodecFilterRejections[mediaIndex]), typ,
+	)
+	if err != nil {
+		return
+	}
+
+	matched := len(exactMatches) + len(partialMatches)
+	metrics.ExactMatches += uint64(len(exactMatches))
+	metrics.PartialMatches += uint64(len(partialMatches))
+	if len(codecs) > matched {
+		metrics.DroppedCodecs += uint64(len(codecs) - matched)
+	}
+}
+
+// CompatibilityScore returns how well the codecs of desc match the codecs of the MediaEngine.
+// Every exactly matching codec adds 2 to the score and every partially matching codec adds 1.
+// Media sections that can't be parsed don't contribute. The MediaEngine is not modified.
+func (m *MediaEngine) CompatibilityScore(desc sdp.SessionDescription) int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	score := 0
+	for _, media := range desc.MediaDescriptions {
+		var typ RTPCodecType
+		switch {
+		case strings.EqualFold(media.MediaName.Media, "audio"):
+			typ = RTPCodecTypeAudio
+		case strings.EqualFold(media.MediaName.Media, "video"):
+			typ = RTPCodecTypeVideo
+		default:
+			continue
+		}
+
+		codecs, err := codecsFromMediaDescription(media)
+		if err != nil {
+			continue
+		}
+
+		exactMatches, partialMatches, err := m.matchRemoteCodecs(codecs, typ)
+		if err != nil {
+			continue
+		}
+
+		score += int(CodecMatchExact)*len(exactMatches) + int(CodecMatchPartial)*len(partialMatches)
+	}
+
+	return score
+}
+
+// PreflightRemoteDescription checks desc for problems that would make applying it
+// fail or leave a media section without codecs, without changing the MediaEngine.
+// All problems found are returned joined, each naming its media section.
+func (m *MediaEngine) PreflightRemoteDescription(desc sdp.SessionDescription) error {
+	rejections := m.runRemoteCodecFilter(desc)
+
+	m.resolveLazyCodecs()
+	for _, media := range desc.MediaDescriptions {
+		if !mediaSectionSkipped(media) {
+			m.resolveProvidedCodecs(NewRTPCodecType(media.MediaName.Media))
+		}
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var errs []error
+	for mediaIndex, media := range desc.MediaDescriptions {
+		typ := NewRTPCodecType(media.MediaName.Media)
+		if typ != RTPCodecTypeAudio && typ != RTPCodecTypeVideo {
+			continue
+		}
+
+		_, negotiated, err := parseRemoteMediaSection(media, typ)
+		if !negotiated {
+			continue
+		} else if err != nil {
+			errs = append(errs, negotiationErrorForMediaSection(mediaIndex, typ, err))
+
+			continue
+		}
+
+		codecs, err := codecsFromMediaDescription(media)
+		if err != nil {
+			errs = append(errs, negotiationErrorForMediaSection(mediaIndex, typ, err))
+
+			continue
+		}
+
+		exactMatches, partialMatches, err := m.matchRemoteCodecs(
+			filterRemoteCodecs(slices.Clone(codecs), rejections[mediaIndex]), typ,
+		)
+		switch {
+		case err != nil:
+			errs = append(errs, negotiationErrorForMediaSection(mediaIndex, typ, err))
+		case len(exactMatches) == 0 && len(partialMatches) == 0:
+			errs = append(errs, negotiationErrorForMediaSection(mediaIndex, typ,
+				fmt.Errorf("%w, remote offered %s", ErrNoCommonCodecs, strings.Join(codecNames(codecs), ", "))))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// codecNames returns the MIME types and payload types of codecs, e.g. "video/VP8 (96)".
+func codecNames(codecs []RTPCodecParameters) []string {
+	names := make([]string, 0, len(codecs))
+	for _, codec := range codecs {
+		names = append(names, fmt.Sprintf("%s (%d)", codec.MimeType, codec.PayloadType))
+	}
+
+	return names
+}
+
+// NegotiationError is returned, possibly wrapped or joined with others, when a remote
+// description can't be applied. It tells which media section, and if known which
+// codec or header extension of it, caused Err.
+type NegotiationError struct {
+	// Index of the media section in the remote description, -1 if the error isn't
+	// about a single media section.
+	MediaIndex int
+	Kind       RTPCodecType
+
+	// Payload type of the offending codec, only set if HasPayloadType is true.
+	PayloadType    PayloadType
+	HasPayloadType bool
+	// URI of the offending header extension, if any.
+	URI string
+
+	Err error
+}
+
+func (e *NegotiationError) Error() string {
+	var b strings.Builder
+	if e.MediaIndex >= 0 {
+		fmt.Fprintf(&b, "media section %d (%s)", e.MediaIndex, e.Kind)
+	} else {
+		b.WriteString(e.Kind.String())
+	}
+	if e.HasPayloadType {
+		fmt.Fprintf(&b, ": payload type %d", e.PayloadType)
+	}
+	if e.URI != "" {
+		fmt.Fprintf(&b, ": header extension %s", e.URI)
+	}
+	fmt.Fprintf(&b, ": %v", e.Err)
+
+	return b.String()
+}
+
+// Unwrap returns the cause of the error.
+func (e *NegotiationError) Unwrap() error {
+	return e.Err
+}
+
+// negotiationErrorForMediaSection returns err as a NegotiationError of the media section
+// with mediaIndex. A NegotiationError returned for a codec or header extension of the
+// section is completed with the section, other errors are wrapped.
+func negotiationErrorForMediaSection(mediaIndex int, typ RTPCodecType, err error) error {
+	var negotiationErr *NegotiationError
+	if errors.As(err, &negotiationErr) && negotiationErr.MediaIndex < 0 {
+		negotiationErr.MediaIndex, negotiationErr.Kind = mediaIndex, typ
+
+		return err
+	}
+
+	return &NegotiationError{MediaIndex: mediaIndex, Kind: typ, Err: err}
+}
+
+// Update the MediaEngine from a remote description.
+func (m *MediaEngine) updateFromRemoteDescription(desc sdp.SessionDescription) error {
+	rejections := m.runRemoteCodecFilter(desc)
+
+	m.mu.Lock()
+	defer m.unlockAndFireCallbacks()
+
+	m.remoteCodecFilterRejections = rejections
+	defer func() { m.remoteCodecFilterRejections = nil }()
+
+	m.resolveLazyCodecsLocked()
+
+	return m.updateFromRemoteDescriptionLocked(desc)
+}
+
+//nolint:cyclop
+func (m *MediaEngine) updateFromRemoteDescriptionLocked(desc sdp.SessionDescription) (err error) {
+	m.negotiationVersion++
+	m.pushedPayloadTypes = map[PayloadType]struct{}{}
+	defer func() { m.pushedPayloadTypes = nil }()
+
+	// Only remote descriptions that apply are counted
+	metrics := NegotiationMetrics{RemoteDescriptions: 1}
+	defer func() {
+		if err == nil {
+			m.negotiationMetrics.RemoteDescriptions += metrics.RemoteDescriptions
+			m.negotiationMetrics.ExactMatches += metrics.ExactMatches
+			m.negotiationMetrics.PartialMatches += metrics.PartialMatches
+			m.negotiationMetrics.DroppedCodecs += metrics.DroppedCodecs
+		}
+	}()
+
+	// Every remote description signals reduced-size RTCP anew
+	_, m.negotiatedReducedSizeRTCP = desc.Attribute(sdp.AttrKeyRTCPRsize)
+	m.negotiatedBundleGroups = bundleGroups(desc)
+	m.negotiatedCodecDirections = nil
+
+	m.rejectedKinds = nil
+	for mediaIndex, media := range desc.MediaDescriptions {
+		typ := NewRTPCodecType(media.MediaName.Media)
+		if mediaSectionRejected(media) && !slices.Contains(m.rejectedKinds, typ) {
+			m.rejectedKinds = append(m.rejectedKinds, typ)
+		}
+		extensions, negotiated, err := parseRemoteMediaSection(media, typ)
+		if !negotiated {
+			continue
+		}
+		if err == nil {
+			err = m.updateFromMediaSection(mediaIndex, media, typ, extensions)
+		}
+		if err != nil {
+			return negotiationErrorForMediaSection(mediaIndex, typ, err)
+		}
+
+		if typ == RTPCodecTypeAudio || typ == RTPCodecTypeVideo {
+			m.reconcileNegotiatedCodecs(mediaIndex, media, typ)
+			m.recordNegotiatedCodecDirections(media, typ)
+			m.recordNegotiationMetrics(&metrics, mediaIndex, media, typ)
+		}
+	}
+
+	m.removeUnusableTransportCCFeedback(RTPCodecTypeAudio)
+	m.removeUnusableTransportCCFeedback(RTPCodecTypeVideo)
+
+	if !m.requireUsableCodecs {
+		return nil
+	}
+
+	var errs []error
+	if m.negotiatedAudio && len(m.negotiatedAudioCodecs) == 0 {
+		errs = append(errs, &NegotiationError{MediaIndex: -1, Kind: RTPCodecTypeAudio, Err: ErrNoCommonCodecs})
+	}
+	if m.negotiatedVideo && len(m.negotiatedVideoCodecs) == 0 {
+		errs = append(errs, &NegotiationError{MediaIndex: -1, Kind: RTPCodecTypeVideo, Err: ErrNoCommonCodecs})
+	}
+
+	return errors.Join(errs...)
+}
+
+// parseRemoteMediaSection parses the header extensions of media, a section of a remote
+// description of kind typ. It returns false for sections that are skipped, both when
+// preflighting and when applying a remote description.
+func parseRemoteMediaSection(media *sdp.MediaDescription, typ RTPCodecType) (map[string]int, bool, error) {
+	if mediaSectionSkipped(media) {
+		return nil, false, nil
+	}
+	if typ != RTPCodecTypeAudio && typ != RTPCodecTypeVideo {
+		return nil, true, nil
+	}
+
+	extensions, err := rtpExtensionsFromMediaDescription(media)
+
+	return extensions, true, err
+}
+
+// mediaSectionSkipped returns true if media doesn't negotiate codecs or its kind. Codecs
+// of sections on hold aren't used, and rejected sections only list a placeholder format.
+func mediaSectionSkipped(media *sdp.MediaDescription) bool {
+	_, inactive := media.Attribute(sdp.AttrKeyInactive)
+
+	return inactive || mediaSectionRejected(media)
+}
+
+// mediaSectionRejected returns true if media has port zero. RFC 8843 Section 6 permits
+// bundle-only sections to use port zero, they aren't rejected.
+func mediaSectionRejected(media *sdp.MediaDescription) bool {
+	_, bundleOnly := media.Attribute("bundle-only")
+
+	return media.MediaName.Port.Value == 0 && !bundleOnly
+}
+
+// removeUnusableTransportCCFeedback removes the transport-cc feedback from the
+// negotiated codecs of typ if the transport-cc header extension wasn't negotiated
+// for typ, e.g. because no ID was left for it. The feedback depends on the
+// sequence numbers carried by the header extension.
+func (m *MediaEngine) removeUnusableTransportCCFeedback(typ RTPCodecType) {
+	negotiatedCodecs := m.negotiatedVideoCodecs
+	if typ == RTPCodecTypeAudio {
+		negotiatedCodecs = m.negotiatedAudioCodecs
+	}
+
+	for _, extension := range m.negotiatedHeaderExtensions {
+		if extension.uri == sdp.TransportCCURI && extension.hasKind(typ) {
+			return
+		}
+	}
+
+	isTransportCC := func(feedback RTCPFeedback) bool {
+		return feedback.Type == TypeRTCPFBTransportCC
+	}
+	for i, codec := range negotiatedCodecs {
+		if !slices.ContainsFunc(codec.RTCPFeedback, isTransportCC) {
+			continue
+		}
+
+		m.logger().Warnf("removed %s feedback of %s, the %s header extension wasn't negotiated",
+			TypeRTCPFBTransportCC, codec.MimeType, sdp.TransportCCURI)
+		negotiatedCodecs[i].RTCPFeedback = slices.DeleteFunc(slices.Clone(codec.RTCPFeedback), isTransportCC)
+	}
+}
+
+func (m *MediaEngine) updateFromMediaSection( //nolint:cyclop
+	mediaIndex int,
+	media *sdp.MediaDescription,
+	typ RTPCodecType,
+	extensions map[string]int,
+) error {
+	if _, ok := media.Attribute(sdp.AttrKeyRTCPRsize); ok && typ != RTPCodecTypeUnknown {
+		m.negotiatedReducedSizeRTCP = true
+	}
+
+	directionalOnly := false
+	switch {
+	case !m.negotiatedAudio && typ == RTPCodecTypeAudio:
+		m.negotiatedAudio = true
+	case !m.negotiatedVideo && typ == RTPCodecTypeVideo:
+		m.negotiatedVideo = true
+	default:
+		// update header extesions from remote sdp if codec is negotiated, Firefox
+		// would send updated header extension in renegotiation.
+		// e.g. publish first track without simucalst ->negotiated-> publish second track with simucalst
+		// then the two media secontions have different rtp header extensions in offer
+		if err := m.updateHeaderExtensionFromMediaSection(media, typ, extensions); err != nil {
+			return err
+		}
+
+		if typ != RTPCodecTypeAudio && typ != RTPCodecTypeVideo {
+			return nil
+		}
+
+		switch {
+		case m.negotiateMultiCodecs || m.remapsNegotiatedPayloadType(media, typ):
+		case m.isAsymmetricMediaSection(media, typ):
+			// A section of the opposite direction may add codecs used in that direction only
+			directionalOnly = true
+		default:
+			return nil
+		}
+	}
+
+	m.resolveProvidedCodecsLocked(typ)
+
+	codecs, err := codecsFromMediaDescription(media)
+	if err != nil {
+		return err
+	}
+	for _, codec := range codecs {
+		if _, rejected := m.remoteCodecFilterRejections[mediaIndex][codec.PayloadType]; rejected {
+			m.logger().Warnf("remote codec %s with payload type %d rejected by the remote codec filter",
+				codec.MimeType, codec.PayloadType)
+		}
+	}
+	codecs = filterRemoteCodecs(codecs, m.remoteCodecFilterRejections[mediaIndex])
+	m.recordRemoteOpusDTX(codecs, typ)
+
+	exactMatches, partialMatches, err := m.matchRemoteCodecs(codecs, typ)
+	if err != nil {
+		return err
+	}
+	m.recordUnmatchedRemoteCodecs(codecs, exactMatches, partialMatches)
+	m.queueCodecMatchCallbacks(codecs, exactMatches, partialMatches, typ)
+
+	// use exact matches when they exist, otherwise fall back to partial
+	matches, matchType := exactMatches, CodecMatchExact
+	switch {
+	case len(exactMatches) > 0:
+	case len(partialMatches) > 0 && m.minMatchType < CodecMatchExact:
+		matches, matchType = partialMatches, CodecMatchPartial
+	default:
+		// no match, not negotiated
+		return nil
+	}
+
+	if directionalOnly {
+		m.pushDirectionalCodecs(matches, typ)
+
+		return m.updateHeaderExtensionFromMediaSection(media, typ, extensions)
+	}
+	if err := m.pushCodecs(matches, typ, matchType); err != nil {
+		return err
+	}
+
+	if m.honorRemoteCodecOrder {
+		m.sortNegotiatedCodecs(codecs, typ)
+	}
+
+	return m.updateHeaderExtensionFromMediaSection(media, typ, extensions)
+}
+
+// remapsNegotiatedPayloadType returns true if media uses a payload type negotiated
+// by an earlier remote description for another codec.
+func (m *MediaEngine) remapsNegotiatedPayloadType(media *sdp.MediaDescription, typ RTPCodecType) bool {
+	negotiatedCodecs := m.negotiatedVideoCodecs
+	if typ == RTPCodecTypeAudio {
+		negotiatedCodecs = m.negotiatedAudioCodecs
+	}
+
+	codecs, err := codecsFromMediaDescription(media)
+	if err != nil {
+		return false
+	}
 
-				break
-			}
+	for _, codec := range m.applyMimeAliases(codecs) {
+		if _, pushed := m.pushedPayloadTypes[codec.PayloadType]; pushed || codec.HasStaticPayloadType() {
+			continue
 		}
+		if negotiated := findCodecByPayload(negotiatedCodecs, codec.PayloadType); negotiated != nil &&
+			!sameCodec(*negotiated, codec) {
+			return true
+		}
+	}
 
-		if aptMatch == codecMatchNone {
-			for _, codec := range partialMatches {
-				if codec.PayloadType == PayloadType(payloadType) {
-					aptMatch = codecMatchPartial
-					aptCodec = codec
+	return false
+}
 
-					break
-				}
-			}
-		}
+// reconcileNegotiatedCodecs removes the negotiated codecs of typ the remote
+// dropped from a media section it previously listed them in. Codecs still
+// listed by other media sections, including ones not part of this
+// description, are kept.
+func (m *MediaEngine) reconcileNegotiatedCodecs(mediaIndex int, media *sdp.MediaDescription, typ RTPCodecType) {
+	negotiatedCodecs := &m.negotiatedVideoCodecs
+	if typ == RTPCodecTypeAudio {
+		negotiatedCodecs = &m.negotiatedAudioCodecs
+	}
 
-		if aptMatch == codecMatchNone {
-			return RTPCodecParameters{}, codecMatchNone, nil // not an error, we just ignore this codec we don't support
-		}
+	section, ok := media.Attribute(sdp.AttrKeyMID)
+	if !ok {
+		section = strconv.Itoa(mediaIndex)
+	}
 
-		// replace the apt value with the original codec's payload type
-		toMatchCodec := remoteCodec
-		if aptMatched, mt := codecParametersFuzzySearch(aptCodec, codecs); mt == aptMatch {
-			toMatchCodec.SDPFmtpLine = strings.Replace(
-				toMatchCodec.SDPFmtpLine,
-				fmt.Sprintf("apt=%d", payloadType),
-				fmt.Sprintf("apt=%d", aptMatched.PayloadType),
-				1,
-			)
+	listed := make([]PayloadType, 0, len(media.MediaName.Formats))
+	for _, format := range media.MediaName.Formats {
+		if payloadType, err := strconv.ParseUint(format, 10, 8); err == nil {
+			listed = append(listed, PayloadType(payloadType))
 		}
+	}
 
-		// if apt's media codec is partial match, then apt codec must be partial match too.
-		localCodec, matchType := codecParametersFuzzySearch(toMatchCodec, codecs)
-		if matchType == codecMatchExact && aptMatch == codecMatchPartial {
-			matchType = codecMatchPartial
+	previous := m.negotiatedSections[section]
+	if m.negotiatedSections == nil {
+		m.negotiatedSections = map[string]negotiatedSection{}
+	}
+	current := negotiatedSection{typ: typ}
+	for _, codec := range *negotiatedCodecs {
+		if slices.Contains(listed, codec.PayloadType) {
+			current.payloadTypes = append(current.payloadTypes, codec.PayloadType)
 		}
-
-		return localCodec, matchType, nil
 	}
+	m.negotiatedSections[section] = current
 
-	localCodec, matchType := codecParametersFuzzySearch(remoteCodec, codecs)
+	if previous.typ != typ {
+		return
+	}
 
-	return localCodec, matchType, nil
-}
+	stillListed := func(payloadType PayloadType) bool {
+		for _, other := range m.negotiatedSections {
+			if other.typ == typ && slices.Contains(other.payloadTypes, payloadType) {
+				return true
+			}
+		}
 
-// Update header extensions from a remote media section.
-func (m *MediaEngine) updateHeaderExtensionFromMediaSection(media *sdp.MediaDescription) error {
-	var typ RTPCodecType
-	switch {
-	case strings.EqualFold(media.MediaName.Media, "audio"):
-		typ = RTPCodecTypeAudio
-	case strings.EqualFold(media.MediaName.Media, "video"):
-		typ = RTPCodecTypeVideo
-	default:
-		return nil
-	}
-	extensions, err := rtpExtensionsFromMediaDescription(media)
-	if err != nil {
-		return err
+		return false
 	}
 
-	for extension, id := range extensions {
-		if err = m.updateHeaderExtension(id, extension, typ); err != nil {
-			return err
+	removed := false
+	for _, payloadType := range previous.payloadTypes {
+		if stillListed(payloadType) {
+			continue
 		}
+
+		*negotiatedCodecs = slices.DeleteFunc(*negotiatedCodecs, func(c RTPCodecParameters) bool {
+			return c.PayloadType == payloadType
+		})
+		delete(m.negotiatedMatchTypes, payloadTypeKey{typ, payloadType})
+		delete(m.negotiatedLocalCodecs, payloadTypeKey{typ, payloadType})
+		removed = true
 	}
 
-	return nil
-}
+	// RTX codecs can't be used without their primary codec
+	if removed {
+		*negotiatedCodecs = slices.DeleteFunc(*negotiatedCodecs, func(c RTPCodecParameters) bool {
+			apt, isRTX := rtxAssociatedPayloadType(c)
 
-// Look up a header extension and enable if it exists.
-func (m *MediaEngine) updateHeaderExtension(id int, extension string, typ RTPCodecType) error {
-	if m.negotiatedHeaderExtensions == nil {
-		return nil
+			return isRTX && findCodecByPayload(*negotiatedCodecs, apt) == nil
+		})
 	}
+}
 
-	for _, localExtension := range m.headerExtensions {
-		if localExtension.uri == extension {
-			h := mediaEngineHeaderExtension{uri: extension, allowedDirections: localExtension.allowedDirections}
-			if existingValue, ok := m.negotiatedHeaderExtensions[id]; ok {
-				h = existingValue
-			}
+func (m *MediaEngine) getCodecsByKind(typ RTPCodecType) []RTPCodecParameters {
+	m.resolveLazyCodecs()
+	m.resolveProvidedCodecs(typ)
 
-			switch {
-			case localExtension.isAudio && typ == RTPCodecTypeAudio:
-				h.isAudio = true
-			case localExtension.isVideo && typ == RTPCodecTypeVideo:
-				h.isVideo = true
-			}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
 
-			m.negotiatedHeaderExtensions[id] = h
+	return m.codecsByKindLocked(typ)
+}
+
+func (m *MediaEngine) codecsByKindLocked(typ RTPCodecType) []RTPCodecParameters {
+	if typ == RTPCodecTypeVideo {
+		if m.negotiatedVideo {
+			return m.negotiatedVideoCodecs
+		}
+		if slices.Contains(m.rejectedKinds, typ) {
+			return nil
+		}
+
+		return m.seedPayloadTypes(m.enabledCodecs(typ), typ)
+	} else if typ == RTPCodecTypeAudio {
+		if m.negotiatedAudio {
+			return m.negotiatedAudioCodecs
 		}
+		if slices.Contains(m.rejectedKinds, typ) {
+			return nil
+		}
+
+		return m.seedPayloadTypes(m.enabledCodecs(typ), typ)
 	}
 
 	return nil
 }
 
-func (m *MediaEngine) pushCodecs(codecs []RTPCodecParameters, typ RTPCodecType) error {
-	var joinedErr error
+// HasUsableCodecs returns true if there are codecs of typ to send or receive with:
+// negotiated codecs once typ has been negotiated, registered codecs before.
+func (m *MediaEngine) HasUsableCodecs(typ RTPCodecType) bool {
+	return m.CodecCount(typ) > 0
+}
+
+// CodecTable returns the codecs of typ as offered, one line per codec sorted by payload
+// type, e.g. "96 VP8/90000" or "111 opus/48000/2 minptime=10;useinbandfec=1". It is
+// meant as a stable diff target for tests of the codec configuration.
+func (m *MediaEngine) CodecTable(typ RTPCodecType) string {
+	codecs := slices.SortedFunc(slices.Values(m.getCodecsByKind(typ)), func(a, b RTPCodecParameters) int {
+		return cmp.Compare(a.PayloadType, b.PayloadType)
+	})
+
+	var table strings.Builder
 	for _, codec := range codecs {
-		var err error
-		if typ == RTPCodecTypeAudio {
-			m.negotiatedAudioCodecs, err = m.addCodec(m.negotiatedAudioCodecs, codec)
-		} else if typ == RTPCodecTypeVideo {
-			m.negotiatedVideoCodecs, err = m.addCodec(m.negotiatedVideoCodecs, codec)
+		_, name, _ := strings.Cut(codec.MimeType, "/")
+		fmt.Fprintf(&table, "%d %s/%d", codec.PayloadType, name, codec.ClockRate)
+		if codec.Channels > 0 {
+			fmt.Fprintf(&table, "/%d", codec.Channels)
 		}
-		if err != nil {
-			joinedErr = errors.Join(joinedErr, err)
+		if codec.SDPFmtpLine != "" {
+			fmt.Fprintf(&table, " %s", codec.SDPFmtpLine)
 		}
+		table.WriteString("\n")
 	}
 
-	return joinedErr
+	return table.String()
 }
 
-// Update the MediaEngine from a remote description.
-func (m *MediaEngine) updateFromRemoteDescription(desc sdp.SessionDescription) error { //nolint:cyclop,gocognit
+// CodecCount returns the number of codecs of typ, the negotiated ones once typ has
+// been negotiated and the registered ones before.
+func (m *MediaEngine) CodecCount(typ RTPCodecType) int {
+	return len(m.getCodecsByKind(typ))
+}
+
+// SeedNegotiatedPayloadTypes makes offers use the given payload types for the registered
+// codecs, e.g. the payload types an earlier PeerConnection negotiated, so media can resume
+// with the same payload types after reconnecting. Keys are a MIME type, followed by a space
+// and the fmtp line if the codec has one, e.g. "video/VP8" or "video/VP9 profile-id=0".
+// A codec seeded with the payload type of another codec of its kind swaps payload types
+// with it, RTX codecs follow the codecs they repair. Seeds that collide with a codec of the
+// other kind are ignored. When answering, the payload types of the remote offer are used.
+// Methods configuring a codec by payload type, e.g. SetCodecDirection, take the payload
+// type it was registered with.
+func (m *MediaEngine) SeedNegotiatedPayloadTypes(payloadTypes map[string]PayloadType) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	for _, media := range desc.MediaDescriptions {
-		var typ RTPCodecType
+	m.seededPayloadTypes = maps.Clone(payloadTypes)
+}
 
-		switch {
-		case strings.EqualFold(media.MediaName.Media, "audio"):
-			typ = RTPCodecTypeAudio
-		case strings.EqualFold(media.MediaName.Media, "video"):
-			typ = RTPCodecTypeVideo
+// seededPayloadType returns the payload type codec has been seeded with.
+func (m *MediaEngine) seededPayloadType(codec RTPCodecCapability) (PayloadType, bool) {
+	for key, payloadType := range m.seededPayloadTypes {
+		mime, fmtpLine, _ := strings.Cut(key, " ")
+		if strings.EqualFold(mime, codec.MimeType) &&
+			FmtpEqual(codec.MimeType, codec.ClockRate, codec.Channels, fmtpLine, codec.SDPFmtpLine) {
+			return payloadType, true
 		}
+	}
 
-		switch {
-		case !m.negotiatedAudio && typ == RTPCodecTypeAudio:
-			m.negotiatedAudio = true
-		case !m.negotiatedVideo && typ == RTPCodecTypeVideo:
-			m.negotiatedVideo = true
-		default:
-			// update header extesions from remote sdp if codec is negotiated, Firefox
-			// would send updated header extension in renegotiation.
-			// e.g. publish first track without simucalst ->negotiated-> publish second track with simucalst
-			// then the two media secontions have different rtp header extensions in offer
-			if err := m.updateHeaderExtensionFromMediaSection(media); err != nil {
-				return err
-			}
+	return 0, false
+}
 
-			if !m.negotiateMultiCodecs || (typ != RTPCodecTypeAudio && typ != RTPCodecTypeVideo) {
-				continue
-			}
-		}
+// seedPayloadTypes returns codecs of typ with their seeded payload types. codecs isn't modified.
+func (m *MediaEngine) seedPayloadTypes(codecs []RTPCodecParameters, typ RTPCodecType) []RTPCodecParameters {
+	if len(m.seededPayloadTypes) == 0 {
+		return codecs
+	}
 
-		codecs, err := codecsFromMediaDescription(media)
-		if err != nil {
-			return err
-		}
+	otherCodecs := m.audioCodecs
+	if typ == RTPCodecTypeAudio {
+		otherCodecs = m.videoCodecs
+	}
+	isRTX := func(codec RTPCodecParameters) bool {
+		_, ok := rtxAssociatedPayloadType(codec)
 
-		addIfNew := func(existingCodecs []RTPCodecParameters, codec RTPCodecParameters) []RTPCodecParameters {
-			found := false
-			for _, existingCodec := range existingCodecs {
-				if existingCodec.PayloadType == codec.PayloadType {
-					found = true
+		return ok
+	}
 
-					break
-				}
+	seeded := slices.Clone(codecs)
+	pinned := map[PayloadType]struct{}{}
+	seed := func(rtx bool) {
+		for i := range seeded {
+			if isRTX(seeded[i]) != rtx {
+				continue
+			}
+			payloadType, ok := m.seededPayloadType(seeded[i].RTPCodecCapability)
+			if _, taken := pinned[payloadType]; !ok || taken || findCodecByPayload(otherCodecs, payloadType) != nil {
+				continue
 			}
 
-			if !found {
-				existingCodecs = append(existingCodecs, codec)
+			// RTX codecs are seeded last, they may only displace other RTX codecs
+			occupant := slices.IndexFunc(seeded, func(codec RTPCodecParameters) bool {
+				return codec.PayloadType == payloadType
+			})
+			if occupant != -1 {
+				if rtx && !isRTX(seeded[occupant]) {
+					continue
+				}
+				seeded[occupant].PayloadType = seeded[i].PayloadType
 			}
+			seeded[i].PayloadType = payloadType
+			pinned[payloadType] = struct{}{}
+		}
+	}
 
-			return existingCodecs
+	seed(false)
+	for i := range seeded {
+		apt, ok := rtxAssociatedPayloadType(seeded[i])
+		if !ok {
+			continue
+		}
+		if primary := slices.IndexFunc(codecs, func(codec RTPCodecParameters) bool {
+			return codec.PayloadType == apt
+		}); primary != -1 {
+			seeded[i].SDPFmtpLine = setFmtpParameter(
+				seeded[i].SDPFmtpLine, "apt", strconv.Itoa(int(seeded[primary].PayloadType)),
+			)
 		}
+	}
+	seed(true)
 
-		exactMatches := make([]RTPCodecParameters, 0, len(codecs))
-		partialMatches := make([]RTPCodecParameters, 0, len(codecs))
+	return seeded
+}
 
-		for _, remoteCodec := range codecs {
-			localCodec, matchType, mErr := m.matchRemoteCodec(remoteCodec, typ, exactMatches, partialMatches)
-			if mErr != nil {
-				return mErr
-			}
+// registeredPayloadType returns the payload type the offered codec of typ with payloadType
+// was registered with, the codec may have been seeded with another one.
+func (m *MediaEngine) registeredPayloadType(payloadType PayloadType, typ RTPCodecType) PayloadType {
+	if len(m.seededPayloadTypes) == 0 {
+		return payloadType
+	}
 
-			remoteCodec.RTCPFeedback = rtcpFeedbackIntersection(localCodec.RTCPFeedback, remoteCodec.RTCPFeedback)
+	enabled := m.enabledCodecs(typ)
+	if i := slices.IndexFunc(m.seedPayloadTypes(enabled, typ), func(codec RTPCodecParameters) bool {
+		return codec.PayloadType == payloadType
+	}); i != -1 {
+		return enabled[i].PayloadType
+	}
 
-			if matchType == codecMatchExact {
-				exactMatches = addIfNew(exactMatches, remoteCodec)
-			} else if matchType == codecMatchPartial {
-				partialMatches = addIfNew(partialMatches, remoteCodec)
-			}
+	return payloadType
+}
+
+// enabledCodecs returns the registered codecs of typ that haven't been disabled,
+// RTX codecs of disabled codecs are left out as well.
+func (m *MediaEngine) enabledCodecs(typ RTPCodecType) []RTPCodecParameters {
+	codecs := m.videoCodecs
+	if typ == RTPCodecTypeAudio {
+		codecs = m.audioCodecs
+	}
+	if len(m.disabledCodecs) == 0 && m.offerTag == "" {
+		return codecs
+	}
+
+	enabled := make([]RTPCodecParameters, 0, len(codecs))
+	for _, codec := range codecs {
+		if !m.codecDisabled(codec, codecs, typ) && (m.offerTag == "" || m.codecHasTag(codec, codecs, typ, m.offerTag)) {
+			enabled = append(enabled, codec)
 		}
-		// second pass in case there were missed RTX codecs
-		for _, remoteCodec := range codecs {
-			localCodec, matchType, mErr := m.matchRemoteCodec(remoteCodec, typ, exactMatches, partialMatches)
-			if mErr != nil {
-				return mErr
-			}
+	}
 
-			remoteCodec.RTCPFeedback = rtcpFeedbackIntersection(localCodec.RTCPFeedback, remoteCodec.RTCPFeedback)
+	return enabled
+}
 
-			if matchType == codecMatchExact {
-				exactMatches = addIfNew(exactMatches, remoteCodec)
-			} else if matchType == codecMatchPartial {
-				partialMatches = addIfNew(partialMatches, remoteCodec)
+// codecDisabled returns true if codec, or the primary codec in codecs it repairs, has been disabled.
+func (m *MediaEngine) codecDisabled(codec RTPCodecParameters, codecs []RTPCodecParameters, typ RTPCodecType) bool {
+	if len(m.disabledCodecs) == 0 {
+		return false
+	}
+
+	// Compare with EqualFold instead of a lookup, lowercasing the MIME type allocates
+	mimeDisabled := func(mime string) bool {
+		for key := range m.disabledCodecs {
+			if key.typ == typ && strings.EqualFold(key.mime, mime) {
+				return true
 			}
 		}
 
-		// use exact matches when they exist, otherwise fall back to partial
-		switch {
-		case len(exactMatches) > 0:
-			err = m.pushCodecs(exactMatches, typ)
-		case len(partialMatches) > 0:
-			err = m.pushCodecs(partialMatches, typ)
-		default:
-			// no match, not negotiated
-			continue
-		}
-		if err != nil {
-			return err
-		}
+		return false
+	}
 
-		if err := m.updateHeaderExtensionFromMediaSection(media); err != nil {
-			return err
+	if mimeDisabled(codec.MimeType) {
+		return true
+	}
+
+	if apt, ok := rtxAssociatedPayloadType(codec); ok {
+		if i := slices.IndexFunc(codecs, func(c RTPCodecParameters) bool { return c.PayloadType == apt }); i >= 0 {
+			return mimeDisabled(codecs[i].MimeType)
 		}
 	}
 
-	return nil
+	return false
 }
 
-func (m *MediaEngine) getCodecsByKind(typ RTPCodecType) []RTPCodecParameters {
+// RangeCodecs calls f for every codec of typ, in order, until f returns false.
+// These are the codecs offered or answered with: the negotiated codecs once typ
+// has been negotiated, the enabled registered codecs with their seeded payload
+// types otherwise. Unlike copying the codecs into a slice this doesn't allocate
+// once typ is negotiated. f is called with the MediaEngine locked for reading, it
+// must not call into the MediaEngine.
+func (m *MediaEngine) RangeCodecs(typ RTPCodecType, f func(RTPCodecParameters) bool) {
+	m.resolveLazyCodecs()
+	m.resolveProvidedCodecs(typ)
+
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
-	if typ == RTPCodecTypeVideo {
-		if m.negotiatedVideo {
-			return m.negotiatedVideoCodecs
-		}
-
-		return m.videoCodecs
-	} else if typ == RTPCodecTypeAudio {
-		if m.negotiatedAudio {
-			return m.negotiatedAudioCodecs
+	for _, codec := range m.codecsByKindLocked(typ) {
+		if !f(codec) {
+			return
 		}
-
-		return m.audioCodecs
 	}
-
-	return nil
 }
 
 //nolint:gocognit,cyclop
 func (m *MediaEngine) getRTPParametersByKind(typ RTPCodecType, directions []RTPTransceiverDirection) RTPParameters {
 	headerExtensions := make([]RTPHeaderExtensionParameter, 0)
 
+	// Header extensions are registered per half, sendrecv needs both of them
+	if slices.Contains(directions, RTPTransceiverDirectionSendrecv) {
+		directions = []RTPTransceiverDirection{RTPTransceiverDirectionSendonly, RTPTransceiverDirectionRecvonly}
+	}
+
 	// perform before locking to prevent recursive RLocks
 	foundCodecs := m.getCodecsByKind(typ)
 
@@ -753,6 +4025,11 @@ func (m *MediaEngine) getRTPParametersByKind(typ RTPCodecType, directions []RTPT
 			}
 		}
 	} else {
+		// Once the one-byte IDs are used up two-byte IDs are assigned if enabled, offers allow mixing them
+		maxID := maxHeaderExtensionID
+		if m.twoByteHeaderExtensionIDs {
+			maxID = maxTwoByteHeaderExtensionID
+		}
 		mediaHeaderExtensions := make(map[int]mediaEngineHeaderExtension)
 		for _, ext := range m.headerExtensions {
 			usingNegotiatedID := false
@@ -765,7 +4042,7 @@ func (m *MediaEngine) getRTPParametersByKind(typ RTPCodecType, directions []RTPT
 				}
 			}
 			if !usingNegotiatedID {
-				for id := 1; id < 15; id++ {
+				for id := minHeaderExtensionID; id <= maxID; id++ {
 					idAvailable := true
 					if _, ok := mediaHeaderExtensions[id]; ok {
 						idAvailable = false
@@ -787,12 +4064,36 @@ func (m *MediaEngine) getRTPParametersByKind(typ RTPCodecType, directions []RTPT
 		}
 	}
 
+	foundCodecs = m.filterRestrictedFECLocked(foundCodecs)
+	headerExtensions = slices.DeleteFunc(headerExtensions, func(h RTPHeaderExtensionParameter) bool {
+		return !m.headerExtensionUsable(h.URI, foundCodecs)
+	})
+	headerExtensions = m.applyBWEPolicy(headerExtensions)
+
+	if limit, ok := m.maxHeaderExtensions[typ]; ok && len(headerExtensions) > limit {
+		slices.SortFunc(headerExtensions, func(a, b RTPHeaderExtensionParameter) int {
+			return cmp.Compare(m.headerExtensionIndex(a.URI), m.headerExtensionIndex(b.URI))
+		})
+		headerExtensions = headerExtensions[:limit]
+	}
+	sortHeaderExtensionsByID(headerExtensions)
+
 	return RTPParameters{
 		HeaderExtensions: headerExtensions,
 		Codecs:           foundCodecs,
 	}
 }
 
+// headerExtensionIndex returns the position of the header extension with uri in
+// registration order, header extensions that aren't registered sort last.
+func (m *MediaEngine) headerExtensionIndex(uri string) int {
+	if i := slices.IndexFunc(m.headerExtensions, func(e mediaEngineHeaderExtension) bool { return e.uri == uri }); i >= 0 {
+		return i
+	}
+
+	return len(m.headerExtensions)
+}
+
 func (m *MediaEngine) getRTPParametersByPayloadType(payloadType PayloadType) (RTPParameters, error) {
 	codec, typ, err := m.getCodecByPayload(payloadType)
 	if err != nil {
@@ -803,28 +4104,98 @@ func (m *MediaEngine) getRTPParametersByPayloadType(payloadType PayloadType) (RT
 	defer m.mu.RUnlock()
 	headerExtensions := make([]RTPHeaderExtensionParameter, 0)
 	for id, e := range m.negotiatedHeaderExtensions {
-		if e.isAudio && typ == RTPCodecTypeAudio || e.isVideo && typ == RTPCodecTypeVideo {
+		if (e.isAudio && typ == RTPCodecTypeAudio || e.isVideo && typ == RTPCodecTypeVideo) &&
+			m.headerExtensionUsable(e.uri, []RTPCodecParameters{codec}) {
 			headerExtensions = append(headerExtensions, RTPHeaderExtensionParameter{ID: id, URI: e.uri})
 		}
 	}
 
+	headerExtensions = m.applyBWEPolicy(headerExtensions)
+	sortHeaderExtensionsByID(headerExtensions)
+
 	return RTPParameters{
 		HeaderExtensions: headerExtensions,
 		Codecs:           []RTPCodecParameters{codec},
 	}, nil
 }
 
+// sortHeaderExtensionsByID sorts headerExtensions by ascending ID. They are collected
+// from maps, sorting keeps the generated descriptions stable.
+func sortHeaderExtensionsByID(headerExtensions []RTPHeaderExtensionParameter) {
+	slices.SortFunc(headerExtensions, func(a, b RTPHeaderExtensionParameter) int {
+		return cmp.Compare(a.ID, b.ID)
+	})
+}
+
+// applyBWEPolicy removes the bandwidth estimation header extension the BWEPolicy
+// doesn't prefer from headerExtensions, if the preferred one is in there as well.
+func (m *MediaEngine) applyBWEPolicy(headerExtensions []RTPHeaderExtensionParameter) []RTPHeaderExtensionParameter {
+	var preferred, dropped string
+	switch m.bwePolicy {
+	case BWEPolicyPreferTransportCC:
+		preferred, dropped = sdp.TransportCCURI, sdp.ABSSendTimeURI
+	case BWEPolicyPreferAbsSendTime:
+		preferred, dropped = sdp.ABSSendTimeURI, sdp.TransportCCURI
+	default:
+		return headerExtensions
+	}
+
+	if !slices.ContainsFunc(headerExtensions, func(h RTPHeaderExtensionParameter) bool { return h.URI == preferred }) {
+		return headerExtensions
+	}
+
+	return slices.DeleteFunc(headerExtensions, func(h RTPHeaderExtensionParameter) bool { return h.URI == dropped })
+}
+
+// PayloaderOptions changes how the payloader of a codec packetizes media, e.g. for
+// legacy receivers that mishandle parts of the payload format. The zero value keeps
+// the defaults. See MediaEngine.SetPayloaderOptions.
+type PayloaderOptions struct {
+	// DisablePictureID leaves the picture ID out of VP8 payload descriptors.
+	DisablePictureID bool
+	// DisableAggregation sends every H264 and H265 NAL unit in packets of its own,
+	// rather than aggregating small ones, e.g. SPS and PPS, into STAP-A or AP packets.
+	DisableAggregation bool
+}
+
+// SetPayloaderOptions sets the options of the payloader used by TrackLocalStaticSample
+// for the codec with the given MIME type, once a track is bound to a RTPSender of a
+// PeerConnection using the MediaEngine. Tracks with their own payloader, see
+// WithPayloader, are not affected.
+func (m *MediaEngine) SetPayloaderOptions(mime string, opts PayloaderOptions) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.payloaderOptions == nil {
+		m.payloaderOptions = map[string]PayloaderOptions{}
+	}
+	m.payloaderOptions[strings.ToLower(mime)] = opts
+}
+
+// newPayloader returns the payloader for codec with the options set by SetPayloaderOptions.
+func (m *MediaEngine) newPayloader(codec RTPCodecCapability) (rtp.Payloader, error) {
+	m.mu.RLock()
+	opts := m.payloaderOptions[strings.ToLower(codec.MimeType)]
+	m.mu.RUnlock()
+
+	return payloaderWithOptions(codec, opts)
+}
+
 func payloaderForCodec(codec RTPCodecCapability) (rtp.Payloader, error) {
+	return payloaderWithOptions(codec, PayloaderOptions{})
+}
+
+func payloaderWithOptions(codec RTPCodecCapability, opts PayloaderOptions) (rtp.Payloader, error) {
 	switch strings.ToLower(codec.MimeType) {
 	case strings.ToLower(MimeTypeH264):
-		return &codecs.H264Payloader{}, nil
+		return &codecs.H264Payloader{DisableStapA: opts.DisableAggregation}, nil
 	case strings.ToLower(MimeTypeH265):
-		return &codecs.H265Payloader{}, nil
-	case strings.ToLower(MimeTypeOpus):
+		return &codecs.H265Payloader{SkipAggregation: opts.DisableAggregation}, nil
+	case strings.ToLower(MimeTypeOpus), strings.ToLower(MimeTypeMultiopus):
 		return &codecs.OpusPayloader{}, nil
 	case strings.ToLower(MimeTypeVP8):
 		return &codecs.VP8Payloader{
-			EnablePictureID: true,
+			EnablePictureID: !opts.DisablePictureID,
 		}, nil
 	case strings.ToLower(MimeTypeVP9):
 		return &codecs.VP9Payloader{}, nil
@@ -835,8 +4206,94 @@ func payloaderForCodec(codec RTPCodecCapability) (rtp.Payloader, error) {
 	case strings.ToLower(MimeTypePCMU), strings.ToLower(MimeTypePCMA):
 		return &codecs.G711Payloader{}, nil
 	default:
-		return nil, ErrNoPayloaderForCodec
+		return nil, fmt.Errorf("%w: %s", ErrNoPayloaderForCodec, codec.MimeType)
+	}
+}
+
+// RestrictFECToCodecs makes FEC codecs with the MIME type fecMime only be offered
+// and answered alongside a media codec with one of the MIME types mediaMimes, e.g.
+// FlexFEC for AV1 screen shares but not for VP8 camera video. Passing no media
+// MIME types lifts the restriction.
+func (m *MediaEngine) RestrictFECToCodecs(fecMime string, mediaMimes []string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if len(mediaMimes) == 0 {
+		delete(m.fecCodecs, strings.ToLower(fecMime))
+
+		return
+	}
+
+	if m.fecCodecs == nil {
+		m.fecCodecs = map[string][]string{}
+	}
+	m.fecCodecs[strings.ToLower(fecMime)] = slices.Clone(mediaMimes)
+}
+
+// filterRestrictedFEC returns codecs without the FEC codecs that are restricted
+// to media codecs none of which are in codecs.
+func (m *MediaEngine) filterRestrictedFEC(codecs []RTPCodecParameters) []RTPCodecParameters {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.filterRestrictedFECLocked(codecs)
+}
+
+// filterRestrictedFECLocked is filterRestrictedFEC for callers holding mu. codecs
+// is copied before it is modified.
+func (m *MediaEngine) filterRestrictedFECLocked(codecs []RTPCodecParameters) []RTPCodecParameters {
+	if len(m.fecCodecs) == 0 {
+		return codecs
 	}
+
+	unprotected := func(codec RTPCodecParameters) bool {
+		mediaMimes, restricted := m.fecCodecs[strings.ToLower(codec.MimeType)]
+
+		return restricted && !slices.ContainsFunc(codecs, func(c RTPCodecParameters) bool {
+			return slices.ContainsFunc(mediaMimes, func(mime string) bool { return strings.EqualFold(mime, c.MimeType) })
+		})
+	}
+	if !slices.ContainsFunc(codecs, unprotected) {
+		return codecs
+	}
+
+	return slices.DeleteFunc(slices.Clone(codecs), unprotected)
+}
+
+// ResilienceCaps reports the retransmission and forward error correction schemes
+// registered for a kind.
+type ResilienceCaps struct {
+	RTX     bool
+	FlexFEC bool
+	UlpFEC  bool
+	RED     bool
+}
+
+// ResilienceCapabilities returns the resilience schemes registered for typ. This
+// is a capability query, it looks at the enabled registered codecs and not at
+// the negotiated ones.
+func (m *MediaEngine) ResilienceCapabilities(typ RTPCodecType) ResilienceCaps {
+	m.resolveLazyCodecs()
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	caps := ResilienceCaps{}
+	for _, codec := range m.enabledCodecs(typ) {
+		_, subtype, _ := strings.Cut(codec.MimeType, "/")
+		switch strings.ToLower(subtype) {
+		case "rtx":
+			caps.RTX = true
+		case "flexfec", "flexfec-03":
+			caps.FlexFEC = true
+		case "ulpfec":
+			caps.UlpFEC = true
+		case "red":
+			caps.RED = true
+		}
+	}
+
+	return caps
 }
 
 func (m *MediaEngine) isRTXEnabled(typ RTPCodecType, directions []RTPTransceiverDirection) bool {
@@ -6,16 +6,48 @@
 package webrtc
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
 	"regexp"
+	"slices"
+	"strconv"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/pion/logging"
+	"github.com/pion/rtp/codecs"
 	"github.com/pion/sdp/v3"
 	"github.com/pion/transport/v4/test"
 	"github.com/stretchr/testify/assert"
 )
 
+// sdpHeader starts the remote descriptions of the tests, media sections follow it.
+const sdpHeader = `v=0
+o=- 4596489990601351948 2 IN IP4 127.0.0.1
+s=-
+t=0 0
+`
+
+func mustParseSDP(t *testing.T, raw string) sdp.SessionDescription {
+	t.Helper()
+
+	s := sdp.SessionDescription{}
+	assert.NoError(t, s.Unmarshal([]byte(raw)))
+
+	return s
+}
+
+func codecPayloadTypes(codecs []RTPCodecParameters) []PayloadType {
+	payloadTypes := make([]PayloadType, 0, len(codecs))
+	for _, codec := range codecs {
+		payloadTypes = append(payloadTypes, codec.PayloadType)
+	}
+
+	return payloadTypes
+}
+
 // pion/webrtc#1078
 // .
 func TestOpusCase(t *testing.T) {
@@ -1010,3 +1042,3575 @@ a=ssrc:4281768245 msid:6ff05509-be96-4ef1-a74f-425e14720983 16d5d7fe-d076-4718-9
 		assert.Len(t, mediaEngine.negotiatedVideoCodecs, 2)
 	})
 }
+
+func TestMediaEngineMerge(t *testing.T) {
+	t.Run("Audio and Video", func(t *testing.T) {
+		audioEngine := &MediaEngine{}
+		assert.NoError(t, audioEngine.RegisterCodec(RTPCodecParameters{
+			RTPCodecCapability: RTPCodecCapability{MimeType: MimeTypeOpus, ClockRate: 48000, Channels: 2},
+			PayloadType:        111,
+		}, RTPCodecTypeAudio))
+		assert.NoError(t, audioEngine.RegisterHeaderExtension(
+			RTPHeaderExtensionCapability{URI: sdp.AudioLevelURI}, RTPCodecTypeAudio,
+		))
+
+		videoEngine := &MediaEngine{}
+		assert.NoError(t, videoEngine.RegisterCodec(RTPCodecParameters{
+			RTPCodecCapability: RTPCodecCapability{
+				MimeType: MimeTypeVP8, ClockRate: 90000, RTCPFeedback: []RTCPFeedback{{Type: TypeRTCPFBNACK}},
+			},
+			PayloadType: 96,
+		}, RTPCodecTypeVideo))
+		assert.NoError(t, videoEngine.RegisterHeaderExtension(
+			RTPHeaderExtensionCapability{URI: sdp.SDESMidURI}, RTPCodecTypeVideo,
+		))
+
+		assert.NoError(t, audioEngine.Merge(videoEngine))
+
+		assert.Len(t, audioEngine.audioCodecs, 1)
+		assert.Len(t, audioEngine.videoCodecs, 1)
+		assert.Equal(t, MimeTypeVP8, audioEngine.videoCodecs[0].MimeType)
+
+		audioParams := audioEngine.getRTPParametersByKind(
+			RTPCodecTypeAudio, []RTPTransceiverDirection{RTPTransceiverDirectionRecvonly},
+		)
+		assert.Len(t, audioParams.HeaderExtensions, 1)
+		assert.Equal(t, sdp.AudioLevelURI, audioParams.HeaderExtensions[0].URI)
+
+		videoParams := audioEngine.getRTPParametersByKind(
+			RTPCodecTypeVideo, []RTPTransceiverDirection{RTPTransceiverDirectionRecvonly},
+		)
+		assert.Len(t, videoParams.HeaderExtensions, 1)
+		assert.Equal(t, sdp.SDESMidURI, videoParams.HeaderExtensions[0].URI)
+	})
+
+	t.Run("Feedback Union", func(t *testing.T) {
+		base := &MediaEngine{}
+		assert.NoError(t, base.RegisterCodec(RTPCodecParameters{
+			RTPCodecCapability: RTPCodecCapability{
+				MimeType: MimeTypeVP8, ClockRate: 90000, RTCPFeedback: []RTCPFeedback{{Type: TypeRTCPFBNACK}},
+			},
+			PayloadType: 96,
+		}, RTPCodecTypeVideo))
+
+		overlay := &MediaEngine{}
+		assert.NoError(t, overlay.RegisterCodec(RTPCodecParameters{
+			RTPCodecCapability: RTPCodecCapability{
+				MimeType: MimeTypeVP8, ClockRate: 90000, RTCPFeedback: []RTCPFeedback{
+					{Type: TypeRTCPFBNACK},
+					{Type: TypeRTCPFBNACK, Parameter: "pli"},
+				},
+			},
+			PayloadType: 96,
+		}, RTPCodecTypeVideo))
+
+		assert.NoError(t, base.Merge(overlay))
+		assert.Len(t, base.videoCodecs, 1)
+		assert.Equal(t, []RTCPFeedback{
+			{Type: TypeRTCPFBNACK},
+			{Type: TypeRTCPFBNACK, Parameter: "pli"},
+		}, base.videoCodecs[0].RTCPFeedback)
+	})
+
+	t.Run("Conflicting Payload Type", func(t *testing.T) {
+		base := &MediaEngine{}
+		assert.NoError(t, base.RegisterCodec(RTPCodecParameters{
+			RTPCodecCapability: RTPCodecCapability{MimeType: MimeTypeVP8, ClockRate: 90000},
+			PayloadType:        96,
+		}, RTPCodecTypeVideo))
+
+		overlay := &MediaEngine{}
+		assert.NoError(t, overlay.RegisterCodec(RTPCodecParameters{
+			RTPCodecCapability: RTPCodecCapability{MimeType: MimeTypeVP9, ClockRate: 90000},
+			PayloadType:        96,
+		}, RTPCodecTypeVideo))
+
+		assert.ErrorIs(t, base.Merge(overlay), ErrCodecAlreadyRegistered)
+		assert.Len(t, base.videoCodecs, 1)
+		assert.Equal(t, MimeTypeVP8, base.videoCodecs[0].MimeType)
+	})
+}
+
+func TestMediaEngineRTXPayloadType(t *testing.T) {
+	t.Run("RTX negotiated", func(t *testing.T) {
+		const offerSdp = sdpHeader + `m=video 60323 UDP/TLS/RTP/SAVPF 100 101
+a=rtpmap:100 VP8/90000
+a=rtpmap:101 rtx/90000
+a=fmtp:101 apt=100
+`
+		mediaEngine := MediaEngine{}
+		assert.NoError(t, mediaEngine.RegisterDefaultCodecs())
+		assert.NoError(t, mediaEngine.updateFromRemoteDescription(mustParseSDP(t, offerSdp)))
+
+		rtxPT, ok := mediaEngine.RTXPayloadType(100, RTPCodecTypeVideo)
+		assert.True(t, ok)
+		assert.Equal(t, PayloadType(101), rtxPT)
+	})
+
+	t.Run("RTX not negotiated", func(t *testing.T) {
+		const offerSdp = sdpHeader + `m=video 60323 UDP/TLS/RTP/SAVPF 100
+a=rtpmap:100 VP8/90000
+`
+		mediaEngine := MediaEngine{}
+		assert.NoError(t, mediaEngine.RegisterDefaultCodecs())
+		assert.NoError(t, mediaEngine.updateFromRemoteDescription(mustParseSDP(t, offerSdp)))
+
+		_, ok := mediaEngine.RTXPayloadType(100, RTPCodecTypeVideo)
+		assert.False(t, ok)
+	})
+}
+
+func TestMediaEngineCodecProvider(t *testing.T) {
+	const offerSdp = sdpHeader + `m=video 60323 UDP/TLS/RTP/SAVPF 96
+a=rtpmap:96 VP8/90000
+`
+	providerCalls := 0
+	mediaEngine := MediaEngine{}
+	mediaEngine.SetCodecProvider(func(typ RTPCodecType) []RTPCodecParameters {
+		providerCalls++
+		if typ != RTPCodecTypeVideo {
+			return nil
+		}
+
+		return []RTPCodecParameters{{
+			RTPCodecCapability: RTPCodecCapability{MimeType: MimeTypeVP8, ClockRate: 90000},
+			PayloadType:        96,
+		}}
+	})
+
+	codecs := mediaEngine.getCodecsByKind(RTPCodecTypeVideo)
+	assert.Len(t, codecs, 1)
+	assert.Equal(t, MimeTypeVP8, codecs[0].MimeType)
+
+	s := mustParseSDP(t, offerSdp)
+	assert.NoError(t, mediaEngine.updateFromRemoteDescription(s))
+
+	assert.True(t, mediaEngine.negotiatedVideo)
+	assert.Len(t, mediaEngine.videoCodecs, 1)
+	assert.Len(t, mediaEngine.negotiatedVideoCodecs, 1)
+	assert.Equal(t, PayloadType(96), mediaEngine.negotiatedVideoCodecs[0].PayloadType)
+
+	// The result is cached once negotiated
+	calls := providerCalls
+	_ = mediaEngine.getCodecsByKind(RTPCodecTypeVideo)
+	assert.NoError(t, mediaEngine.updateFromRemoteDescription(s))
+	assert.Equal(t, calls, providerCalls)
+
+	// Kinds the provider has no codecs for are only asked for once too
+	assert.Empty(t, mediaEngine.getCodecsByKind(RTPCodecTypeAudio))
+	assert.Empty(t, mediaEngine.getCodecsByKind(RTPCodecTypeAudio))
+	assert.Equal(t, calls+1, providerCalls)
+}
+
+func TestMediaEngineCodecProviderRegistersCodecs(t *testing.T) {
+	mediaEngine := &MediaEngine{}
+	observer := &testRegistrationObserver{mediaEngine: mediaEngine}
+	mediaEngine.AddRegistrationObserver(observer)
+	mediaEngine.SetCodecProvider(func(RTPCodecType) []RTPCodecParameters {
+		return []RTPCodecParameters{
+			{
+				RTPCodecCapability: RTPCodecCapability{MimeType: MimeTypeVP8, ClockRate: 90000},
+				PayloadType:        96,
+			},
+			{
+				RTPCodecCapability: RTPCodecCapability{MimeType: MimeTypeVP9, ClockRate: 90000},
+				PayloadType:        200,
+			},
+			{
+				RTPCodecCapability: RTPCodecCapability{MimeType: MimeTypeOpus, ClockRate: 48000, Channels: 2},
+				PayloadType:        111,
+			},
+		}
+	})
+
+	// Codecs registerCodec refuses aren't provided either
+	assert.Equal(t, []PayloadType{96}, codecPayloadTypes(mediaEngine.getCodecsByKind(RTPCodecTypeVideo)))
+	assert.Equal(t, []PayloadType{96}, codecPayloadTypes(observer.codecs))
+}
+
+func TestMediaEngineAvailableHeaderExtensionIDs(t *testing.T) {
+	const offerSdp = sdpHeader + `m=video 60323 UDP/TLS/RTP/SAVPF 96
+a=extmap:1 urn:ietf:params:rtp-hdrext:sdes:mid
+a=extmap:2 urn:ietf:params:rtp-hdrext:sdes:rtp-stream-id
+a=extmap:3 urn:ietf:params:rtp-hdrext:sdes:repaired-rtp-stream-id
+a=extmap:9 urn:3gpp:video-orientation
+a=rtpmap:96 VP8/90000
+`
+	mediaEngine := MediaEngine{}
+	assert.NoError(t, mediaEngine.RegisterDefaultCodecs())
+	assert.Equal(t, 14, mediaEngine.AvailableHeaderExtensionIDs())
+
+	for _, uri := range []string{
+		sdp.SDESMidURI,
+		sdp.SDESRTPStreamIDURI,
+		sdp.SDESRepairRTPStreamIDURI,
+		sdp.TransportCCURI,
+	} {
+		assert.NoError(t, mediaEngine.RegisterHeaderExtension(
+			RTPHeaderExtensionCapability{URI: uri}, RTPCodecTypeVideo,
+		))
+	}
+	assert.Equal(t, 10, mediaEngine.AvailableHeaderExtensionIDs())
+
+	s := mustParseSDP(t, offerSdp)
+	assert.NoError(t, mediaEngine.updateFromRemoteDescription(s))
+
+	// Three negotiated, transport-cc still needs an ID, video-orientation isn't registered
+	assert.Equal(t, 10, mediaEngine.AvailableHeaderExtensionIDs())
+
+	assert.NoError(t, mediaEngine.RegisterHeaderExtension(
+		RTPHeaderExtensionCapability{URI: sdp.AudioLevelURI}, RTPCodecTypeAudio,
+	))
+	assert.Equal(t, 9, mediaEngine.AvailableHeaderExtensionIDs())
+}
+
+func TestMediaEngineDuplicateExtmapURI(t *testing.T) {
+	assertSingleMid := func(t *testing.T, mediaEngine *MediaEngine, expectedID int) {
+		t.Helper()
+
+		id, _, videoNegotiated := mediaEngine.getHeaderExtensionID(RTPHeaderExtensionCapability{sdp.SDESMidURI})
+		assert.Equal(t, expectedID, id)
+		assert.True(t, videoNegotiated)
+
+		params := mediaEngine.getRTPParametersByKind(
+			RTPCodecTypeVideo, []RTPTransceiverDirection{RTPTransceiverDirectionSendonly},
+		)
+		assert.Len(t, params.HeaderExtensions, 1)
+		assert.Equal(t, RTPHeaderExtensionParameter{URI: sdp.SDESMidURI, ID: expectedID}, params.HeaderExtensions[0])
+	}
+
+	t.Run("Same media section", func(t *testing.T) {
+		const offerSdp = sdpHeader + `m=video 60323 UDP/TLS/RTP/SAVPF 96
+a=extmap:7 urn:ietf:params:rtp-hdrext:sdes:mid
+a=extmap:4 urn:ietf:params:rtp-hdrext:sdes:mid
+a=rtpmap:96 VP8/90000
+`
+		mediaEngine := &MediaEngine{}
+		assert.NoError(t, mediaEngine.RegisterDefaultCodecs())
+		assert.NoError(t, mediaEngine.RegisterHeaderExtension(
+			RTPHeaderExtensionCapability{URI: sdp.SDESMidURI}, RTPCodecTypeVideo,
+		))
+		assert.NoError(t, mediaEngine.updateFromRemoteDescription(mustParseSDP(t, offerSdp)))
+
+		assertSingleMid(t, mediaEngine, 4)
+	})
+
+	t.Run("Different media sections", func(t *testing.T) {
+		const offerSdp = sdpHeader + `m=video 60323 UDP/TLS/RTP/SAVPF 96
+a=extmap:7 urn:ietf:params:rtp-hdrext:sdes:mid
+a=rtpmap:96 VP8/90000
+m=video 60323 UDP/TLS/RTP/SAVPF 96
+a=extmap:3 urn:ietf:params:rtp-hdrext:sdes:mid
+a=rtpmap:96 VP8/90000
+m=video 60323 UDP/TLS/RTP/SAVPF 96
+a=extmap:5 urn:ietf:params:rtp-hdrext:sdes:mid
+a=rtpmap:96 VP8/90000
+`
+		mediaEngine := &MediaEngine{}
+		assert.NoError(t, mediaEngine.RegisterDefaultCodecs())
+		assert.NoError(t, mediaEngine.RegisterHeaderExtension(
+			RTPHeaderExtensionCapability{URI: sdp.SDESMidURI}, RTPCodecTypeVideo,
+		))
+		assert.NoError(t, mediaEngine.updateFromRemoteDescription(mustParseSDP(t, offerSdp)))
+
+		assertSingleMid(t, mediaEngine, 3)
+	})
+}
+
+func TestMediaEngineCompatibilityScore(t *testing.T) {
+	const allExact = sdpHeader + `m=audio 9 UDP/TLS/RTP/SAVPF 111
+a=rtpmap:111 opus/48000/2
+a=fmtp:111 minptime=10;useinbandfec=1
+m=video 9 UDP/TLS/RTP/SAVPF 96
+a=rtpmap:96 VP8/90000
+`
+
+	const mixed = sdpHeader + `m=video 9 UDP/TLS/RTP/SAVPF 96 127
+a=rtpmap:96 VP8/90000
+a=rtpmap:127 H264/90000
+a=fmtp:127 level-asymmetry-allowed=1;packetization-mode=1;profile-level-id=f40032
+`
+
+	mediaEngine := MediaEngine{}
+	assert.NoError(t, mediaEngine.RegisterDefaultCodecs())
+
+	assert.Equal(t, 4, mediaEngine.CompatibilityScore(mustParseSDP(t, allExact)))
+	assert.Equal(t, 3, mediaEngine.CompatibilityScore(mustParseSDP(t, mixed)))
+
+	assert.False(t, mediaEngine.negotiatedAudio)
+	assert.False(t, mediaEngine.negotiatedVideo)
+	assert.Empty(t, mediaEngine.negotiatedVideoCodecs)
+}
+
+func TestMediaEngineSVCLayers(t *testing.T) {
+	mediaEngine := &MediaEngine{}
+
+	_, _, ok := mediaEngine.SVCLayers(MimeTypeAV1)
+	assert.False(t, ok)
+
+	assert.NoError(t, mediaEngine.SetSVCLayers(MimeTypeAV1, 3, 3))
+	spatial, temporal, ok := mediaEngine.SVCLayers("video/av1")
+	assert.True(t, ok)
+	assert.Equal(t, 3, spatial)
+	assert.Equal(t, 3, temporal)
+
+	assert.ErrorIs(t, mediaEngine.SetSVCLayers(MimeTypeAV1, 0, 1), ErrInvalidSVCLayers)
+	assert.ErrorIs(t, mediaEngine.SetSVCLayers(MimeTypeAV1, 1, 9), ErrInvalidSVCLayers)
+
+	spatial, temporal, ok = mediaEngine.copy().SVCLayers(MimeTypeAV1)
+	assert.True(t, ok)
+	assert.Equal(t, 3, spatial)
+	assert.Equal(t, 3, temporal)
+}
+
+func TestMediaEngineStrictHeaderExtensions(t *testing.T) {
+	const offerSdp = sdpHeader + `m=video 60323 UDP/TLS/RTP/SAVPF 96
+a=extmap:1 urn:ietf:params:rtp-hdrext:sdes:mid
+a=extmap:4 urn:3gpp:video-orientation
+a=extmap:6 urn:ietf:params:rtp-hdrext:ssrc-audio-level
+a=rtpmap:96 VP8/90000
+`
+
+	runTest := func(t *testing.T, strict bool) *MediaEngine {
+		t.Helper()
+
+		mediaEngine := &MediaEngine{}
+		mediaEngine.SetStrictHeaderExtensions(strict)
+		assert.NoError(t, mediaEngine.RegisterDefaultCodecs())
+		assert.NoError(t, mediaEngine.RegisterHeaderExtension(
+			RTPHeaderExtensionCapability{URI: sdp.SDESMidURI}, RTPCodecTypeVideo,
+		))
+		assert.NoError(t, mediaEngine.RegisterHeaderExtension(
+			RTPHeaderExtensionCapability{URI: sdp.AudioLevelURI}, RTPCodecTypeAudio,
+		))
+
+		s := mustParseSDP(t, offerSdp)
+		assert.NoError(t, mediaEngine.updateFromRemoteDescription(s))
+
+		id, _, videoNegotiated := mediaEngine.getHeaderExtensionID(RTPHeaderExtensionCapability{URI: sdp.SDESMidURI})
+		assert.Equal(t, 1, id)
+		assert.True(t, videoNegotiated)
+
+		return mediaEngine
+	}
+
+	t.Run("Strict", func(t *testing.T) {
+		mediaEngine := runTest(t, true)
+
+		assert.Len(t, mediaEngine.negotiatedHeaderExtensions, 1)
+		for _, id := range []int{4, 6} {
+			_, taken := mediaEngine.negotiatedHeaderExtensions[id]
+			assert.False(t, taken)
+		}
+	})
+
+	t.Run("Not Strict", func(t *testing.T) {
+		mediaEngine := runTest(t, false)
+
+		// Unregistered URIs are never stored
+		_, taken := mediaEngine.negotiatedHeaderExtensions[4]
+		assert.False(t, taken)
+	})
+}
+
+func TestMediaEngineGenericFrameDescriptor(t *testing.T) {
+	const offerSdp = sdpHeader + `m=video 60323 UDP/TLS/RTP/SAVPF 45
+a=extmap:8 http://www.webrtc.org/experiments/rtp-hdrext/generic-frame-descriptor-00
+a=extmap:11 https://aomediacodec.github.io/av1-rtp-spec/#dependency-descriptor-rtp-header-extension
+a=rtpmap:45 AV1/90000
+`
+	mediaEngine := &MediaEngine{}
+	assert.NoError(t, mediaEngine.RegisterDefaultCodecs())
+	assert.ErrorIs(t, mediaEngine.RegisterHeaderExtension(
+		RTPHeaderExtensionCapability{URI: GenericFrameDescriptorURI}, RTPCodecTypeAudio,
+	), ErrHeaderExtensionInvalidKind)
+
+	for _, uri := range []string{GenericFrameDescriptorURI, DependencyDescriptorURI} {
+		assert.NoError(t, mediaEngine.RegisterHeaderExtension(RTPHeaderExtensionCapability{URI: uri}, RTPCodecTypeVideo))
+	}
+
+	params := mediaEngine.getRTPParametersByKind(
+		RTPCodecTypeVideo, []RTPTransceiverDirection{RTPTransceiverDirectionSendonly},
+	)
+	assert.Len(t, params.HeaderExtensions, 2)
+	assert.NotEqual(t, params.HeaderExtensions[0].ID, params.HeaderExtensions[1].ID)
+
+	assert.Empty(t, mediaEngine.getRTPParametersByKind(
+		RTPCodecTypeAudio, []RTPTransceiverDirection{RTPTransceiverDirectionSendonly},
+	).HeaderExtensions)
+
+	s := mustParseSDP(t, offerSdp)
+	assert.NoError(t, mediaEngine.updateFromRemoteDescription(s))
+
+	id, ok := mediaEngine.HeaderExtensionID(GenericFrameDescriptorURI, RTPCodecTypeVideo)
+	assert.True(t, ok)
+	assert.Equal(t, 8, id)
+
+	id, ok = mediaEngine.HeaderExtensionID(DependencyDescriptorURI, RTPCodecTypeVideo)
+	assert.True(t, ok)
+	assert.Equal(t, 11, id)
+
+	_, ok = mediaEngine.HeaderExtensionID(GenericFrameDescriptorURI, RTPCodecTypeAudio)
+	assert.False(t, ok)
+}
+
+func TestMediaEngineUnregisterHeaderExtension(t *testing.T) {
+	mediaEngine := &MediaEngine{}
+	assert.NoError(t, mediaEngine.RegisterDefaultCodecs())
+	for _, uri := range []string{sdp.SDESMidURI, sdp.SDESRTPStreamIDURI, sdp.SDESRepairRTPStreamIDURI} {
+		assert.NoError(t, mediaEngine.RegisterHeaderExtension(RTPHeaderExtensionCapability{URI: uri}, RTPCodecTypeVideo))
+	}
+
+	mediaEngine.UnregisterHeaderExtension(sdp.SDESRTPStreamIDURI)
+	mediaEngine.UnregisterHeaderExtension("urn:3gpp:video-orientation")
+
+	params := mediaEngine.getRTPParametersByKind(
+		RTPCodecTypeVideo, []RTPTransceiverDirection{RTPTransceiverDirectionSendonly},
+	)
+	uris := []string{}
+	for _, extension := range params.HeaderExtensions {
+		uris = append(uris, extension.URI)
+	}
+	assert.ElementsMatch(t, []string{sdp.SDESMidURI, sdp.SDESRepairRTPStreamIDURI}, uris)
+}
+
+func TestMediaEngineClearHeaderExtensions(t *testing.T) {
+	mediaEngine := &MediaEngine{}
+	assert.NoError(t, mediaEngine.RegisterDefaultCodecs())
+	for _, typ := range []RTPCodecType{RTPCodecTypeAudio, RTPCodecTypeVideo} {
+		for _, uri := range []string{sdp.SDESMidURI, sdp.TransportCCURI} {
+			assert.NoError(t, mediaEngine.RegisterHeaderExtension(RTPHeaderExtensionCapability{URI: uri}, typ))
+		}
+	}
+
+	mediaEngine.ClearHeaderExtensions()
+
+	for _, typ := range []RTPCodecType{RTPCodecTypeAudio, RTPCodecTypeVideo} {
+		params := mediaEngine.getRTPParametersByKind(typ, []RTPTransceiverDirection{RTPTransceiverDirectionSendrecv})
+		assert.Empty(t, params.HeaderExtensions)
+		assert.NotEmpty(t, params.Codecs)
+	}
+}
+
+func TestMediaEngineMalformedRtpmapError(t *testing.T) {
+	const offerSdp = sdpHeader + `m=audio 9 UDP/TLS/RTP/SAVPF 111
+a=rtpmap:111 opus/48000/2
+m=video 60323 UDP/TLS/RTP/SAVPF 96
+a=rtpmap:96 VP8/abc
+`
+	mediaEngine := MediaEngine{}
+	assert.NoError(t, mediaEngine.RegisterDefaultCodecs())
+
+	s := mustParseSDP(t, offerSdp)
+
+	err := mediaEngine.updateFromRemoteDescription(s)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "media section 1 (video)")
+	assert.Contains(t, err.Error(), "rtpmap:96 VP8/abc")
+}
+
+func TestMediaEnginePinFmtpParameter(t *testing.T) {
+	const offerSdp = sdpHeader + `m=audio 9 UDP/TLS/RTP/SAVPF 111
+a=rtpmap:111 opus/48000/2
+a=fmtp:111 minptime=10;useinbandfec=1
+`
+	mediaEngine := MediaEngine{}
+	assert.NoError(t, mediaEngine.RegisterDefaultCodecs())
+	mediaEngine.PinFmtpParameter(MimeTypeOpus, "useinbandfec", "0")
+
+	s := mustParseSDP(t, offerSdp)
+	assert.NoError(t, mediaEngine.copy().updateFromRemoteDescription(s))
+	assert.NoError(t, mediaEngine.updateFromRemoteDescription(s))
+
+	opusCodec, _, err := mediaEngine.getCodecByPayload(111)
+	assert.NoError(t, err)
+	assert.Equal(t, "minptime=10;useinbandfec=0", opusCodec.SDPFmtpLine)
+}
+
+func TestMediaEngineUppercaseFmtpKeys(t *testing.T) {
+	const offerSdp = sdpHeader + `m=video 9 UDP/TLS/RTP/SAVPF 50 51
+a=rtpmap:50 VP8/90000
+a=rtpmap:51 rtx/90000
+a=fmtp:51 APT=50
+`
+	mediaEngine := MediaEngine{}
+	assert.NoError(t, mediaEngine.RegisterDefaultCodecs())
+
+	s := mustParseSDP(t, offerSdp)
+	assert.NoError(t, mediaEngine.updateFromRemoteDescription(s))
+
+	rtxCodec, _, err := mediaEngine.getCodecByPayload(51)
+	assert.NoError(t, err)
+	assert.Equal(t, MimeTypeRTX, rtxCodec.MimeType)
+
+	rtxPayloadType, ok := mediaEngine.RTXPayloadType(50, RTPCodecTypeVideo)
+	assert.True(t, ok)
+	assert.Equal(t, PayloadType(51), rtxPayloadType)
+
+	vp8Codec, _, err := mediaEngine.getCodecByPayload(50)
+	assert.NoError(t, err)
+	_, matchType, err := mediaEngine.matchRemoteCodec(
+		rtxCodec, RTPCodecTypeVideo, []RTPCodecParameters{vp8Codec}, nil,
+	)
+	assert.NoError(t, err)
+	assert.Equal(t, CodecMatchExact, matchType)
+}
+
+func TestMediaEngineOnHeaderExtensionNegotiated(t *testing.T) {
+	const offerSdp = sdpHeader + `m=audio 9 UDP/TLS/RTP/SAVPF 111
+a=extmap:1 urn:ietf:params:rtp-hdrext:sdes:mid
+a=extmap:2 urn:ietf:params:rtp-hdrext:ssrc-audio-level
+a=rtpmap:111 opus/48000/2
+m=video 9 UDP/TLS/RTP/SAVPF 96
+a=extmap:1 urn:ietf:params:rtp-hdrext:sdes:mid
+a=rtpmap:96 VP8/90000
+`
+	const renegotiationSdp = offerSdp + `m=video 9 UDP/TLS/RTP/SAVPF 96
+a=extmap:1 urn:ietf:params:rtp-hdrext:sdes:mid
+a=extmap:3 http://www.webrtc.org/experiments/rtp-hdrext/abs-send-time
+a=rtpmap:96 VP8/90000
+`
+
+	type negotiatedExtension struct {
+		uri string
+		id  int
+		typ RTPCodecType
+	}
+
+	mediaEngine := &MediaEngine{}
+	assert.NoError(t, mediaEngine.RegisterDefaultCodecs())
+	for _, uri := range []string{sdp.SDESMidURI, sdp.ABSSendTimeURI} {
+		assert.NoError(t, mediaEngine.RegisterHeaderExtension(RTPHeaderExtensionCapability{URI: uri}, RTPCodecTypeVideo))
+	}
+	for _, uri := range []string{sdp.SDESMidURI, sdp.AudioLevelURI} {
+		assert.NoError(t, mediaEngine.RegisterHeaderExtension(RTPHeaderExtensionCapability{URI: uri}, RTPCodecTypeAudio))
+	}
+	mediaEngine = mediaEngine.copy()
+
+	var negotiated []negotiatedExtension
+	mediaEngine.OnHeaderExtensionNegotiated(func(uri string, id int, typ RTPCodecType) {
+		// Must not deadlock, the handler is called without the lock held
+		_, ok := mediaEngine.HeaderExtensionID(uri, typ)
+		assert.True(t, ok)
+
+		negotiated = append(negotiated, negotiatedExtension{uri, id, typ})
+	})
+
+	assert.NoError(t, mediaEngine.updateFromRemoteDescription(mustParseSDP(t, offerSdp)))
+	assert.ElementsMatch(t, []negotiatedExtension{
+		{sdp.SDESMidURI, 1, RTPCodecTypeAudio},
+		{sdp.AudioLevelURI, 2, RTPCodecTypeAudio},
+		{sdp.SDESMidURI, 1, RTPCodecTypeVideo},
+	}, negotiated)
+
+	negotiated = nil
+	assert.NoError(t, mediaEngine.updateFromRemoteDescription(mustParseSDP(t, offerSdp)))
+	assert.Empty(t, negotiated)
+
+	assert.NoError(t, mediaEngine.updateFromRemoteDescription(mustParseSDP(t, renegotiationSdp)))
+	assert.Equal(t, []negotiatedExtension{{sdp.ABSSendTimeURI, 3, RTPCodecTypeVideo}}, negotiated)
+}
+
+func TestMediaEngineResetNegotiation(t *testing.T) {
+	const offerSdp = sdpHeader + `m=audio 9 UDP/TLS/RTP/SAVPF 111
+a=extmap:1 urn:ietf:params:rtp-hdrext:ssrc-audio-level
+a=rtpmap:111 opus/48000/2
+m=video 9 UDP/TLS/RTP/SAVPF 96
+a=rtpmap:96 VP8/90000
+`
+	mediaEngine := &MediaEngine{}
+	assert.NoError(t, mediaEngine.RegisterDefaultCodecs())
+	assert.NoError(t, mediaEngine.RegisterHeaderExtension(
+		RTPHeaderExtensionCapability{URI: sdp.AudioLevelURI}, RTPCodecTypeAudio,
+	))
+	mediaEngine = mediaEngine.copy()
+	registeredVideo, registeredAudio := len(mediaEngine.videoCodecs), len(mediaEngine.audioCodecs)
+
+	for range 2 {
+		s := mustParseSDP(t, offerSdp)
+		assert.NoError(t, mediaEngine.updateFromRemoteDescription(s))
+		assert.True(t, mediaEngine.negotiatedAudio)
+		assert.True(t, mediaEngine.negotiatedVideo)
+		assert.Len(t, mediaEngine.negotiatedAudioCodecs, 1)
+		assert.Len(t, mediaEngine.negotiatedVideoCodecs, 1)
+		assert.Len(t, mediaEngine.negotiatedHeaderExtensions, 1)
+
+		mediaEngine.ResetNegotiation()
+		assert.False(t, mediaEngine.negotiatedAudio)
+		assert.False(t, mediaEngine.negotiatedVideo)
+		assert.Empty(t, mediaEngine.negotiatedAudioCodecs)
+		assert.Empty(t, mediaEngine.negotiatedVideoCodecs)
+		assert.Empty(t, mediaEngine.negotiatedHeaderExtensions)
+
+		assert.Len(t, mediaEngine.videoCodecs, registeredVideo)
+		assert.Len(t, mediaEngine.audioCodecs, registeredAudio)
+		assert.Len(t, mediaEngine.headerExtensions, 1)
+	}
+}
+
+func TestMediaEngineMultiopus(t *testing.T) {
+	const offerSdp = sdpHeader + `m=audio 9 UDP/TLS/RTP/SAVPF 111 63
+a=rtpmap:111 opus/48000/2
+a=fmtp:111 minptime=10;useinbandfec=1
+a=rtpmap:63 multiopus/48000/6
+a=fmtp:63 channel_mapping=0,4,1,2,3,5;coupled_streams=2;minptime=10;num_streams=4;useinbandfec=1
+`
+	t.Run("Invalid Channels", func(t *testing.T) {
+		mediaEngine := MediaEngine{}
+		assert.ErrorIs(t, mediaEngine.RegisterMultiopusCodec(4, 114), ErrUnsupportedMultiopusChannels)
+		assert.Empty(t, mediaEngine.audioCodecs)
+	})
+
+	t.Run("Surround 5.1", func(t *testing.T) {
+		mediaEngine := MediaEngine{}
+		assert.NoError(t, mediaEngine.RegisterDefaultCodecs())
+		assert.NoError(t, mediaEngine.RegisterMultiopusCodec(8, 114))
+		assert.NoError(t, mediaEngine.RegisterMultiopusCodec(6, 115))
+		assert.NoError(t, mediaEngine.updateFromRemoteDescription(mustParseSDP(t, offerSdp)))
+
+		multiopusCodec, _, err := mediaEngine.getCodecByPayload(63)
+		assert.NoError(t, err)
+		assert.Equal(t, MimeTypeMultiopus, multiopusCodec.MimeType)
+		assert.Equal(t, uint16(6), multiopusCodec.Channels)
+
+		payloader, err := payloaderForCodec(multiopusCodec.RTPCodecCapability)
+		assert.NoError(t, err)
+		assert.IsType(t, &codecs.OpusPayloader{}, payloader)
+	})
+
+	t.Run("Channel Mapping Mismatch", func(t *testing.T) {
+		mediaEngine := MediaEngine{}
+		assert.NoError(t, mediaEngine.RegisterDefaultCodecs())
+		assert.NoError(t, mediaEngine.RegisterMultiopusCodec(6, 115))
+		assert.NoError(t, mediaEngine.updateFromRemoteDescription(mustParseSDP(t,
+			strings.Replace(offerSdp, "channel_mapping=0,4,1,2,3,5", "channel_mapping=0,1,2,3,4,5", 1),
+		)))
+
+		_, _, err := mediaEngine.getCodecByPayload(63)
+		assert.ErrorIs(t, err, ErrCodecNotFound)
+		_, _, err = mediaEngine.getCodecByPayload(111)
+		assert.NoError(t, err)
+	})
+}
+
+func TestMediaEngineNegotiatedMatchType(t *testing.T) {
+	const offerSdp = sdpHeader + `m=video 9 UDP/TLS/RTP/SAVPF 120
+a=rtpmap:120 H264/90000
+a=fmtp:120 level-asymmetry-allowed=1;packetization-mode=1;profile-level-id=%s
+`
+	for _, test := range []struct {
+		name           string
+		profileLevelID string
+		matchType      CodecMatchType
+	}{
+		// The level isn't taken into account when matching H264
+		{"Level Mismatch", "42e034", CodecMatchExact},
+		{"Profile Mismatch", "f40032", CodecMatchPartial},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			mediaEngine := MediaEngine{}
+			assert.NoError(t, mediaEngine.RegisterDefaultCodecs())
+
+			_, ok := mediaEngine.NegotiatedMatchType(120, RTPCodecTypeVideo)
+			assert.False(t, ok)
+
+			s := mustParseSDP(t, fmt.Sprintf(offerSdp, test.profileLevelID))
+			assert.NoError(t, mediaEngine.updateFromRemoteDescription(s))
+
+			matchType, ok := mediaEngine.NegotiatedMatchType(120, RTPCodecTypeVideo)
+			assert.True(t, ok)
+			assert.Equal(t, test.matchType, matchType)
+
+			mediaEngine.ResetNegotiation()
+			_, ok = mediaEngine.NegotiatedMatchType(120, RTPCodecTypeVideo)
+			assert.False(t, ok)
+		})
+	}
+}
+
+func TestMediaEngineTransmissionOffset(t *testing.T) {
+	const offerSdp = sdpHeader + `m=audio 9 UDP/TLS/RTP/SAVPF 111
+a=extmap:3 urn:ietf:params:rtp-hdrext:toffset
+a=rtpmap:111 opus/48000/2
+m=video 9 UDP/TLS/RTP/SAVPF 96
+a=extmap:2 urn:ietf:params:rtp-hdrext:toffset
+a=rtpmap:96 VP8/90000
+`
+	mediaEngine := &MediaEngine{}
+	assert.NoError(t, mediaEngine.RegisterDefaultCodecs())
+	for _, typ := range []RTPCodecType{RTPCodecTypeAudio, RTPCodecTypeVideo} {
+		assert.NoError(t, mediaEngine.RegisterHeaderExtension(RTPHeaderExtensionCapability{URI: TransmissionOffsetURI}, typ))
+	}
+	mediaEngine = mediaEngine.copy()
+
+	s := mustParseSDP(t, offerSdp)
+	assert.NoError(t, mediaEngine.updateFromRemoteDescription(s))
+
+	id, ok := mediaEngine.HeaderExtensionID(TransmissionOffsetURI, RTPCodecTypeVideo)
+	assert.True(t, ok)
+	assert.Equal(t, 2, id)
+
+	params := mediaEngine.getRTPParametersByKind(RTPCodecTypeVideo, []RTPTransceiverDirection{
+		RTPTransceiverDirectionSendonly,
+	})
+	assert.Contains(t, params.HeaderExtensions, RTPHeaderExtensionParameter{URI: TransmissionOffsetURI, ID: 2})
+}
+
+func TestMediaEngineCodecMimeTypeMismatch(t *testing.T) {
+	mediaEngine := MediaEngine{}
+
+	assert.ErrorIs(t, mediaEngine.RegisterCodec(RTPCodecParameters{
+		RTPCodecCapability: RTPCodecCapability{MimeType: MimeTypeVP8, ClockRate: 90000},
+		PayloadType:        96,
+	}, RTPCodecTypeAudio), ErrCodecMimeTypeMismatch)
+	assert.ErrorIs(t, mediaEngine.RegisterCodec(RTPCodecParameters{
+		RTPCodecCapability: RTPCodecCapability{MimeType: "opus", ClockRate: 48000, Channels: 2},
+		PayloadType:        111,
+	}, RTPCodecTypeAudio), ErrCodecMimeTypeMismatch)
+	assert.Empty(t, mediaEngine.audioCodecs)
+
+	// RTX is exempt and the kind is matched case-insensitively
+	assert.NoError(t, mediaEngine.RegisterCodec(RTPCodecParameters{
+		RTPCodecCapability: RTPCodecCapability{MimeType: "Audio/opus", ClockRate: 48000, Channels: 2},
+		PayloadType:        111,
+	}, RTPCodecTypeAudio))
+	assert.NoError(t, mediaEngine.RegisterCodec(RTPCodecParameters{
+		RTPCodecCapability: RTPCodecCapability{MimeType: MimeTypeRTX, ClockRate: 48000, SDPFmtpLine: "apt=111"},
+		PayloadType:        112,
+	}, RTPCodecTypeAudio))
+}
+
+func TestMediaEngineUnmatchedRemoteCodecs(t *testing.T) {
+	const offerSdp = sdpHeader + `m=video 9 UDP/TLS/RTP/SAVPF 96 97 98
+a=rtpmap:96 VP8/90000
+a=rtpmap:97 rtx/90000
+a=fmtp:97 apt=96
+a=rtpmap:98 VVC/90000
+a=fmtp:98 profile=1
+`
+	mediaEngine := MediaEngine{}
+	assert.NoError(t, mediaEngine.RegisterDefaultCodecs())
+	assert.Empty(t, mediaEngine.UnmatchedRemoteCodecs())
+
+	for range 2 {
+		s := mustParseSDP(t, offerSdp)
+		assert.NoError(t, mediaEngine.updateFromRemoteDescription(s))
+		mediaEngine.negotiatedVideo = false
+	}
+
+	unmatched := mediaEngine.UnmatchedRemoteCodecs()
+	if assert.Len(t, unmatched, 1) {
+		assert.Equal(t, PayloadType(98), unmatched[0].PayloadType)
+		assert.Equal(t, "video/VVC", unmatched[0].MimeType)
+		assert.Equal(t, "profile=1", unmatched[0].SDPFmtpLine)
+	}
+
+	mediaEngine.ResetNegotiation()
+	assert.Empty(t, mediaEngine.UnmatchedRemoteCodecs())
+}
+
+func TestMediaEngineMimeAlias(t *testing.T) {
+	const offerSdp = sdpHeader + `m=video 9 UDP/TLS/RTP/SAVPF 100
+a=rtpmap:100 x-vp8/90000
+`
+	t.Run("Without Alias", func(t *testing.T) {
+		mediaEngine := MediaEngine{}
+		assert.NoError(t, mediaEngine.RegisterDefaultCodecs())
+		assert.NoError(t, mediaEngine.updateFromRemoteDescription(mustParseSDP(t, offerSdp)))
+		assert.Empty(t, mediaEngine.negotiatedVideoCodecs)
+	})
+
+	t.Run("With Alias", func(t *testing.T) {
+		mediaEngine := MediaEngine{}
+		assert.NoError(t, mediaEngine.RegisterDefaultCodecs())
+		mediaEngine.RegisterMimeAlias(MimeTypeVP8, "video/X-VP8")
+		assert.NoError(t, mediaEngine.updateFromRemoteDescription(mustParseSDP(t, offerSdp)))
+
+		vp8Codec, _, err := mediaEngine.getCodecByPayload(100)
+		assert.NoError(t, err)
+		assert.Equal(t, MimeTypeVP8, vp8Codec.MimeType)
+		assert.Empty(t, mediaEngine.UnmatchedRemoteCodecs())
+	})
+}
+
+func TestMediaEngineHonorRemoteCodecOrder(t *testing.T) {
+	const offerSdp = sdpHeader + `m=video 9 UDP/TLS/RTP/SAVPF 99 98 97 96
+a=rtpmap:99 rtx/90000
+a=fmtp:99 apt=98
+a=rtpmap:98 VP9/90000
+a=fmtp:98 profile-id=0
+a=rtpmap:97 rtx/90000
+a=fmtp:97 apt=96
+a=rtpmap:96 VP8/90000
+`
+	for _, test := range []struct {
+		name         string
+		honor        bool
+		payloadTypes []PayloadType
+	}{
+		// RTX codecs are matched after their primary codec
+		{"Match Order", false, []PayloadType{98, 96, 99, 97}},
+		{"Remote Order", true, []PayloadType{99, 98, 97, 96}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			mediaEngine := MediaEngine{}
+			assert.NoError(t, mediaEngine.RegisterDefaultCodecs())
+			mediaEngine.SetHonorRemoteCodecOrder(test.honor)
+
+			s := mustParseSDP(t, offerSdp)
+			assert.NoError(t, mediaEngine.updateFromRemoteDescription(s))
+
+			assert.Equal(t, test.payloadTypes, codecPayloadTypes(mediaEngine.negotiatedVideoCodecs))
+		})
+	}
+}
+
+func TestMediaEngineRegisterNamedCodec(t *testing.T) {
+	mediaEngine := MediaEngine{}
+	assert.NoError(t, mediaEngine.RegisterNamedCodec(RTPCodecParameters{
+		RTPCodecCapability: RTPCodecCapability{
+			MimeTypeH264, 90000, 0, "level-asymmetry-allowed=1;packetization-mode=1;profile-level-id=42001f", nil,
+		},
+		PayloadType: 102,
+	}, RTPCodecTypeVideo, "H264-CB-mode1"))
+	assert.NoError(t, mediaEngine.RegisterCodec(RTPCodecParameters{
+		RTPCodecCapability: RTPCodecCapability{MimeTypeVP8, 90000, 0, "", nil},
+		PayloadType:        96,
+	}, RTPCodecTypeVideo))
+	assert.NoError(t, mediaEngine.RegisterCodec(RTPCodecParameters{
+		RTPCodecCapability: RTPCodecCapability{MimeTypeOpus, 48000, 2, "minptime=10;useinbandfec=1", nil},
+		PayloadType:        111,
+	}, RTPCodecTypeAudio))
+
+	collector := newStatsReportCollector()
+	mediaEngine.collectStats(collector)
+
+	names := map[PayloadType]string{}
+	for _, stats := range collector.Ready() {
+		if codecStats, ok := stats.(CodecStats); ok {
+			names[codecStats.PayloadType] = codecStats.Name
+		}
+	}
+	assert.Equal(t, map[PayloadType]string{
+		102: "H264-CB-mode1",
+		96:  "video/VP8",
+		111: "audio/opus;minptime=10;useinbandfec=1",
+	}, names)
+
+	offer := sdp.SessionDescription{}
+	assert.NoError(t, offer.Unmarshal([]byte(sdpHeader+`m=video 9 UDP/TLS/RTP/SAVPF 100 96
+a=rtpmap:100 H264/90000
+a=fmtp:100 level-asymmetry-allowed=1;packetization-mode=1;profile-level-id=42001f
+a=rtpmap:96 VP8/90000
+`)))
+	matchedNames := map[PayloadType]string{}
+	mediaEngine.OnCodecMatch(func(remote, local RTPCodecParameters, _ CodecMatchType) {
+		matchedNames[remote.PayloadType] = local.Name()
+	})
+	assert.NoError(t, mediaEngine.updateFromRemoteDescription(offer))
+	assert.Equal(t, map[PayloadType]string{100: "H264-CB-mode1", 96: ""}, matchedNames)
+}
+
+func TestMediaEngineRTXCodecStats(t *testing.T) {
+	mediaEngine := MediaEngine{}
+	assert.NoError(t, mediaEngine.RegisterDefaultCodecs())
+
+	collector := newStatsReportCollector()
+	mediaEngine.collectStats(collector)
+
+	associatedPayloadTypes := map[PayloadType]*PayloadType{}
+	for _, stats := range collector.Ready() {
+		if codecStats, ok := stats.(CodecStats); ok {
+			associatedPayloadTypes[codecStats.PayloadType] = codecStats.AssociatedPayloadType
+		}
+	}
+
+	// VP8 and its RTX codec
+	if assert.NotNil(t, associatedPayloadTypes[97]) {
+		assert.Equal(t, PayloadType(96), *associatedPayloadTypes[97])
+	}
+	assert.Contains(t, associatedPayloadTypes, PayloadType(96))
+	assert.Nil(t, associatedPayloadTypes[96])
+}
+
+func TestMediaEngineSetCodecEnabled(t *testing.T) {
+	hasMimeType := func(params RTPParameters, mimeType string) bool {
+		for _, codec := range params.Codecs {
+			if strings.EqualFold(codec.MimeType, mimeType) {
+				return true
+			}
+		}
+
+		return false
+	}
+	directions := []RTPTransceiverDirection{RTPTransceiverDirectionSendrecv}
+
+	mediaEngine := MediaEngine{}
+	assert.NoError(t, mediaEngine.RegisterDefaultCodecs())
+	registered := len(mediaEngine.videoCodecs)
+	assert.True(t, hasMimeType(mediaEngine.getRTPParametersByKind(RTPCodecTypeVideo, directions), MimeTypeVP9))
+
+	assert.NoError(t, mediaEngine.SetCodecEnabled(MimeTypeVP9, RTPCodecTypeVideo, false))
+	params := mediaEngine.getRTPParametersByKind(RTPCodecTypeVideo, directions)
+	assert.False(t, hasMimeType(params, MimeTypeVP9))
+	assert.True(t, hasMimeType(params, MimeTypeVP8))
+	for _, codec := range params.Codecs {
+		// RTX of VP9 isn't offered either
+		apt, ok := rtxAssociatedPayloadType(codec)
+		assert.False(t, ok && (apt == 98 || apt == 100))
+	}
+	assert.Len(t, mediaEngine.videoCodecs, registered)
+
+	assert.NoError(t, mediaEngine.SetCodecEnabled(MimeTypeVP9, RTPCodecTypeVideo, true))
+	assert.True(t, hasMimeType(mediaEngine.getRTPParametersByKind(RTPCodecTypeVideo, directions), MimeTypeVP9))
+
+	mediaEngine.negotiatedVideo = true
+	assert.ErrorIs(t, mediaEngine.SetCodecEnabled(MimeTypeVP9, RTPCodecTypeVideo, false), ErrCodecToggleAfterNegotiation)
+	assert.NoError(t, mediaEngine.SetCodecEnabled(MimeTypeOpus, RTPCodecTypeAudio, false))
+}
+
+func TestMediaEngineSetClock(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+
+	mediaEngine := MediaEngine{}
+	mediaEngine.SetClock(func() time.Time { return now })
+	assert.NoError(t, mediaEngine.RegisterDefaultCodecs())
+
+	collector := newStatsReportCollector()
+	mediaEngine.collectStats(collector)
+
+	// Codecs registered with the same time still get their own stats
+	codecStats := map[PayloadType]CodecStats{}
+	for id, stats := range collector.Ready() {
+		if stats, ok := stats.(CodecStats); ok {
+			assert.True(t, strings.HasPrefix(id, fmt.Sprintf("RTPCodec-%d-", now.UnixNano())))
+			assert.Equal(t, statsTimestampFrom(now), stats.Timestamp)
+			codecStats[stats.PayloadType] = stats
+		}
+	}
+	assert.Len(t, codecStats, len(mediaEngine.audioCodecs)+len(mediaEngine.videoCodecs))
+
+	// Codecs registered with a copy or after decoding don't reuse the IDs of the codecs it has
+	h265 := RTPCodecParameters{
+		RTPCodecCapability: RTPCodecCapability{MimeTypeH265, 90000, 0, "", nil}, PayloadType: 126,
+	}
+	encoded, err := mediaEngine.MarshalJSON()
+	assert.NoError(t, err)
+	decoded := &MediaEngine{}
+	decoded.SetClock(func() time.Time { return now })
+	assert.NoError(t, decoded.UnmarshalJSON(encoded))
+	for _, other := range []*MediaEngine{mediaEngine.copy(), decoded} {
+		assert.NoError(t, other.RegisterCodec(h265, RTPCodecTypeVideo))
+
+		statsIDs := map[string]struct{}{}
+		for _, codec := range append(slices.Clone(other.audioCodecs), other.videoCodecs...) {
+			statsIDs[codec.statsID] = struct{}{}
+		}
+		assert.Len(t, statsIDs, len(other.audioCodecs)+len(other.videoCodecs))
+	}
+}
+
+func TestMediaEngineReducedSizeRTCP(t *testing.T) {
+	const offerSdp = sdpHeader + `m=video 9 UDP/TLS/RTP/SAVPF 96
+a=rtpmap:96 VP8/90000
+`
+	for _, test := range []struct {
+		name    string
+		sdp     string
+		reduced bool
+	}{
+		{"Not Signaled", offerSdp, false},
+		{"Media Level", offerSdp + "a=rtcp-rsize\n", true},
+		{"Session Level", strings.Replace(offerSdp, "t=0 0\n", "t=0 0\na=rtcp-rsize\n", 1), true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			mediaEngine := MediaEngine{}
+			assert.NoError(t, mediaEngine.RegisterDefaultCodecs())
+
+			s := mustParseSDP(t, test.sdp)
+			assert.NoError(t, mediaEngine.updateFromRemoteDescription(s))
+			assert.Equal(t, test.reduced, mediaEngine.ReducedSizeRTCPNegotiated())
+
+			mediaEngine.ResetNegotiation()
+			assert.False(t, mediaEngine.ReducedSizeRTCPNegotiated())
+		})
+	}
+
+	t.Run("Renegotiated Without", func(t *testing.T) {
+		mediaEngine := MediaEngine{}
+		assert.NoError(t, mediaEngine.RegisterDefaultCodecs())
+
+		for _, test := range []struct {
+			sdp     string
+			reduced bool
+		}{
+			{offerSdp + "a=rtcp-rsize\n", true},
+			{offerSdp, false},
+		} {
+			s := mustParseSDP(t, test.sdp)
+			assert.NoError(t, mediaEngine.updateFromRemoteDescription(s))
+			assert.Equal(t, test.reduced, mediaEngine.ReducedSizeRTCPNegotiated())
+		}
+	})
+}
+
+func TestMediaEngineCodecsByMimeType(t *testing.T) {
+	mediaEngine := MediaEngine{}
+	fmtpLines := []string{
+		"packetization-mode=1;profile-level-id=42001f",
+		"packetization-mode=0;profile-level-id=42001f",
+		"packetization-mode=1;profile-level-id=42e01f",
+		"packetization-mode=0;profile-level-id=42e01f",
+	}
+	for i, fmtpLine := range fmtpLines {
+		assert.NoError(t, mediaEngine.RegisterCodec(RTPCodecParameters{
+			RTPCodecCapability: RTPCodecCapability{MimeTypeH264, 90000, 0, fmtpLine, []RTCPFeedback{{"nack", ""}}},
+			PayloadType:        PayloadType(102 + i),
+		}, RTPCodecTypeVideo))
+	}
+	assert.NoError(t, mediaEngine.RegisterCodec(RTPCodecParameters{
+		RTPCodecCapability: RTPCodecCapability{MimeTypeVP8, 90000, 0, "", nil},
+		PayloadType:        96,
+	}, RTPCodecTypeVideo))
+
+	matches := mediaEngine.CodecsByMimeType("video/h264", RTPCodecTypeVideo)
+	assert.Len(t, matches, 4)
+	for i, codec := range matches {
+		assert.Equal(t, PayloadType(102+i), codec.PayloadType)
+		assert.Equal(t, fmtpLines[i], codec.SDPFmtpLine)
+	}
+	assert.Empty(t, mediaEngine.CodecsByMimeType(MimeTypeH264, RTPCodecTypeAudio))
+
+	// Modifying the result doesn't affect the MediaEngine
+	matches[0].RTCPFeedback[0].Type = "ccm"
+	assert.Equal(t, "nack", mediaEngine.videoCodecs[0].RTCPFeedback[0].Type)
+}
+
+func TestMediaEngineTransportCCSendrecv(t *testing.T) {
+	const answerSdp = sdpHeader + `m=video 9 UDP/TLS/RTP/SAVPF 96
+a=extmap:3 http://www.ietf.org/id/draft-holmer-rmcat-transport-wide-cc-extensions-01
+a=sendrecv
+a=rtpmap:96 VP8/90000
+a=rtcp-fb:96 transport-cc
+`
+	transportCCCount := func(params RTPParameters) (count int) {
+		for _, extension := range params.HeaderExtensions {
+			if extension.URI == sdp.TransportCCURI {
+				count++
+			}
+		}
+
+		return count
+	}
+
+	mediaEngine := &MediaEngine{}
+	assert.NoError(t, mediaEngine.RegisterDefaultCodecs())
+	assert.NoError(t, mediaEngine.RegisterHeaderExtension(
+		RTPHeaderExtensionCapability{URI: sdp.TransportCCURI}, RTPCodecTypeVideo,
+	))
+	mediaEngine = mediaEngine.copy()
+
+	for _, directions := range [][]RTPTransceiverDirection{
+		{RTPTransceiverDirectionSendrecv},
+		{RTPTransceiverDirectionSendonly, RTPTransceiverDirectionRecvonly},
+	} {
+		assert.Equal(t, 1, transportCCCount(mediaEngine.getRTPParametersByKind(RTPCodecTypeVideo, directions)))
+	}
+
+	s := mustParseSDP(t, answerSdp)
+	assert.NoError(t, mediaEngine.updateFromRemoteDescription(s))
+
+	for _, directions := range [][]RTPTransceiverDirection{
+		{RTPTransceiverDirectionSendrecv},
+		{RTPTransceiverDirectionSendonly, RTPTransceiverDirectionRecvonly},
+		{RTPTransceiverDirectionSendonly},
+		{RTPTransceiverDirectionRecvonly},
+	} {
+		assert.Equal(t, 1, transportCCCount(mediaEngine.getRTPParametersByKind(RTPCodecTypeVideo, directions)))
+	}
+}
+
+func TestMediaEngineRangeCodecs(t *testing.T) {
+	rangeCodecs := func(mediaEngine *MediaEngine) []RTPCodecParameters {
+		var codecs []RTPCodecParameters
+		mediaEngine.RangeCodecs(RTPCodecTypeVideo, func(codec RTPCodecParameters) bool {
+			codecs = append(codecs, codec)
+
+			return true
+		})
+
+		return codecs
+	}
+
+	mediaEngine := &MediaEngine{}
+	assert.NoError(t, mediaEngine.RegisterDefaultCodecs())
+	assert.NoError(t, mediaEngine.SetCodecEnabled(MimeTypeVP9, RTPCodecTypeVideo, false))
+	assert.Equal(t, mediaEngine.getCodecsByKind(RTPCodecTypeVideo), rangeCodecs(mediaEngine))
+
+	visited := 0
+	mediaEngine.RangeCodecs(RTPCodecTypeVideo, func(RTPCodecParameters) bool {
+		visited++
+
+		return visited < 2
+	})
+	assert.Equal(t, 2, visited)
+
+	// The offer tag, seeded payload types and lazily registered codecs apply too
+	mediaEngine = &MediaEngine{}
+	assert.NoError(t, mediaEngine.RegisterCodecWithTags(RTPCodecParameters{
+		RTPCodecCapability: RTPCodecCapability{MimeType: MimeTypeVP8, ClockRate: 90000},
+		PayloadType:        96,
+	}, RTPCodecTypeVideo, "mobile"))
+	assert.NoError(t, mediaEngine.RegisterCodecFunc(func() RTPCodecParameters {
+		return RTPCodecParameters{
+			RTPCodecCapability: RTPCodecCapability{MimeType: MimeTypeVP9, ClockRate: 90000},
+			PayloadType:        98,
+		}
+	}, RTPCodecTypeVideo))
+	mediaEngine.SeedNegotiatedPayloadTypes(map[string]PayloadType{MimeTypeVP8: 100})
+	assert.Equal(t, []PayloadType{100, 98}, codecPayloadTypes(rangeCodecs(mediaEngine)))
+
+	mediaEngine.SetOfferTag("mobile")
+	assert.Equal(t, []PayloadType{100}, codecPayloadTypes(rangeCodecs(mediaEngine)))
+	assert.Equal(t, mediaEngine.getCodecsByKind(RTPCodecTypeVideo), rangeCodecs(mediaEngine))
+}
+
+func BenchmarkMediaEngineRangeCodecs(b *testing.B) {
+	const offerSdp = sdpHeader + `m=video 9 UDP/TLS/RTP/SAVPF 96 97
+a=rtpmap:96 VP8/90000
+a=rtpmap:97 rtx/90000
+a=fmtp:97 apt=96
+`
+
+	registered := &MediaEngine{}
+	assert.NoError(b, registered.RegisterDefaultCodecs())
+	assert.NoError(b, registered.SetCodecEnabled(MimeTypeVP9, RTPCodecTypeVideo, false))
+	negotiated := registered.copy()
+	desc := sdp.SessionDescription{}
+	assert.NoError(b, desc.UnmarshalString(offerSdp))
+	assert.NoError(b, negotiated.updateFromRemoteDescription(desc))
+
+	var payloadTypes int
+	for _, engine := range []struct {
+		name        string
+		mediaEngine *MediaEngine
+	}{
+		{"Registered", registered},
+		{"Negotiated", negotiated},
+	} {
+		b.Run(engine.name+"/RangeCodecs", func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				engine.mediaEngine.RangeCodecs(RTPCodecTypeVideo, func(codec RTPCodecParameters) bool {
+					payloadTypes += int(codec.PayloadType)
+
+					return true
+				})
+			}
+		})
+
+		b.Run(engine.name+"/getCodecsByKind", func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				for _, codec := range engine.mediaEngine.getCodecsByKind(RTPCodecTypeVideo) {
+					payloadTypes += int(codec.PayloadType)
+				}
+			}
+		})
+	}
+}
+
+func TestMediaEngineRenegotiationRemovesCodecs(t *testing.T) {
+	const vp8AndVP9 = `m=video 9 UDP/TLS/RTP/SAVPF 96 97 98 99
+a=mid:0
+a=rtpmap:96 VP8/90000
+a=rtpmap:97 rtx/90000
+a=fmtp:97 apt=96
+a=rtpmap:98 VP9/90000
+a=fmtp:98 profile-id=0
+a=rtpmap:99 rtx/90000
+a=fmtp:99 apt=98
+`
+	const vp8 = `m=video 9 UDP/TLS/RTP/SAVPF 96 97
+a=mid:0
+a=rtpmap:96 VP8/90000
+a=rtpmap:97 rtx/90000
+a=fmtp:97 apt=96
+`
+	const vp9 = `m=video 9 UDP/TLS/RTP/SAVPF 98
+a=mid:1
+a=rtpmap:98 VP9/90000
+a=fmtp:98 profile-id=0
+`
+
+	t.Run("Shrunk Codec Set", func(t *testing.T) {
+		mediaEngine := &MediaEngine{}
+		assert.NoError(t, mediaEngine.RegisterDefaultCodecs())
+		assert.NoError(t, mediaEngine.updateFromRemoteDescription(mustParseSDP(t, sdpHeader+vp8AndVP9)))
+		assert.Equal(t, []PayloadType{96, 97, 98, 99}, codecPayloadTypes(mediaEngine.negotiatedVideoCodecs))
+
+		assert.NoError(t, mediaEngine.updateFromRemoteDescription(mustParseSDP(t, sdpHeader+vp8)))
+		assert.Equal(t, []PayloadType{96, 97}, codecPayloadTypes(mediaEngine.negotiatedVideoCodecs))
+		_, ok := mediaEngine.NegotiatedMatchType(98, RTPCodecTypeVideo)
+		assert.False(t, ok)
+	})
+
+	t.Run("Codec Kept By Other Media Section", func(t *testing.T) {
+		mediaEngine := &MediaEngine{}
+		assert.NoError(t, mediaEngine.RegisterDefaultCodecs())
+		assert.NoError(t, mediaEngine.updateFromRemoteDescription(mustParseSDP(t, sdpHeader+vp8AndVP9+vp9)))
+		assert.Equal(t, []PayloadType{96, 97, 98, 99}, codecPayloadTypes(mediaEngine.negotiatedVideoCodecs))
+
+		// The second media section isn't part of this description and still uses VP9
+		assert.NoError(t, mediaEngine.updateFromRemoteDescription(mustParseSDP(t, sdpHeader+vp8)))
+		assert.Equal(t, []PayloadType{96, 97, 98}, codecPayloadTypes(mediaEngine.negotiatedVideoCodecs))
+	})
+}
+
+func TestMediaEngineAddReceiveAlternative(t *testing.T) {
+	const offerSdp = sdpHeader + `m=video 9 UDP/TLS/RTP/SAVPF 120
+a=rtpmap:120 H264/90000
+a=fmtp:120 packetization-mode=1;profile-level-id=640032
+`
+	for _, test := range []struct {
+		name      string
+		addAlt    bool
+		matchType CodecMatchType
+	}{
+		{"Without Alternative", false, CodecMatchPartial},
+		{"With Alternative", true, CodecMatchExact},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			mediaEngine := MediaEngine{}
+			assert.NoError(t, mediaEngine.RegisterCodec(RTPCodecParameters{
+				RTPCodecCapability: RTPCodecCapability{
+					MimeTypeH264, 90000, 0, "packetization-mode=1;profile-level-id=42e01f", nil,
+				},
+				PayloadType: 102,
+			}, RTPCodecTypeVideo))
+			if test.addAlt {
+				mediaEngine.AddReceiveAlternative(102, RTPCodecTypeVideo, "packetization-mode=1;profile-level-id=64001f")
+			}
+
+			// Alternatives aren't offered
+			params := mediaEngine.getRTPParametersByKind(RTPCodecTypeVideo, []RTPTransceiverDirection{
+				RTPTransceiverDirectionRecvonly,
+			})
+			assert.Len(t, params.Codecs, 1)
+			assert.Equal(t, "packetization-mode=1;profile-level-id=42e01f", params.Codecs[0].SDPFmtpLine)
+
+			s := mustParseSDP(t, offerSdp)
+			assert.NoError(t, mediaEngine.updateFromRemoteDescription(s))
+
+			matchType, ok := mediaEngine.NegotiatedMatchType(120, RTPCodecTypeVideo)
+			assert.True(t, ok)
+			assert.Equal(t, test.matchType, matchType)
+		})
+	}
+}
+
+func TestMediaEngineNegotiatedCodecsForDirection(t *testing.T) {
+	const offerSdp = sdpHeader + `m=video 9 UDP/TLS/RTP/SAVPF 120 121 50 51
+a=rtpmap:120 VP8/90000
+a=rtpmap:121 rtx/90000
+a=fmtp:121 apt=120
+a=rtpmap:50 H264/90000
+a=fmtp:50 level-asymmetry-allowed=1;packetization-mode=1;profile-level-id=42e01f
+a=rtpmap:51 rtx/90000
+a=fmtp:51 apt=50
+`
+	mediaEngine := MediaEngine{}
+	for _, codec := range []RTPCodecParameters{
+		{RTPCodecCapability: RTPCodecCapability{MimeTypeVP8, 90000, 0, "", nil}, PayloadType: 96},
+		{RTPCodecCapability: RTPCodecCapability{MimeTypeRTX, 90000, 0, "apt=96", nil}, PayloadType: 97},
+		{
+			RTPCodecCapability: RTPCodecCapability{
+				MimeTypeH264, 90000, 0, "level-asymmetry-allowed=1;packetization-mode=1;profile-level-id=42e01f", nil,
+			},
+			PayloadType: 102,
+		},
+		{RTPCodecCapability: RTPCodecCapability{MimeTypeRTX, 90000, 0, "apt=102", nil}, PayloadType: 103},
+	} {
+		assert.NoError(t, mediaEngine.RegisterCodec(codec, RTPCodecTypeVideo))
+	}
+	assert.NoError(t, mediaEngine.SetCodecDirection(102, RTPCodecTypeVideo, RTPTransceiverDirectionRecvonly))
+	assert.ErrorIs(t, mediaEngine.SetCodecDirection(102, RTPCodecTypeVideo, RTPTransceiverDirectionInactive),
+		ErrInvalidCodecDirection)
+	assert.ErrorIs(t, mediaEngine.SetCodecDirection(102, RTPCodecType(0), RTPTransceiverDirectionRecvonly), ErrUnknownType)
+
+	// Registered codecs before negotiation
+	assert.Equal(t, []PayloadType{96, 97},
+		codecPayloadTypes(mediaEngine.NegotiatedCodecsForDirection(RTPCodecTypeVideo, RTPTransceiverDirectionSendonly)))
+	assert.Equal(t, []PayloadType{96, 97, 102, 103},
+		codecPayloadTypes(mediaEngine.NegotiatedCodecsForDirection(RTPCodecTypeVideo, RTPTransceiverDirectionRecvonly)))
+
+	s := mustParseSDP(t, offerSdp)
+	assert.NoError(t, mediaEngine.updateFromRemoteDescription(s))
+
+	assert.Equal(t, []PayloadType{120, 121},
+		codecPayloadTypes(mediaEngine.NegotiatedCodecsForDirection(RTPCodecTypeVideo, RTPTransceiverDirectionSendonly)))
+	assert.Equal(t, []PayloadType{120, 121, 50, 51},
+		codecPayloadTypes(mediaEngine.NegotiatedCodecsForDirection(RTPCodecTypeVideo, RTPTransceiverDirectionRecvonly)))
+	assert.Equal(t, []PayloadType{120, 121},
+		codecPayloadTypes(mediaEngine.NegotiatedCodecsForDirection(RTPCodecTypeVideo, RTPTransceiverDirectionSendrecv)))
+	assert.Empty(t, mediaEngine.NegotiatedCodecsForDirection(RTPCodecTypeVideo, RTPTransceiverDirectionInactive))
+}
+
+func TestPayloaderForCodecError(t *testing.T) {
+	_, err := payloaderForCodec(RTPCodecCapability{MimeType: "video/unknown", ClockRate: 90000})
+	assert.ErrorIs(t, err, ErrNoPayloaderForCodec)
+	assert.Contains(t, err.Error(), "video/unknown")
+}
+
+func TestMediaEngineVideoContentType(t *testing.T) {
+	const offerSdp = sdpHeader + `m=video 9 UDP/TLS/RTP/SAVPF 96
+a=extmap:4 http://www.webrtc.org/experiments/rtp-hdrext/video-content-type
+a=rtpmap:96 VP8/90000
+`
+	mediaEngine := &MediaEngine{}
+	assert.NoError(t, mediaEngine.RegisterDefaultCodecs())
+	assert.ErrorIs(t, mediaEngine.RegisterHeaderExtension(
+		RTPHeaderExtensionCapability{URI: VideoContentTypeURI}, RTPCodecTypeAudio,
+	), ErrHeaderExtensionInvalidKind)
+	assert.NoError(t, mediaEngine.RegisterHeaderExtension(
+		RTPHeaderExtensionCapability{URI: VideoContentTypeURI}, RTPCodecTypeVideo,
+	))
+	mediaEngine = mediaEngine.copy()
+
+	s := mustParseSDP(t, offerSdp)
+	assert.NoError(t, mediaEngine.updateFromRemoteDescription(s))
+
+	id, ok := mediaEngine.HeaderExtensionID(VideoContentTypeURI, RTPCodecTypeVideo)
+	assert.True(t, ok)
+	assert.Equal(t, 4, id)
+
+	params := mediaEngine.getRTPParametersByKind(RTPCodecTypeVideo, []RTPTransceiverDirection{
+		RTPTransceiverDirectionSendonly,
+	})
+	assert.Contains(t, params.HeaderExtensions, RTPHeaderExtensionParameter{URI: VideoContentTypeURI, ID: 4})
+}
+
+func TestMediaEngineInvalidPayloadType(t *testing.T) {
+	for _, test := range []struct {
+		payloadType PayloadType
+		err         error
+	}{
+		{0, nil},
+		{96, nil},
+		{127, nil},
+		{128, ErrInvalidPayloadType},
+		{255, ErrInvalidPayloadType},
+	} {
+		mediaEngine := MediaEngine{}
+		err := mediaEngine.RegisterCodec(RTPCodecParameters{
+			RTPCodecCapability: RTPCodecCapability{MimeTypeOpus, 48000, 2, "", nil},
+			PayloadType:        test.payloadType,
+		}, RTPCodecTypeAudio)
+		assert.ErrorIs(t, err, test.err, "payload type %d", test.payloadType)
+	}
+}
+
+func TestMediaEngineResilienceCapabilities(t *testing.T) {
+	mediaEngine := MediaEngine{}
+	for _, codec := range []RTPCodecParameters{
+		{RTPCodecCapability: RTPCodecCapability{MimeTypeVP8, 90000, 0, "", nil}, PayloadType: 96},
+		{RTPCodecCapability: RTPCodecCapability{MimeTypeRTX, 90000, 0, "apt=96", nil}, PayloadType: 97},
+		{RTPCodecCapability: RTPCodecCapability{MimeTypeFlexFEC03, 90000, 0, "repair-window=10000000", nil}, PayloadType: 49},
+		{RTPCodecCapability: RTPCodecCapability{MimeTypeUlpFEC, 90000, 0, "", nil}, PayloadType: 50},
+	} {
+		assert.NoError(t, mediaEngine.RegisterCodec(codec, RTPCodecTypeVideo))
+	}
+	for _, codec := range []RTPCodecParameters{
+		{RTPCodecCapability: RTPCodecCapability{MimeTypeOpus, 48000, 2, "", nil}, PayloadType: 111},
+		{RTPCodecCapability: RTPCodecCapability{"audio/red", 48000, 2, "111/111", nil}, PayloadType: 63},
+	} {
+		assert.NoError(t, mediaEngine.RegisterCodec(codec, RTPCodecTypeAudio))
+	}
+
+	assert.Equal(t, ResilienceCaps{RTX: true, FlexFEC: true, UlpFEC: true},
+		mediaEngine.ResilienceCapabilities(RTPCodecTypeVideo))
+	assert.Equal(t, ResilienceCaps{RED: true}, mediaEngine.ResilienceCapabilities(RTPCodecTypeAudio))
+
+	// Disabled codecs can't be used
+	assert.NoError(t, mediaEngine.SetCodecEnabled(MimeTypeUlpFEC, RTPCodecTypeVideo, false))
+	assert.Equal(t, ResilienceCaps{RTX: true, FlexFEC: true}, mediaEngine.ResilienceCapabilities(RTPCodecTypeVideo))
+}
+
+func TestMediaEngineValidateHeaderExtensions(t *testing.T) {
+	mediaEngine := MediaEngine{}
+	assert.NoError(t, mediaEngine.ValidateHeaderExtensions())
+
+	assert.NoError(t, mediaEngine.RegisterHeaderExtension(
+		RTPHeaderExtensionCapability{URI: sdp.SDESRepairRTPStreamIDURI}, RTPCodecTypeVideo,
+	))
+	err := mediaEngine.ValidateHeaderExtensions()
+	assert.ErrorIs(t, err, ErrRepairedStreamIDWithoutStreamID)
+	assert.Contains(t, err.Error(), "video")
+
+	// rtp-stream-id registered for another kind doesn't help
+	assert.NoError(t, mediaEngine.RegisterHeaderExtension(
+		RTPHeaderExtensionCapability{URI: sdp.SDESRTPStreamIDURI}, RTPCodecTypeAudio,
+	))
+	assert.ErrorIs(t, mediaEngine.ValidateHeaderExtensions(), ErrRepairedStreamIDWithoutStreamID)
+
+	assert.NoError(t, mediaEngine.RegisterHeaderExtension(
+		RTPHeaderExtensionCapability{URI: sdp.SDESRTPStreamIDURI}, RTPCodecTypeVideo,
+	))
+	assert.NoError(t, mediaEngine.ValidateHeaderExtensions())
+}
+
+func TestMediaEngineOnCodecMatch(t *testing.T) {
+	const offerSdp = sdpHeader + `m=video 9 UDP/TLS/RTP/SAVPF 51 50 120 121
+a=rtpmap:51 rtx/90000
+a=fmtp:51 apt=50
+a=rtpmap:50 VP8/90000
+a=rtpmap:120 H264/90000
+a=fmtp:120 packetization-mode=1;profile-level-id=640032
+a=rtpmap:121 unknown/90000
+`
+	mediaEngine := MediaEngine{}
+	for _, codec := range []RTPCodecParameters{
+		{RTPCodecCapability: RTPCodecCapability{MimeTypeVP8, 90000, 0, "", nil}, PayloadType: 96},
+		{RTPCodecCapability: RTPCodecCapability{MimeTypeRTX, 90000, 0, "apt=96", nil}, PayloadType: 97},
+		{
+			RTPCodecCapability: RTPCodecCapability{
+				MimeTypeH264, 90000, 0, "packetization-mode=1;profile-level-id=42e01f", nil,
+			},
+			PayloadType: 102,
+		},
+	} {
+		assert.NoError(t, mediaEngine.RegisterCodec(codec, RTPCodecTypeVideo))
+	}
+
+	type codecMatch struct {
+		remote, local PayloadType
+		matchType     CodecMatchType
+	}
+	matches := []codecMatch{}
+	mediaEngine.OnCodecMatch(func(remote, local RTPCodecParameters, matchType CodecMatchType) {
+		// Called without the lock held
+		mediaEngine.RangeCodecs(RTPCodecTypeVideo, func(RTPCodecParameters) bool { return false })
+		matches = append(matches, codecMatch{remote.PayloadType, local.PayloadType, matchType})
+	})
+
+	s := mustParseSDP(t, offerSdp)
+	assert.NoError(t, mediaEngine.updateFromRemoteDescription(s))
+
+	// One call per remote codec, RTX listed before its primary codec is matched too
+	assert.Equal(t, []codecMatch{
+		{51, 97, CodecMatchExact},
+		{50, 96, CodecMatchExact},
+		{120, 102, CodecMatchPartial},
+		{121, 0, CodecMatchNone},
+	}, matches)
+}
+
+func TestMediaEngineRTPClockRate(t *testing.T) {
+	mediaEngine := MediaEngine{}
+	assert.NoError(t, mediaEngine.RegisterDefaultCodecs())
+
+	assert.Equal(t, uint32(48000), mediaEngine.RTPClockRate(MimeTypeOpus))
+	assert.Equal(t, uint32(90000), mediaEngine.RTPClockRate(MimeTypeVP8))
+	assert.Equal(t, uint32(0), mediaEngine.RTPClockRate("audio/unknown"))
+
+	// G722 samples at 16000Hz but its RTP timestamps advance at 8000Hz, even if
+	// the codec was registered with its sample rate
+	const g722SampleRate = 16000
+	assert.Equal(t, uint32(8000), mediaEngine.RTPClockRate(MimeTypeG722))
+
+	mediaEngine = MediaEngine{}
+	assert.NoError(t, mediaEngine.RegisterCodec(RTPCodecParameters{
+		RTPCodecCapability: RTPCodecCapability{MimeTypeG722, g722SampleRate, 0, "", nil},
+		PayloadType:        9,
+	}, RTPCodecTypeAudio))
+	assert.Equal(t, uint32(8000), mediaEngine.RTPClockRate("audio/g722"))
+
+	// The registered codec is left as is
+	codec, _, err := mediaEngine.getCodecByPayload(9)
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(g722SampleRate), codec.ClockRate)
+}
+
+func TestMediaEngineRestrictHeaderExtensionToCodecs(t *testing.T) {
+	const offerSdp = sdpHeader + `m=video 9 UDP/TLS/RTP/SAVPF %s
+a=extmap:5 https://aomediacodec.github.io/av1-rtp-spec/#dependency-descriptor-rtp-header-extension
+%s
+`
+	for _, test := range []struct {
+		name    string
+		formats string
+		rtpmap  string
+		present bool
+	}{
+		{"AV1 Negotiated", "45", "a=rtpmap:45 AV1/90000", true},
+		{"AV1 Not Negotiated", "96", "a=rtpmap:96 VP8/90000", false},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			mediaEngine := &MediaEngine{}
+			assert.NoError(t, mediaEngine.RegisterDefaultCodecs())
+			assert.NoError(t, mediaEngine.RegisterHeaderExtension(
+				RTPHeaderExtensionCapability{URI: DependencyDescriptorURI}, RTPCodecTypeVideo,
+			))
+			mediaEngine.RestrictHeaderExtensionToCodecs(DependencyDescriptorURI, []string{MimeTypeAV1})
+			mediaEngine = mediaEngine.copy()
+
+			// Offered since AV1 is registered
+			params := mediaEngine.getRTPParametersByKind(RTPCodecTypeVideo, []RTPTransceiverDirection{
+				RTPTransceiverDirectionSendonly,
+			})
+			assert.Len(t, params.HeaderExtensions, 1)
+
+			s := mustParseSDP(t, fmt.Sprintf(offerSdp, test.formats, test.rtpmap))
+			assert.NoError(t, mediaEngine.updateFromRemoteDescription(s))
+
+			params = mediaEngine.getRTPParametersByKind(RTPCodecTypeVideo, []RTPTransceiverDirection{
+				RTPTransceiverDirectionSendonly,
+			})
+			if test.present {
+				assert.Equal(t, []RTPHeaderExtensionParameter{{URI: DependencyDescriptorURI, ID: 5}}, params.HeaderExtensions)
+			} else {
+				assert.Empty(t, params.HeaderExtensions)
+			}
+		})
+	}
+
+	// Without AV1 registered it isn't offered either
+	mediaEngine := MediaEngine{}
+	assert.NoError(t, mediaEngine.RegisterCodec(RTPCodecParameters{
+		RTPCodecCapability: RTPCodecCapability{MimeTypeVP8, 90000, 0, "", nil},
+		PayloadType:        96,
+	}, RTPCodecTypeVideo))
+	assert.NoError(t, mediaEngine.RegisterHeaderExtension(
+		RTPHeaderExtensionCapability{URI: DependencyDescriptorURI}, RTPCodecTypeVideo,
+	))
+	mediaEngine.RestrictHeaderExtensionToCodecs(DependencyDescriptorURI, []string{MimeTypeAV1})
+	assert.Empty(t, mediaEngine.getRTPParametersByKind(RTPCodecTypeVideo, []RTPTransceiverDirection{
+		RTPTransceiverDirectionSendonly,
+	}).HeaderExtensions)
+
+	mediaEngine.RestrictHeaderExtensionToCodecs(DependencyDescriptorURI, nil)
+	assert.Len(t, mediaEngine.getRTPParametersByKind(RTPCodecTypeVideo, []RTPTransceiverDirection{
+		RTPTransceiverDirectionSendonly,
+	}).HeaderExtensions, 1)
+}
+
+func TestMediaEngineAutoRegisterRTX(t *testing.T) {
+	nack := []RTCPFeedback{{Type: TypeRTCPFBNACK}, {Type: TypeRTCPFBNACK, Parameter: "pli"}}
+
+	mediaEngine := MediaEngine{}
+	for _, codec := range []RTPCodecParameters{
+		{RTPCodecCapability: RTPCodecCapability{MimeTypeVP8, 90000, 0, "", nack}, PayloadType: 96},
+		{RTPCodecCapability: RTPCodecCapability{MimeTypeVP9, 90000, 0, "profile-id=0", nack}, PayloadType: 98},
+		{RTPCodecCapability: RTPCodecCapability{MimeTypeAV1, 90000, 0, "", nack}, PayloadType: 45},
+		// Already has an RTX codec
+		{RTPCodecCapability: RTPCodecCapability{MimeTypeH264, 90000, 0, "", nack}, PayloadType: 102},
+		{RTPCodecCapability: RTPCodecCapability{MimeTypeRTX, 90000, 0, "apt=102", nil}, PayloadType: 103},
+		// Without nack
+		{RTPCodecCapability: RTPCodecCapability{MimeTypeH265, 90000, 0, "", nil}, PayloadType: 49},
+	} {
+		assert.NoError(t, mediaEngine.RegisterCodec(codec, RTPCodecTypeVideo))
+	}
+
+	assert.NoError(t, mediaEngine.AutoRegisterRTX(RTPCodecTypeVideo))
+
+	rtxCodecs := mediaEngine.CodecsByMimeType(MimeTypeRTX, RTPCodecTypeVideo)
+	assert.Len(t, rtxCodecs, 4)
+	for _, test := range []struct {
+		payloadType, rtxPayloadType PayloadType
+	}{
+		{96, 97},
+		{98, 99},
+		{45, 100},
+		{102, 103},
+	} {
+		rtxPayloadType := findRTXPayloadType(test.payloadType, mediaEngine.videoCodecs)
+		assert.Equal(t, test.rtxPayloadType, rtxPayloadType)
+	}
+	assert.Zero(t, findRTXPayloadType(49, mediaEngine.videoCodecs))
+
+	// Calling it again doesn't add more RTX codecs
+	assert.NoError(t, mediaEngine.AutoRegisterRTX(RTPCodecTypeVideo))
+	assert.Len(t, mediaEngine.CodecsByMimeType(MimeTypeRTX, RTPCodecTypeVideo), 4)
+
+	assert.ErrorIs(t, mediaEngine.AutoRegisterRTX(RTPCodecTypeUnknown), ErrUnknownType)
+}
+
+func TestMediaEngineCodecsWithFeedback(t *testing.T) {
+	mediaEngine := MediaEngine{}
+	assert.NoError(t, mediaEngine.RegisterDefaultCodecs())
+
+	// Every video codec but RTX has nack
+	codecs := mediaEngine.CodecsWithFeedback(RTCPFeedback{Type: TypeRTCPFBNACK}, RTPCodecTypeVideo)
+	expected := slices.DeleteFunc(slices.Clone(mediaEngine.videoCodecs), func(c RTPCodecParameters) bool {
+		return c.MimeType == MimeTypeRTX
+	})
+	assert.NotEmpty(t, codecs)
+	assert.Equal(t, expected, codecs)
+
+	assert.Empty(t, mediaEngine.CodecsWithFeedback(RTCPFeedback{Type: TypeRTCPFBNACK}, RTPCodecTypeAudio))
+	assert.Empty(t, mediaEngine.CodecsWithFeedback(RTCPFeedback{Type: TypeRTCPFBTransportCC}, RTPCodecTypeVideo))
+
+	// Copies are returned
+	codecs[0].RTCPFeedback[0] = RTCPFeedback{Type: "changed"}
+	assert.NotEqual(t, "changed", mediaEngine.videoCodecs[0].RTCPFeedback[0].Type)
+}
+
+func TestMediaEngineMissingClockRate(t *testing.T) {
+	const offerSdp = sdpHeader + `m=audio 9 RTP/AVP 0
+a=rtpmap:0 PCMU
+`
+	mediaEngine := MediaEngine{}
+	assert.NoError(t, mediaEngine.RegisterDefaultCodecs())
+
+	s := mustParseSDP(t, offerSdp)
+	assert.NoError(t, mediaEngine.updateFromRemoteDescription(s))
+
+	codec, _, err := mediaEngine.getCodecByPayload(0)
+	assert.NoError(t, err)
+	assert.Equal(t, MimeTypePCMU, codec.MimeType)
+	assert.Equal(t, uint32(8000), codec.ClockRate)
+
+	matchType, ok := mediaEngine.NegotiatedMatchType(0, RTPCodecTypeAudio)
+	assert.True(t, ok)
+	assert.Equal(t, CodecMatchExact, matchType)
+}
+
+func TestMediaEngineRestrictFECToCodecs(t *testing.T) {
+	vp8 := RTPCodecParameters{RTPCodecCapability: RTPCodecCapability{MimeTypeVP8, 90000, 0, "", nil}, PayloadType: 96}
+	av1 := RTPCodecParameters{RTPCodecCapability: RTPCodecCapability{MimeTypeAV1, 90000, 0, "", nil}, PayloadType: 45}
+	flexFEC := RTPCodecParameters{
+		RTPCodecCapability: RTPCodecCapability{MimeTypeFlexFEC03, 90000, 0, "repair-window=10000000", nil},
+		PayloadType:        49,
+	}
+
+	mediaEngine := &MediaEngine{}
+	for _, codec := range []RTPCodecParameters{vp8, av1, flexFEC} {
+		assert.NoError(t, mediaEngine.RegisterCodec(codec, RTPCodecTypeVideo))
+	}
+	mediaEngine.RestrictFECToCodecs(MimeTypeFlexFEC03, []string{MimeTypeAV1})
+	api := NewAPI(WithMediaEngine(mediaEngine))
+
+	// Offered alongside AV1
+	transceiver := RTPTransceiver{kind: RTPCodecTypeVideo, api: api}
+	assert.Equal(t, []PayloadType{96, 45, 49}, codecPayloadTypes(transceiver.getCodecs()))
+	assert.NoError(t, transceiver.SetCodecPreferences([]RTPCodecParameters{av1, flexFEC}))
+	assert.Equal(t, []PayloadType{45, 49}, codecPayloadTypes(transceiver.getCodecs()))
+
+	// But not with VP8 only
+	assert.NoError(t, transceiver.SetCodecPreferences([]RTPCodecParameters{vp8, flexFEC}))
+	assert.Equal(t, []PayloadType{96}, codecPayloadTypes(transceiver.getCodecs()))
+
+	// Lifting the restriction
+	api.mediaEngine.RestrictFECToCodecs(MimeTypeFlexFEC03, nil)
+	assert.Equal(t, []PayloadType{96, 49}, codecPayloadTypes(transceiver.getCodecs()))
+}
+
+func TestMediaEnginePayloadTypeRemapping(t *testing.T) {
+	const offerSdp = sdpHeader + `m=video 9 UDP/TLS/RTP/SAVPF 96
+a=mid:0
+a=rtpmap:96 %s
+`
+	mediaEngine := MediaEngine{}
+	assert.NoError(t, mediaEngine.RegisterDefaultCodecs())
+
+	apply := func(rtpmap string) error {
+		s := mustParseSDP(t, fmt.Sprintf(offerSdp, rtpmap))
+
+		return mediaEngine.updateFromRemoteDescription(s)
+	}
+
+	assert.NoError(t, apply("VP8/90000"))
+	version := mediaEngine.NegotiationVersion()
+	codec, _, err := mediaEngine.getCodecByPayload(96)
+	assert.NoError(t, err)
+	assert.Equal(t, MimeTypeVP8, codec.MimeType)
+
+	// The remote now uses PT 96 for VP9
+	assert.NoError(t, apply("VP9/90000"))
+	assert.Greater(t, mediaEngine.NegotiationVersion(), version)
+	codec, _, err = mediaEngine.getCodecByPayload(96)
+	assert.NoError(t, err)
+	assert.Equal(t, MimeTypeVP9, codec.MimeType)
+	assert.Len(t, mediaEngine.negotiatedVideoCodecs, 1)
+
+	// Reusing a payload type for two codecs in the same description is still an error
+	const conflictSdp = sdpHeader + `m=video 9 UDP/TLS/RTP/SAVPF 96
+a=mid:0
+a=rtpmap:96 VP9/90000
+m=video 9 UDP/TLS/RTP/SAVPF 96
+a=mid:1
+a=rtpmap:96 H264/90000
+`
+	mediaEngine.setMultiCodecNegotiation(true)
+	s := mustParseSDP(t, conflictSdp)
+	assert.ErrorIs(t, mediaEngine.updateFromRemoteDescription(s), ErrCodecAlreadyRegistered)
+}
+
+func TestMediaEnginePreflightRemoteDescription(t *testing.T) {
+	const offerSdp = sdpHeader + `m=audio 9 UDP/TLS/RTP/SAVPF 111
+a=rtpmap:111 opus/48000/2
+m=video 9 UDP/TLS/RTP/SAVPF 120 121
+a=rtpmap:120 unknown/90000
+a=rtpmap:121 other/90000
+m=video 9 UDP/TLS/RTP/SAVPF 122
+a=rtpmap:122 VP8/abc
+m=application 9 UDP/DTLS/SCTP webrtc-datachannel
+`
+	mediaEngine := MediaEngine{}
+	assert.NoError(t, mediaEngine.RegisterDefaultCodecs())
+
+	s := mustParseSDP(t, offerSdp)
+
+	err := mediaEngine.PreflightRemoteDescription(s)
+	assert.ErrorIs(t, err, ErrNoCommonCodecs)
+	assert.Contains(t, err.Error(), "media section 1 (video): no codec in common with the remote, "+
+		"remote offered video/unknown (120), video/other (121)")
+	assert.Contains(t, err.Error(), "media section 2 (video): payload type 122")
+	assert.NotContains(t, err.Error(), "media section 0")
+
+	// Nothing was negotiated
+	assert.False(t, mediaEngine.negotiatedAudio)
+	assert.False(t, mediaEngine.negotiatedVideo)
+	assert.Empty(t, mediaEngine.UnmatchedRemoteCodecs())
+
+	s = mustParseSDP(t, strings.SplitN(offerSdp, "m=video", 2)[0])
+	assert.NoError(t, mediaEngine.PreflightRemoteDescription(s))
+}
+
+func TestMediaEnginePreflightRemoteDescriptionSkippedSections(t *testing.T) {
+	const offerSdp = sdpHeader + `m=audio 9 UDP/TLS/RTP/SAVPF 111
+a=rtpmap:111 opus/48000/2
+m=video 9 UDP/TLS/RTP/SAVPF 120
+a=inactive
+a=rtpmap:120 unknown/90000
+m=video 0 UDP/TLS/RTP/SAVPF 0
+`
+	const badExtmapSdp = sdpHeader + `m=audio 9 UDP/TLS/RTP/SAVPF 111
+a=extmap:abc urn:ietf:params:rtp-hdrext:ssrc-audio-level
+a=rtpmap:111 opus/48000/2
+`
+
+	mediaEngine := MediaEngine{}
+	assert.NoError(t, mediaEngine.RegisterDefaultCodecs())
+
+	// Sections applying skips don't fail preflight
+	assert.NoError(t, mediaEngine.PreflightRemoteDescription(mustParseSDP(t, offerSdp)))
+	assert.NoError(t, mediaEngine.copy().updateFromRemoteDescription(mustParseSDP(t, offerSdp)))
+
+	// Header extensions that fail applying fail preflight too
+	err := mediaEngine.PreflightRemoteDescription(mustParseSDP(t, badExtmapSdp))
+	assert.ErrorContains(t, err, "media section 0 (audio)")
+	assert.Error(t, mediaEngine.copy().updateFromRemoteDescription(mustParseSDP(t, badExtmapSdp)))
+}
+
+func TestMediaEngineMaxFrameRate(t *testing.T) {
+	const offerSdp = sdpHeader + `m=video 9 UDP/TLS/RTP/SAVPF 120 121
+a=rtpmap:120 VP8/90000
+a=fmtp:120 max-fr=30;max-fs=3600
+a=rtpmap:121 H264/90000
+a=fmtp:121 packetization-mode=1;profile-level-id=42e01f;max-fr=60
+`
+	mediaEngine := MediaEngine{}
+	for _, codec := range []RTPCodecParameters{
+		{RTPCodecCapability: RTPCodecCapability{MimeTypeVP8, 90000, 0, "max-fr=15", nil}, PayloadType: 96},
+		{
+			RTPCodecCapability: RTPCodecCapability{
+				MimeTypeH264, 90000, 0, "packetization-mode=1;profile-level-id=42e01f;max-fr=15;max-fs=1200", nil,
+			},
+			PayloadType: 102,
+		},
+	} {
+		assert.NoError(t, mediaEngine.RegisterCodec(codec, RTPCodecTypeVideo))
+	}
+
+	s := mustParseSDP(t, offerSdp)
+	assert.NoError(t, mediaEngine.updateFromRemoteDescription(s))
+
+	for _, test := range []struct {
+		payloadType PayloadType
+		fmtpLine    string
+	}{
+		{120, "max-fr=15;max-fs=3600"},
+		{121, "packetization-mode=1;profile-level-id=42e01f;max-fr=15;max-fs=1200"},
+	} {
+		matchType, ok := mediaEngine.NegotiatedMatchType(test.payloadType, RTPCodecTypeVideo)
+		assert.True(t, ok)
+		assert.Equal(t, CodecMatchExact, matchType)
+
+		codec, _, err := mediaEngine.getCodecByPayload(test.payloadType)
+		assert.NoError(t, err)
+		assert.Equal(t, test.fmtpLine, codec.SDPFmtpLine)
+	}
+}
+
+func TestMediaEngineConfigFingerprint(t *testing.T) {
+	opus := RTPCodecParameters{
+		RTPCodecCapability: RTPCodecCapability{MimeTypeOpus, 48000, 2, "minptime=10;useinbandfec=1", nil},
+		PayloadType:        111,
+	}
+	vp8 := RTPCodecParameters{
+		RTPCodecCapability: RTPCodecCapability{
+			MimeTypeVP8, 90000, 0, "", []RTCPFeedback{{Type: TypeRTCPFBNACK}, {Type: TypeRTCPFBGoogREMB}},
+		},
+		PayloadType: 96,
+	}
+	vp8ReorderedFeedback := vp8
+	vp8ReorderedFeedback.RTCPFeedback = []RTCPFeedback{{Type: TypeRTCPFBGoogREMB}, {Type: TypeRTCPFBNACK}}
+	h264 := RTPCodecParameters{
+		RTPCodecCapability: RTPCodecCapability{
+			MimeTypeH264, 90000, 0, "packetization-mode=1;profile-level-id=42e01f", nil,
+		},
+		PayloadType: 102,
+	}
+
+	build := func(audio, video []RTPCodecParameters, extensions []string) *MediaEngine {
+		mediaEngine := &MediaEngine{}
+		for _, codec := range audio {
+			assert.NoError(t, mediaEngine.RegisterCodec(codec, RTPCodecTypeAudio))
+		}
+		for _, codec := range video {
+			assert.NoError(t, mediaEngine.RegisterCodec(codec, RTPCodecTypeVideo))
+		}
+		for _, uri := range extensions {
+			assert.NoError(t, mediaEngine.RegisterHeaderExtension(RTPHeaderExtensionCapability{URI: uri}, RTPCodecTypeVideo))
+		}
+
+		return mediaEngine
+	}
+
+	fingerprint := build(
+		[]RTPCodecParameters{opus}, []RTPCodecParameters{vp8, h264}, []string{sdp.SDESMidURI, sdp.TransportCCURI},
+	).ConfigFingerprint()
+	assert.Len(t, fingerprint, 64)
+
+	// Registering in another order, at another time, doesn't matter
+	time.Sleep(time.Millisecond)
+	assert.Equal(t, fingerprint, build(
+		[]RTPCodecParameters{opus}, []RTPCodecParameters{h264, vp8ReorderedFeedback},
+		[]string{sdp.TransportCCURI, sdp.SDESMidURI},
+	).ConfigFingerprint())
+
+	changedH264 := h264
+	changedH264.SDPFmtpLine = "packetization-mode=0;profile-level-id=42e01f"
+	assert.NotEqual(t, fingerprint, build(
+		[]RTPCodecParameters{opus}, []RTPCodecParameters{vp8, changedH264}, []string{sdp.SDESMidURI, sdp.TransportCCURI},
+	).ConfigFingerprint())
+	assert.NotEqual(t, fingerprint, build(
+		[]RTPCodecParameters{opus}, []RTPCodecParameters{vp8, h264}, []string{sdp.SDESMidURI},
+	).ConfigFingerprint())
+}
+
+func TestMediaEngineVideoTiming(t *testing.T) {
+	const offerSdp = sdpHeader + `m=video 9 UDP/TLS/RTP/SAVPF 96
+a=extmap:6 http://www.webrtc.org/experiments/rtp-hdrext/video-timing
+a=rtpmap:96 VP8/90000
+`
+	mediaEngine := &MediaEngine{}
+	assert.NoError(t, mediaEngine.RegisterDefaultCodecs())
+	assert.ErrorIs(t, mediaEngine.RegisterHeaderExtension(
+		RTPHeaderExtensionCapability{URI: VideoTimingURI}, RTPCodecTypeAudio,
+	), ErrHeaderExtensionInvalidKind)
+	assert.NoError(t, mediaEngine.RegisterHeaderExtension(
+		RTPHeaderExtensionCapability{URI: VideoTimingURI}, RTPCodecTypeVideo,
+	))
+	mediaEngine = mediaEngine.copy()
+
+	s := mustParseSDP(t, offerSdp)
+	assert.NoError(t, mediaEngine.updateFromRemoteDescription(s))
+
+	id, ok := mediaEngine.HeaderExtensionID(VideoTimingURI, RTPCodecTypeVideo)
+	assert.True(t, ok)
+	assert.Equal(t, 6, id)
+
+	params := mediaEngine.getRTPParametersByKind(RTPCodecTypeVideo, []RTPTransceiverDirection{
+		RTPTransceiverDirectionSendonly,
+	})
+	assert.Contains(t, params.HeaderExtensions, RTPHeaderExtensionParameter{URI: VideoTimingURI, ID: 6})
+}
+
+func TestMediaEngineVideoLayersAllocation(t *testing.T) {
+	const offerSdp = sdpHeader + `m=video 9 UDP/TLS/RTP/SAVPF 96
+a=extmap:9 http://www.webrtc.org/experiments/rtp-hdrext/video-layers-allocation00
+a=rtpmap:96 VP8/90000
+`
+	mediaEngine := &MediaEngine{}
+	assert.NoError(t, mediaEngine.RegisterDefaultCodecs())
+	assert.ErrorIs(t, mediaEngine.RegisterHeaderExtension(
+		RTPHeaderExtensionCapability{URI: VideoLayersAllocationURI}, RTPCodecTypeAudio,
+	), ErrHeaderExtensionInvalidKind)
+	assert.NoError(t, mediaEngine.RegisterHeaderExtension(
+		RTPHeaderExtensionCapability{URI: VideoLayersAllocationURI}, RTPCodecTypeVideo,
+	))
+	mediaEngine = mediaEngine.copy()
+
+	s := mustParseSDP(t, offerSdp)
+	assert.NoError(t, mediaEngine.updateFromRemoteDescription(s))
+
+	id, ok := mediaEngine.HeaderExtensionID(VideoLayersAllocationURI, RTPCodecTypeVideo)
+	assert.True(t, ok)
+	assert.Equal(t, 9, id)
+
+	params := mediaEngine.getRTPParametersByKind(RTPCodecTypeVideo, []RTPTransceiverDirection{
+		RTPTransceiverDirectionRecvonly,
+	})
+	assert.Contains(t, params.HeaderExtensions, RTPHeaderExtensionParameter{URI: VideoLayersAllocationURI, ID: 9})
+}
+
+func TestMediaEngineEncryptedHeaderExtension(t *testing.T) {
+	const offerSdp = sdpHeader + `m=audio 9 UDP/TLS/RTP/SAVPF 111
+a=extmap:1 urn:ietf:params:rtp-hdrext:ssrc-audio-level
+a=extmap:4 urn:ietf:params:rtp-hdrext:encrypt urn:ietf:params:rtp-hdrext:ssrc-audio-level
+a=rtpmap:111 opus/48000/2
+`
+
+	mediaEngine := &MediaEngine{}
+	assert.NoError(t, mediaEngine.RegisterDefaultCodecs())
+
+	// The encrypted form of a remote offer isn't negotiated, the unencrypted one is
+	assert.NoError(t, mediaEngine.RegisterHeaderExtension(
+		RTPHeaderExtensionCapability{URI: sdp.AudioLevelURI}, RTPCodecTypeAudio,
+	))
+	assert.NoError(t, mediaEngine.updateFromRemoteDescription(mustParseSDP(t, offerSdp)))
+	assert.Equal(t, []RTPHeaderExtensionParameter{{URI: sdp.AudioLevelURI, ID: 1}},
+		mediaEngine.getRTPParametersByKind(RTPCodecTypeAudio, []RTPTransceiverDirection{
+			RTPTransceiverDirectionRecvonly,
+		}).HeaderExtensions)
+}
+
+func TestMediaEngineAbsCaptureTime(t *testing.T) {
+	const offerSdp = sdpHeader + `m=audio 9 UDP/TLS/RTP/SAVPF 111
+a=extmap:7 http://www.webrtc.org/experiments/rtp-hdrext/abs-capture-time
+a=rtpmap:111 opus/48000/2
+m=video 9 UDP/TLS/RTP/SAVPF 96
+a=rtpmap:96 VP8/90000
+`
+	mediaEngine := &MediaEngine{}
+	assert.NoError(t, mediaEngine.RegisterDefaultCodecs())
+	for _, typ := range []RTPCodecType{RTPCodecTypeAudio, RTPCodecTypeVideo} {
+		assert.NoError(t, mediaEngine.RegisterHeaderExtension(RTPHeaderExtensionCapability{URI: AbsCaptureTimeURI}, typ))
+	}
+
+	// Offered for both kinds
+	sendonly := []RTPTransceiverDirection{RTPTransceiverDirectionSendonly}
+	for _, typ := range []RTPCodecType{RTPCodecTypeAudio, RTPCodecTypeVideo} {
+		params := mediaEngine.copy().getRTPParametersByKind(typ, sendonly)
+		assert.True(t, slices.ContainsFunc(params.HeaderExtensions, func(e RTPHeaderExtensionParameter) bool {
+			return e.URI == AbsCaptureTimeURI
+		}), typ)
+	}
+
+	// Only negotiated for the audio section that declares it
+	mediaEngine = mediaEngine.copy()
+	s := mustParseSDP(t, offerSdp)
+	assert.NoError(t, mediaEngine.updateFromRemoteDescription(s))
+
+	id, ok := mediaEngine.HeaderExtensionID(AbsCaptureTimeURI, RTPCodecTypeAudio)
+	assert.True(t, ok)
+	assert.Equal(t, 7, id)
+	assert.Contains(t, mediaEngine.getRTPParametersByKind(RTPCodecTypeAudio, sendonly).HeaderExtensions,
+		RTPHeaderExtensionParameter{URI: AbsCaptureTimeURI, ID: 7})
+
+	_, ok = mediaEngine.HeaderExtensionID(AbsCaptureTimeURI, RTPCodecTypeVideo)
+	assert.False(t, ok)
+	assert.Empty(t, mediaEngine.getRTPParametersByKind(RTPCodecTypeVideo, sendonly).HeaderExtensions)
+}
+
+func TestMediaEngineCSRCAudioLevel(t *testing.T) {
+	const offerSdp = sdpHeader + `m=audio 9 UDP/TLS/RTP/SAVPF 111
+a=extmap:1 urn:ietf:params:rtp-hdrext:ssrc-audio-level
+a=extmap:5 urn:ietf:params:rtp-hdrext:csrc-audio-level
+a=rtpmap:111 opus/48000/2
+`
+	mediaEngine := &MediaEngine{}
+	assert.NoError(t, mediaEngine.RegisterDefaultCodecs())
+	assert.ErrorIs(t, mediaEngine.RegisterHeaderExtension(
+		RTPHeaderExtensionCapability{URI: CSRCAudioLevelURI}, RTPCodecTypeVideo,
+	), ErrHeaderExtensionInvalidKind)
+	for _, uri := range []string{sdp.AudioLevelURI, CSRCAudioLevelURI} {
+		assert.NoError(t, mediaEngine.RegisterHeaderExtension(RTPHeaderExtensionCapability{URI: uri}, RTPCodecTypeAudio))
+	}
+	mediaEngine = mediaEngine.copy()
+
+	s := mustParseSDP(t, offerSdp)
+	assert.NoError(t, mediaEngine.updateFromRemoteDescription(s))
+
+	id, ok := mediaEngine.HeaderExtensionID(CSRCAudioLevelURI, RTPCodecTypeAudio)
+	assert.True(t, ok)
+	assert.Equal(t, 5, id)
+
+	params := mediaEngine.getRTPParametersByKind(
+		RTPCodecTypeAudio, []RTPTransceiverDirection{RTPTransceiverDirectionRecvonly},
+	)
+	assert.Contains(t, params.HeaderExtensions, RTPHeaderExtensionParameter{URI: CSRCAudioLevelURI, ID: 5})
+	assert.Contains(t, params.HeaderExtensions, RTPHeaderExtensionParameter{URI: sdp.AudioLevelURI, ID: 1})
+}
+
+func TestMediaEngineForceSingleCodec(t *testing.T) {
+	mediaEngine := MediaEngine{}
+	assert.NoError(t, mediaEngine.RegisterDefaultCodecs())
+	audioCodecs := slices.Clone(mediaEngine.audioCodecs)
+
+	assert.NoError(t, mediaEngine.ForceSingleCodec("video/vp8", RTPCodecTypeVideo))
+	assert.Len(t, mediaEngine.videoCodecs, 2)
+	assert.Equal(t, MimeTypeVP8, mediaEngine.videoCodecs[0].MimeType)
+	assert.Equal(t, MimeTypeRTX, mediaEngine.videoCodecs[1].MimeType)
+	assert.Equal(t, mediaEngine.videoCodecs[1].PayloadType, findRTXPayloadType(96, mediaEngine.videoCodecs))
+
+	// Other kinds are left alone
+	assert.Equal(t, audioCodecs, mediaEngine.audioCodecs)
+
+	assert.ErrorIs(t, mediaEngine.ForceSingleCodec(MimeTypeH264, RTPCodecTypeVideo), ErrCodecNotFound)
+	assert.Len(t, mediaEngine.videoCodecs, 2)
+	assert.ErrorIs(t, mediaEngine.ForceSingleCodec(MimeTypeVP8, RTPCodecTypeUnknown), ErrUnknownType)
+}
+
+func TestMediaEngineForceSingleCodecRemovesSettings(t *testing.T) {
+	vp9 := RTPCodecParameters{
+		RTPCodecCapability: RTPCodecCapability{MimeTypeVP9, 90000, 0, "profile-id=0", nil}, PayloadType: 98,
+	}
+
+	mediaEngine := &MediaEngine{}
+	assert.NoError(t, mediaEngine.RegisterDefaultCodecs())
+	assert.NoError(t, mediaEngine.RegisterCodecWithTags(vp9, RTPCodecTypeVideo, "mobile"))
+	assert.NoError(t, mediaEngine.SetCodecDirection(98, RTPCodecTypeVideo, RTPTransceiverDirectionRecvonly))
+	mediaEngine.AddReceiveAlternative(98, RTPCodecTypeVideo, "profile-id=2")
+	assert.NoError(t, mediaEngine.ForceSingleCodec(MimeTypeVP8, RTPCodecTypeVideo))
+
+	// A codec registered with the payload type of a removed one starts without its settings
+	assert.NoError(t, mediaEngine.RegisterCodec(RTPCodecParameters{
+		RTPCodecCapability: RTPCodecCapability{MimeTypeAV1, 90000, 0, "", nil}, PayloadType: 98,
+	}, RTPCodecTypeVideo))
+	assert.Empty(t, mediaEngine.CodecsByTag("mobile", RTPCodecTypeVideo))
+	assert.Contains(t, codecPayloadTypes(
+		mediaEngine.NegotiatedCodecsForDirection(RTPCodecTypeVideo, RTPTransceiverDirectionSendonly),
+	), PayloadType(98))
+	assert.Empty(t, mediaEngine.receiveAlternatives)
+}
+
+func TestMediaEngineOneRTXPerPrimary(t *testing.T) {
+	const offerSdp = sdpHeader + `m=video 9 UDP/TLS/RTP/SAVPF 96 97 98 99 45 46 100
+a=mid:0
+a=rtpmap:96 VP8/90000
+a=rtpmap:97 rtx/90000
+a=fmtp:97 apt=96
+a=rtpmap:98 VP9/90000
+a=fmtp:98 profile-id=0
+a=rtpmap:99 rtx/90000
+a=fmtp:99 apt=98
+a=rtpmap:45 AV1/90000
+a=rtpmap:46 rtx/90000
+a=fmtp:46 apt=45
+a=rtpmap:100 rtx/90000
+a=fmtp:100 apt=96
+m=video 9 UDP/TLS/RTP/SAVPF 98 101
+a=mid:1
+a=rtpmap:98 VP9/90000
+a=fmtp:98 profile-id=0
+a=rtpmap:101 rtx/90000
+a=fmtp:101 apt=98
+`
+	mediaEngine := MediaEngine{}
+	assert.NoError(t, mediaEngine.RegisterDefaultCodecs())
+	mediaEngine.setMultiCodecNegotiation(true)
+
+	s := mustParseSDP(t, offerSdp)
+	assert.NoError(t, mediaEngine.updateFromRemoteDescription(s))
+
+	rtxByPrimary := map[PayloadType]PayloadType{}
+	for _, codec := range mediaEngine.negotiatedVideoCodecs {
+		apt, isRTX := rtxAssociatedPayloadType(codec)
+		if !isRTX {
+			continue
+		}
+		_, repaired := rtxByPrimary[apt]
+		assert.False(t, repaired, "payload type %d has more than one RTX codec", apt)
+		rtxByPrimary[apt] = codec.PayloadType
+	}
+	assert.Equal(t, map[PayloadType]PayloadType{96: 97, 98: 99, 45: 46}, rtxByPrimary)
+}
+
+func TestMediaEngineStaticPayloadType(t *testing.T) {
+	pcmu := RTPCodecParameters{
+		RTPCodecCapability: RTPCodecCapability{MimeTypePCMU, 8000, 0, "", []RTCPFeedback{{Type: TypeRTCPFBNACK}}},
+		PayloadType:        0,
+	}
+	opus := RTPCodecParameters{
+		RTPCodecCapability: RTPCodecCapability{MimeTypeOpus, 48000, 2, "", nil},
+		PayloadType:        111,
+	}
+	assert.True(t, pcmu.HasStaticPayloadType())
+	assert.False(t, opus.HasStaticPayloadType())
+
+	mediaEngine := MediaEngine{}
+	assert.NoError(t, mediaEngine.RegisterCodec(pcmu, RTPCodecTypeAudio))
+	assert.NoError(t, mediaEngine.RegisterCodec(opus, RTPCodecTypeAudio))
+
+	// Auto assignment gives RTX a dynamic payload type and leaves PCMU at 0
+	assert.NoError(t, mediaEngine.AutoRegisterRTX(RTPCodecTypeAudio))
+	assert.Equal(t, PayloadType(0), mediaEngine.audioCodecs[0].PayloadType)
+	rtxPayloadType := findRTXPayloadType(0, mediaEngine.audioCodecs)
+	assert.GreaterOrEqual(t, rtxPayloadType, PayloadType(96))
+
+	// A remote can't move another codec to a static payload type
+	assert.NoError(t, mediaEngine.RegisterCodec(RTPCodecParameters{
+		RTPCodecCapability: RTPCodecCapability{MimeTypeG722, 8000, 0, "", nil},
+		PayloadType:        9,
+	}, RTPCodecTypeAudio))
+	const offerSdp = sdpHeader + `m=audio 9 UDP/TLS/RTP/SAVPF 9
+a=rtpmap:9 %s
+`
+	s := mustParseSDP(t, fmt.Sprintf(offerSdp, "G722/8000"))
+	assert.NoError(t, mediaEngine.updateFromRemoteDescription(s))
+
+	s = mustParseSDP(t, fmt.Sprintf(offerSdp, "opus/48000/2"))
+	assert.NoError(t, mediaEngine.updateFromRemoteDescription(s))
+
+	codec, _, err := mediaEngine.getCodecByPayload(9)
+	assert.NoError(t, err)
+	assert.Equal(t, MimeTypeG722, codec.MimeType)
+}
+
+func TestMediaEngineNegotiatedBundleGroups(t *testing.T) {
+	const offerSdp = sdpHeader + `a=group:BUNDLE 0 1
+a=group:BUNDLE 2
+a=msid-semantic: WMS
+m=audio 9 UDP/TLS/RTP/SAVPF 111
+a=mid:0
+a=rtpmap:111 opus/48000/2
+m=video 9 UDP/TLS/RTP/SAVPF 96
+a=mid:1
+a=rtpmap:96 VP8/90000
+m=video 9 UDP/TLS/RTP/SAVPF 96
+a=mid:2
+a=rtpmap:96 VP8/90000
+`
+	mediaEngine := MediaEngine{}
+	assert.NoError(t, mediaEngine.RegisterDefaultCodecs())
+	assert.Empty(t, mediaEngine.NegotiatedBundleGroups())
+
+	s := mustParseSDP(t, offerSdp)
+	assert.NoError(t, mediaEngine.updateFromRemoteDescription(s))
+	assert.Equal(t, [][]string{{"0", "1"}, {"2"}}, mediaEngine.NegotiatedBundleGroups())
+
+	mediaEngine.ResetNegotiation()
+	assert.Empty(t, mediaEngine.NegotiatedBundleGroups())
+}
+
+func TestMediaEngineMinMatchStrength(t *testing.T) {
+	const offerSdp = sdpHeader + `m=video 9 UDP/TLS/RTP/SAVPF 120
+a=rtpmap:120 H264/90000
+a=fmtp:120 level-asymmetry-allowed=1;packetization-mode=1;profile-level-id=%s
+`
+	negotiate := func(profileLevelID string, matchType CodecMatchType) []RTPCodecParameters {
+		mediaEngine := MediaEngine{}
+		assert.NoError(t, mediaEngine.RegisterCodec(RTPCodecParameters{
+			RTPCodecCapability: RTPCodecCapability{
+				MimeTypeH264, 90000, 0, "level-asymmetry-allowed=1;packetization-mode=1;profile-level-id=42e01f", nil,
+			},
+			PayloadType: 102,
+		}, RTPCodecTypeVideo))
+		mediaEngine.SetMinMatchStrength(matchType)
+
+		s := mustParseSDP(t, fmt.Sprintf(offerSdp, profileLevelID))
+		assert.NoError(t, mediaEngine.updateFromRemoteDescription(s))
+
+		return mediaEngine.negotiatedVideoCodecs
+	}
+
+	// Levels may differ, the codec still matches exactly
+	assert.Len(t, negotiate("42e034", CodecMatchExact), 1)
+
+	// Another profile is only a partial match
+	assert.Len(t, negotiate("640c1f", CodecMatchPartial), 1)
+	assert.Empty(t, negotiate("640c1f", CodecMatchExact))
+}
+
+func TestMediaEngineLocalCapabilityForPayloadType(t *testing.T) {
+	const offerSdp = sdpHeader + `m=video 9 UDP/TLS/RTP/SAVPF 120 121 122
+a=rtpmap:120 H264/90000
+a=fmtp:120 level-asymmetry-allowed=1;packetization-mode=1;profile-level-id=640c1f
+a=rtpmap:121 H264/90000
+a=fmtp:121 level-asymmetry-allowed=1;packetization-mode=1;profile-level-id=42e01f
+a=rtpmap:122 rtx/90000
+a=fmtp:122 apt=121
+`
+	const (
+		baselineFmtp = "level-asymmetry-allowed=1;packetization-mode=1;profile-level-id=42e01f"
+		highFmtp     = "level-asymmetry-allowed=1;packetization-mode=1;profile-level-id=640c1f"
+	)
+
+	mediaEngine := MediaEngine{}
+	for _, codec := range []RTPCodecParameters{
+		{RTPCodecCapability: RTPCodecCapability{MimeTypeH264, 90000, 0, baselineFmtp, nil}, PayloadType: 102},
+		{RTPCodecCapability: RTPCodecCapability{MimeTypeRTX, 90000, 0, "apt=102", nil}, PayloadType: 103},
+		{RTPCodecCapability: RTPCodecCapability{MimeTypeH264, 90000, 0, highFmtp, nil}, PayloadType: 112},
+	} {
+		assert.NoError(t, mediaEngine.RegisterCodec(codec, RTPCodecTypeVideo))
+	}
+
+	s := mustParseSDP(t, offerSdp)
+	assert.NoError(t, mediaEngine.updateFromRemoteDescription(s))
+
+	for payloadType, expected := range map[PayloadType]string{120: highFmtp, 121: baselineFmtp, 122: "apt=102"} {
+		capability, ok := mediaEngine.LocalCapabilityForPayloadType(payloadType, RTPCodecTypeVideo)
+		assert.True(t, ok)
+		assert.Equal(t, expected, capability.SDPFmtpLine)
+	}
+
+	_, ok := mediaEngine.LocalCapabilityForPayloadType(102, RTPCodecTypeVideo)
+	assert.False(t, ok)
+
+	mediaEngine.ResetNegotiation()
+	_, ok = mediaEngine.LocalCapabilityForPayloadType(120, RTPCodecTypeVideo)
+	assert.False(t, ok)
+}
+
+func TestMediaEngineCodecCount(t *testing.T) {
+	mediaEngine := MediaEngine{}
+	assert.Equal(t, 0, mediaEngine.CodecCount(RTPCodecTypeVideo))
+
+	assert.NoError(t, mediaEngine.RegisterDefaultCodecs())
+	assert.Equal(t, 4, mediaEngine.CodecCount(RTPCodecTypeAudio))
+	assert.Equal(t, 24, mediaEngine.CodecCount(RTPCodecTypeVideo))
+	assert.Equal(t, 0, mediaEngine.CodecCount(RTPCodecTypeUnknown))
+
+	const offerSdp = sdpHeader + `m=video 9 UDP/TLS/RTP/SAVPF 96 97
+a=rtpmap:96 VP8/90000
+a=rtpmap:97 rtx/90000
+a=fmtp:97 apt=96
+`
+	s := mustParseSDP(t, offerSdp)
+	assert.NoError(t, mediaEngine.updateFromRemoteDescription(s))
+	assert.Equal(t, 2, mediaEngine.CodecCount(RTPCodecTypeVideo))
+	assert.Equal(t, 4, mediaEngine.CodecCount(RTPCodecTypeAudio))
+}
+
+func TestMediaEngineTransportCCFeedbackWithoutExtension(t *testing.T) {
+	const offerSdp = sdpHeader + `m=video 9 UDP/TLS/RTP/SAVPF 96
+a=extmap:3 http://www.ietf.org/id/draft-holmer-rmcat-transport-wide-cc-extensions-01
+a=rtpmap:96 VP8/90000
+a=rtcp-fb:96 nack
+a=rtcp-fb:96 transport-cc
+`
+	negotiate := func(registerExtension bool) []RTCPFeedback {
+		mediaEngine := &MediaEngine{}
+		assert.NoError(t, mediaEngine.RegisterCodec(RTPCodecParameters{
+			RTPCodecCapability: RTPCodecCapability{
+				MimeTypeVP8, 90000, 0, "", []RTCPFeedback{{Type: TypeRTCPFBNACK}, {Type: TypeRTCPFBTransportCC}},
+			},
+			PayloadType: 96,
+		}, RTPCodecTypeVideo))
+		if registerExtension {
+			assert.NoError(t, mediaEngine.RegisterHeaderExtension(
+				RTPHeaderExtensionCapability{URI: sdp.TransportCCURI}, RTPCodecTypeVideo,
+			))
+		}
+		mediaEngine = mediaEngine.copy()
+
+		s := mustParseSDP(t, offerSdp)
+		assert.NoError(t, mediaEngine.updateFromRemoteDescription(s))
+		codecs := mediaEngine.getCodecsByKind(RTPCodecTypeVideo)
+		assert.Len(t, codecs, 1)
+
+		return codecs[0].RTCPFeedback
+	}
+
+	assert.Equal(t, []RTCPFeedback{{Type: TypeRTCPFBNACK}, {Type: TypeRTCPFBTransportCC}}, negotiate(true))
+	assert.Equal(t, []RTCPFeedback{{Type: TypeRTCPFBNACK}}, negotiate(false))
+}
+
+type testRegistrationObserver struct {
+	mediaEngine      *MediaEngine
+	codecs           []RTPCodecParameters
+	headerExtensions []string
+}
+
+func (o *testRegistrationObserver) OnCodecRegistered(codec RTPCodecParameters, _ RTPCodecType) {
+	// The MediaEngine is unlocked while observers are called
+	_ = o.mediaEngine.CodecCount(RTPCodecTypeVideo)
+	o.codecs = append(o.codecs, codec)
+}
+
+func (o *testRegistrationObserver) OnHeaderExtensionRegistered(extension RTPHeaderExtensionCapability, _ RTPCodecType) {
+	o.headerExtensions = append(o.headerExtensions, extension.URI)
+}
+
+func TestMediaEngineRegistrationObserver(t *testing.T) {
+	mediaEngine := &MediaEngine{}
+	observer := &testRegistrationObserver{mediaEngine: mediaEngine}
+	mediaEngine.AddRegistrationObserver(observer)
+
+	assert.NoError(t, mediaEngine.RegisterDefaultCodecs())
+	registered := append(slices.Clone(mediaEngine.audioCodecs), mediaEngine.videoCodecs...)
+	assert.Equal(t, registered, observer.codecs)
+
+	// Failed registrations aren't observed
+	assert.Error(t, mediaEngine.RegisterCodec(RTPCodecParameters{
+		RTPCodecCapability: RTPCodecCapability{MimeTypeVP9, 90000, 0, "", nil},
+		PayloadType:        96,
+	}, RTPCodecTypeVideo))
+	assert.Len(t, observer.codecs, len(registered))
+
+	assert.NoError(t, mediaEngine.RegisterHeaderExtension(
+		RTPHeaderExtensionCapability{URI: sdp.SDESMidURI}, RTPCodecTypeVideo,
+	))
+	assert.Error(t, mediaEngine.RegisterHeaderExtensions([]RTPHeaderExtensionCapability{
+		{URI: sdp.TransportCCURI}, {URI: VideoTimingURI},
+	}, RTPCodecTypeAudio))
+	assert.Equal(t, []string{sdp.SDESMidURI}, observer.headerExtensions)
+}
+
+func TestMediaEngineDuplicateRemoteCodec(t *testing.T) {
+	const offerSdp = sdpHeader + `m=video 9 UDP/TLS/RTP/SAVPF 126 127 120 121
+a=rtpmap:126 H264/90000
+a=fmtp:126 level-asymmetry-allowed=1;packetization-mode=1;profile-level-id=42e01f
+a=rtpmap:127 rtx/90000
+a=fmtp:127 apt=126
+a=rtpmap:120 H264/90000
+a=fmtp:120 level-asymmetry-allowed=1;packetization-mode=1;profile-level-id=42e01f
+a=rtpmap:121 rtx/90000
+a=fmtp:121 apt=120
+`
+	for _, multiCodec := range []bool{false, true} {
+		mediaEngine := MediaEngine{}
+		assert.NoError(t, mediaEngine.RegisterDefaultCodecs())
+		mediaEngine.setMultiCodecNegotiation(multiCodec)
+
+		s := mustParseSDP(t, offerSdp)
+		assert.NoError(t, mediaEngine.updateFromRemoteDescription(s))
+
+		if multiCodec {
+			assert.Equal(t, []PayloadType{126, 127, 120, 121}, codecPayloadTypes(mediaEngine.negotiatedVideoCodecs))
+		} else {
+			assert.Equal(t, []PayloadType{126, 127}, codecPayloadTypes(mediaEngine.negotiatedVideoCodecs))
+		}
+	}
+}
+
+func TestMediaEngineRTXTime(t *testing.T) {
+	const offerSdp = sdpHeader + `m=video 9 UDP/TLS/RTP/SAVPF 96 97 102 103
+a=rtpmap:96 VP8/90000
+a=rtpmap:97 rtx/90000
+a=fmtp:97 apt=96;rtx-time=1000
+a=rtpmap:102 VP9/90000
+a=fmtp:102 profile-id=0
+a=rtpmap:103 rtx/90000
+a=fmtp:103 apt=102
+`
+	mediaEngine := MediaEngine{}
+	assert.NoError(t, mediaEngine.RegisterDefaultCodecs())
+
+	s := mustParseSDP(t, offerSdp)
+	assert.NoError(t, mediaEngine.updateFromRemoteDescription(s))
+
+	rtxTime, ok := mediaEngine.RTXTime(97)
+	assert.True(t, ok)
+	assert.Equal(t, time.Second, rtxTime)
+
+	for _, payloadType := range []PayloadType{96, 103, 120} {
+		_, ok = mediaEngine.RTXTime(payloadType)
+		assert.False(t, ok)
+	}
+}
+
+func TestMediaEngineCodecTable(t *testing.T) {
+	const defaultVideoCodecs = `39 H264/90000 level-asymmetry-allowed=1;packetization-mode=0;profile-level-id=4d001f
+40 rtx/90000 apt=39
+45 AV1/90000
+46 rtx/90000 apt=45
+96 VP8/90000
+97 rtx/90000 apt=96
+98 VP9/90000 profile-id=0
+99 rtx/90000 apt=98
+100 VP9/90000 profile-id=2
+101 rtx/90000 apt=100
+102 H264/90000 level-asymmetry-allowed=1;packetization-mode=1;profile-level-id=42001f
+103 rtx/90000 apt=102
+104 H264/90000 level-asymmetry-allowed=1;packetization-mode=0;profile-level-id=42001f
+105 rtx/90000 apt=104
+106 H264/90000 level-asymmetry-allowed=1;packetization-mode=1;profile-level-id=42e01f
+107 rtx/90000 apt=106
+108 H264/90000 level-asymmetry-allowed=1;packetization-mode=0;profile-level-id=42e01f
+109 rtx/90000 apt=108
+112 H264/90000 level-asymmetry-allowed=1;packetization-mode=1;profile-level-id=64001f
+113 rtx/90000 apt=112
+116 H265/90000
+117 rtx/90000 apt=116
+125 rtx/90000 apt=127
+127 H264/90000 level-asymmetry-allowed=1;packetization-mode=1;profile-level-id=4d001f
+`
+	mediaEngine := MediaEngine{}
+	assert.Empty(t, mediaEngine.CodecTable(RTPCodecTypeVideo))
+
+	assert.NoError(t, mediaEngine.RegisterDefaultCodecs())
+	assert.Equal(t, defaultVideoCodecs, mediaEngine.CodecTable(RTPCodecTypeVideo))
+	assert.Equal(t, `0 PCMU/8000
+8 PCMA/8000
+9 G722/8000
+111 opus/48000/2 minptime=10;useinbandfec=1
+`, mediaEngine.CodecTable(RTPCodecTypeAudio))
+}
+
+func TestMediaEngineRTXServesSimulcast(t *testing.T) {
+	const offerSdp = sdpHeader + `m=video 9 UDP/TLS/RTP/SAVPF 96 97 45
+a=extmap:4 urn:ietf:params:rtp-hdrext:sdes:rtp-stream-id
+a=extmap:5 urn:ietf:params:rtp-hdrext:sdes:repaired-rtp-stream-id
+a=rtpmap:96 VP8/90000
+a=rtpmap:97 rtx/90000
+a=fmtp:97 apt=96
+a=rtpmap:45 AV1/90000
+a=rid:low send
+a=rid:high send
+a=simulcast:send low;high
+`
+	mediaEngine := &MediaEngine{}
+	assert.NoError(t, mediaEngine.RegisterDefaultCodecs())
+	for _, uri := range []string{sdp.SDESRTPStreamIDURI, sdp.SDESRepairRTPStreamIDURI} {
+		assert.NoError(t, mediaEngine.RegisterHeaderExtension(RTPHeaderExtensionCapability{URI: uri}, RTPCodecTypeVideo))
+	}
+	mediaEngine = mediaEngine.copy()
+	assert.False(t, mediaEngine.RTXServesSimulcast(96))
+
+	s := mustParseSDP(t, offerSdp)
+	assert.NoError(t, mediaEngine.updateFromRemoteDescription(s))
+	assert.True(t, mediaEngine.RTXServesSimulcast(96))
+	assert.False(t, mediaEngine.RTXServesSimulcast(45))
+
+	// Without the RTP stream ID there is no simulcast
+	withoutRID := &MediaEngine{}
+	assert.NoError(t, withoutRID.RegisterDefaultCodecs())
+	withoutRID = withoutRID.copy()
+	assert.NoError(t, withoutRID.updateFromRemoteDescription(s))
+	assert.False(t, withoutRID.RTXServesSimulcast(96))
+}
+
+func TestMediaEngineRegisterDefaultCodecsWithOptions(t *testing.T) {
+	hasFeedback := func(codecs []RTPCodecParameters, feedbackType string) bool {
+		return slices.ContainsFunc(codecs, func(codec RTPCodecParameters) bool {
+			return slices.ContainsFunc(codec.RTCPFeedback, func(f RTCPFeedback) bool { return f.Type == feedbackType })
+		})
+	}
+
+	defaults := MediaEngine{}
+	assert.NoError(t, defaults.RegisterDefaultCodecsWithOptions(DefaultCodecOptions{}))
+	assert.True(t, hasFeedback(defaults.videoCodecs, TypeRTCPFBGoogREMB))
+	assert.False(t, hasFeedback(defaults.videoCodecs, TypeRTCPFBTransportCC))
+
+	mediaEngine := MediaEngine{}
+	assert.NoError(t, mediaEngine.RegisterDefaultCodecsWithOptions(DefaultCodecOptions{
+		DisableREMB:    true,
+		TransportCC:    true,
+		DisabledCodecs: []string{MimeTypeH264, MimeTypePCMA},
+	}))
+	assert.False(t, hasFeedback(mediaEngine.videoCodecs, TypeRTCPFBGoogREMB))
+	assert.True(t, hasFeedback(mediaEngine.videoCodecs, TypeRTCPFBTransportCC))
+	assert.True(t, hasFeedback(mediaEngine.videoCodecs, TypeRTCPFBNACK))
+
+	for _, codec := range append(slices.Clone(mediaEngine.audioCodecs), mediaEngine.videoCodecs...) {
+		assert.NotEqual(t, MimeTypeH264, codec.MimeType)
+		assert.NotEqual(t, MimeTypePCMA, codec.MimeType)
+		if apt, isRTX := rtxAssociatedPayloadType(codec); isRTX {
+			assert.NotNil(t, findCodecByPayload(mediaEngine.videoCodecs, apt))
+		}
+	}
+	assert.Equal(t, 3, mediaEngine.CodecCount(RTPCodecTypeAudio))
+	assert.Equal(t, 10, mediaEngine.CodecCount(RTPCodecTypeVideo))
+}
+
+func TestMediaEngineHasUsableCodecs(t *testing.T) {
+	const offerSdp = sdpHeader + `m=video 9 UDP/TLS/RTP/SAVPF 96
+a=rtpmap:96 unsupported/90000
+`
+	s := mustParseSDP(t, offerSdp)
+
+	mediaEngine := MediaEngine{}
+	assert.False(t, mediaEngine.HasUsableCodecs(RTPCodecTypeVideo))
+	assert.NoError(t, mediaEngine.RegisterDefaultCodecs())
+	assert.True(t, mediaEngine.HasUsableCodecs(RTPCodecTypeVideo))
+
+	required := mediaEngine.copy()
+	required.SetRequireUsableCodecs(true)
+
+	assert.NoError(t, mediaEngine.updateFromRemoteDescription(s))
+	assert.False(t, mediaEngine.HasUsableCodecs(RTPCodecTypeVideo))
+	assert.True(t, mediaEngine.HasUsableCodecs(RTPCodecTypeAudio))
+
+	assert.ErrorIs(t, required.updateFromRemoteDescription(s), ErrNoCommonCodecs)
+}
+
+func TestMediaEngineInactiveMediaSection(t *testing.T) {
+	const offerSdp = sdpHeader + `m=audio %d UDP/TLS/RTP/SAVPF 0
+a=rtpmap:0 PCMU/8000
+m=video 9 UDP/TLS/RTP/SAVPF 96
+a=rtpmap:96 VP8/90000
+a=%s
+`
+	mediaEngine := MediaEngine{}
+	assert.NoError(t, mediaEngine.RegisterDefaultCodecs())
+
+	s := mustParseSDP(t, fmt.Sprintf(offerSdp, 9, "inactive"))
+	assert.NoError(t, mediaEngine.updateFromRemoteDescription(s))
+	assert.True(t, mediaEngine.negotiatedAudio)
+	assert.False(t, mediaEngine.negotiatedVideo)
+	assert.Empty(t, mediaEngine.negotiatedVideoCodecs)
+
+	// Resuming the section negotiates it
+	s = mustParseSDP(t, fmt.Sprintf(offerSdp, 9, "sendrecv"))
+	assert.NoError(t, mediaEngine.updateFromRemoteDescription(s))
+	assert.True(t, mediaEngine.negotiatedVideo)
+	assert.Len(t, mediaEngine.negotiatedVideoCodecs, 1)
+
+	// A rejected section is skipped like a section on hold
+	rejected := MediaEngine{}
+	assert.NoError(t, rejected.RegisterDefaultCodecs())
+	s = mustParseSDP(t, fmt.Sprintf(offerSdp, 0, "sendrecv"))
+	assert.NoError(t, rejected.updateFromRemoteDescription(s))
+	assert.False(t, rejected.negotiatedAudio)
+	assert.Empty(t, rejected.negotiatedAudioCodecs)
+	assert.Zero(t, rejected.CodecCount(RTPCodecTypeAudio))
+
+	// A live section following a rejected one still negotiates its codecs
+	rejected = MediaEngine{}
+	assert.NoError(t, rejected.RegisterDefaultCodecs())
+	assert.NoError(t, rejected.updateFromRemoteDescription(mustParseSDP(t, sdpHeader+`m=audio 0 UDP/TLS/RTP/SAVPF 0
+a=rtpmap:0 PCMU/8000
+m=audio 9 UDP/TLS/RTP/SAVPF 111
+a=rtpmap:111 opus/48000/2
+`)))
+	assert.True(t, rejected.negotiatedAudio)
+	assert.Equal(t, 1, rejected.CodecCount(RTPCodecTypeAudio))
+	assert.Equal(t, MimeTypeOpus, rejected.negotiatedAudioCodecs[0].MimeType)
+
+	// A bundle-only section with port zero isn't rejected
+	bundleOnly := MediaEngine{}
+	assert.NoError(t, bundleOnly.RegisterDefaultCodecs())
+	s = sdp.SessionDescription{}
+	assert.NoError(t, s.Unmarshal([]byte(sdpHeader+`m=video 0 UDP/TLS/RTP/SAVPF 96
+a=bundle-only
+a=rtpmap:96 VP8/90000
+`)))
+	assert.NoError(t, bundleOnly.updateFromRemoteDescription(s))
+	assert.True(t, bundleOnly.negotiatedVideo)
+	assert.Len(t, bundleOnly.negotiatedVideoCodecs, 1)
+}
+
+func TestMediaEngineMaxHeaderExtensions(t *testing.T) {
+	mediaEngine := MediaEngine{}
+	assert.NoError(t, mediaEngine.RegisterDefaultCodecs())
+
+	uris := make([]string, 0, 10)
+	for i := range 10 {
+		uri := fmt.Sprintf("urn:example:extension-%d", i)
+		uris = append(uris, uri)
+		assert.NoError(t, mediaEngine.RegisterHeaderExtension(RTPHeaderExtensionCapability{URI: uri}, RTPCodecTypeVideo))
+		assert.NoError(t, mediaEngine.RegisterHeaderExtension(RTPHeaderExtensionCapability{URI: uri}, RTPCodecTypeAudio))
+	}
+	mediaEngine.SetMaxHeaderExtensions(RTPCodecTypeVideo, 5)
+
+	offered := func(typ RTPCodecType) []string {
+		params := mediaEngine.getRTPParametersByKind(typ, []RTPTransceiverDirection{RTPTransceiverDirectionSendrecv})
+		offered := make([]string, 0, len(params.HeaderExtensions))
+		for _, extension := range params.HeaderExtensions {
+			offered = append(offered, extension.URI)
+		}
+
+		return offered
+	}
+	assert.Equal(t, uris[:5], offered(RTPCodecTypeVideo))
+	assert.Len(t, offered(RTPCodecTypeAudio), 10)
+
+	mediaEngine.SetMaxHeaderExtensions(RTPCodecTypeVideo, 0)
+	assert.Len(t, offered(RTPCodecTypeVideo), 10)
+}
+
+func TestMediaEngineDefaultPayloadTypes(t *testing.T) {
+	mediaEngine := MediaEngine{}
+	assert.NoError(t, mediaEngine.RegisterDefaultCodecs())
+
+	for _, test := range []struct {
+		payloadType PayloadType
+		mimeType    string
+		fmtpLine    string
+	}{
+		{DefaultPayloadTypeOpus, MimeTypeOpus, "minptime=10;useinbandfec=1"},
+		{DefaultPayloadTypeVP8, MimeTypeVP8, ""},
+		{DefaultPayloadTypeH264, MimeTypeH264, "level-asymmetry-allowed=1;packetization-mode=1;profile-level-id=42001f"},
+		{DefaultPayloadTypeVP9, MimeTypeVP9, "profile-id=0"},
+		{DefaultPayloadTypeVP9Profile2, MimeTypeVP9, "profile-id=2"},
+		{DefaultPayloadTypeAV1, MimeTypeAV1, ""},
+		{DefaultPayloadTypeH265, MimeTypeH265, ""},
+	} {
+		codec, _, err := mediaEngine.getCodecByPayload(test.payloadType)
+		assert.NoError(t, err)
+		assert.Equal(t, test.mimeType, codec.MimeType)
+		assert.Equal(t, test.fmtpLine, codec.SDPFmtpLine)
+	}
+}
+
+func TestMediaEngineBWEExtensionPolicy(t *testing.T) {
+	offered := func(policy BWEPolicy, uris ...string) []string {
+		mediaEngine := MediaEngine{}
+		assert.NoError(t, mediaEngine.RegisterDefaultCodecs())
+		for _, uri := range uris {
+			assert.NoError(t, mediaEngine.RegisterHeaderExtension(RTPHeaderExtensionCapability{URI: uri}, RTPCodecTypeVideo))
+		}
+		mediaEngine.SetBWEExtensionPolicy(policy)
+
+		params := mediaEngine.getRTPParametersByKind(RTPCodecTypeVideo, []RTPTransceiverDirection{
+			RTPTransceiverDirectionSendrecv,
+		})
+		offered := []string{}
+		for _, extension := range params.HeaderExtensions {
+			offered = append(offered, extension.URI)
+		}
+
+		return offered
+	}
+
+	both := []string{sdp.ABSSendTimeURI, sdp.TransportCCURI}
+	assert.ElementsMatch(t, both, offered(BWEPolicyAllowBoth, both...))
+	assert.Equal(t, []string{sdp.TransportCCURI}, offered(BWEPolicyPreferTransportCC, both...))
+	assert.Equal(t, []string{sdp.ABSSendTimeURI}, offered(BWEPolicyPreferAbsSendTime, both...))
+
+	// Without the preferred header extension the other one is kept
+	assert.Equal(t, []string{sdp.ABSSendTimeURI}, offered(BWEPolicyPreferTransportCC, sdp.ABSSendTimeURI))
+}
+
+func TestMediaEngineCodecTags(t *testing.T) {
+	mediaEngine := MediaEngine{}
+	for _, codec := range []struct {
+		params RTPCodecParameters
+		tags   []string
+	}{
+		{
+			RTPCodecParameters{RTPCodecCapability: RTPCodecCapability{MimeTypeVP8, 90000, 0, "", nil}, PayloadType: 96},
+			[]string{"mobile", "desktop"},
+		},
+		{
+			RTPCodecParameters{RTPCodecCapability: RTPCodecCapability{MimeTypeRTX, 90000, 0, "apt=96", nil}, PayloadType: 97},
+			nil,
+		},
+		{
+			RTPCodecParameters{RTPCodecCapability: RTPCodecCapability{MimeTypeAV1, 90000, 0, "", nil}, PayloadType: 45},
+			[]string{"desktop"},
+		},
+	} {
+		assert.NoError(t, mediaEngine.RegisterCodecWithTags(codec.params, RTPCodecTypeVideo, codec.tags...))
+	}
+
+	assert.Equal(t, []PayloadType{96, 97}, codecPayloadTypes(mediaEngine.CodecsByTag("mobile", RTPCodecTypeVideo)))
+	assert.Equal(t, []PayloadType{96, 97, 45}, codecPayloadTypes(mediaEngine.CodecsByTag("desktop", RTPCodecTypeVideo)))
+	assert.Empty(t, mediaEngine.CodecsByTag("mobile", RTPCodecTypeAudio))
+
+	// Registering a codec again adds tags
+	assert.NoError(t, mediaEngine.RegisterCodecWithTags(RTPCodecParameters{
+		RTPCodecCapability: RTPCodecCapability{MimeTypeAV1, 90000, 0, "", nil}, PayloadType: 45,
+	}, RTPCodecTypeVideo, "mobile"))
+	assert.Equal(t, []PayloadType{96, 97, 45}, codecPayloadTypes(mediaEngine.CodecsByTag("mobile", RTPCodecTypeVideo)))
+	assert.Equal(t, []PayloadType{96, 97, 45}, codecPayloadTypes(mediaEngine.CodecsByTag("desktop", RTPCodecTypeVideo)))
+
+	// Tags of audio codecs don't apply to video codecs with the same payload type
+	assert.NoError(t, mediaEngine.RegisterCodecWithTags(RTPCodecParameters{
+		RTPCodecCapability: RTPCodecCapability{MimeTypePCMU, 8000, 0, "", nil}, PayloadType: 96,
+	}, RTPCodecTypeAudio, "audio-only"))
+	assert.Equal(t, []PayloadType{96}, codecPayloadTypes(mediaEngine.CodecsByTag("audio-only", RTPCodecTypeAudio)))
+	assert.Empty(t, mediaEngine.CodecsByTag("audio-only", RTPCodecTypeVideo))
+
+	desktop := mediaEngine.copy()
+	desktop.SetOfferTag("desktop")
+	assert.NoError(t, desktop.RegisterCodec(RTPCodecParameters{
+		RTPCodecCapability: RTPCodecCapability{MimeTypeVP9, 90000, 0, "", nil}, PayloadType: 98,
+	}, RTPCodecTypeVideo))
+	assert.Equal(t, []PayloadType{96, 97, 45}, codecPayloadTypes(desktop.getCodecsByKind(RTPCodecTypeVideo)))
+	assert.Equal(t, []PayloadType{96, 97, 45}, codecPayloadTypes(mediaEngine.getCodecsByKind(RTPCodecTypeVideo)))
+}
+
+func TestMediaEngineRTXAptRewrite(t *testing.T) {
+	const offerSdp = sdpHeader + `m=video 9 UDP/TLS/RTP/SAVPF 6 7
+a=rtpmap:6 VP8/90000
+a=rtpmap:7 rtx/90000
+a=fmtp:7 apt=6;rtx-time=60
+`
+	mediaEngine := MediaEngine{}
+	assert.NoError(t, mediaEngine.RegisterDefaultCodecs())
+
+	s := mustParseSDP(t, offerSdp)
+	assert.NoError(t, mediaEngine.updateFromRemoteDescription(s))
+
+	// The remote fmtp line is kept as is, the local RTX codec matched with the apt rewritten
+	codec, _, err := mediaEngine.getCodecByPayload(7)
+	assert.NoError(t, err)
+	assert.Equal(t, "apt=6;rtx-time=60", codec.SDPFmtpLine)
+	matchType, ok := mediaEngine.NegotiatedMatchType(7, RTPCodecTypeVideo)
+	assert.True(t, ok)
+	assert.Equal(t, CodecMatchExact, matchType)
+	local, ok := mediaEngine.LocalCapabilityForPayloadType(7, RTPCodecTypeVideo)
+	assert.True(t, ok)
+	assert.Equal(t, "apt=96", local.SDPFmtpLine)
+}
+
+func TestMediaEngineScalabilityModeSupported(t *testing.T) {
+	mediaEngine := MediaEngine{}
+	assert.False(t, mediaEngine.ScalabilityModeSupported(MimeTypeAV1, "L3T3"))
+
+	assert.NoError(t, mediaEngine.RegisterDefaultCodecs())
+	for _, mime := range []string{MimeTypeAV1, MimeTypeVP9} {
+		for _, mode := range []string{"L1T1", "L3T3", "L3T3_KEY", "S2T3h"} {
+			assert.True(t, mediaEngine.ScalabilityModeSupported(mime, mode), "%s %s", mime, mode)
+		}
+	}
+	assert.True(t, mediaEngine.ScalabilityModeSupported("video/vp8", "L1T3"))
+	assert.False(t, mediaEngine.ScalabilityModeSupported(MimeTypeVP8, "L3T3"))
+	assert.False(t, mediaEngine.ScalabilityModeSupported(MimeTypeH264, "S2T1"))
+	assert.False(t, mediaEngine.ScalabilityModeSupported(MimeTypeAV1, "L4T3"))
+	assert.False(t, mediaEngine.ScalabilityModeSupported(MimeTypeOpus, "L1T1"))
+}
+
+func TestMediaEngineSetLogger(t *testing.T) {
+	const offerSdp = sdpHeader + `m=video 60323 UDP/TLS/RTP/SAVPF 96 98
+a=rtpmap:96 VP8/90000
+a=rtpmap:98 VVC/90000
+`
+
+	var buf bytes.Buffer
+	mediaEngine := MediaEngine{}
+	assert.NoError(t, mediaEngine.RegisterDefaultCodecs())
+	mediaEngine.SetLogger(logging.NewDefaultLeveledLoggerForScope("mediaengine", logging.LogLevelWarn, &buf))
+
+	s := mustParseSDP(t, offerSdp)
+	assert.NoError(t, mediaEngine.updateFromRemoteDescription(s))
+
+	assert.Len(t, mediaEngine.negotiatedVideoCodecs, 1)
+	assert.Contains(t, buf.String(), "dropped remote codec video/VVC with payload type 98")
+}
+
+func TestMediaEngineRegisterCodecFunc(t *testing.T) {
+	calls := 0
+	mediaEngine := MediaEngine{}
+	assert.NoError(t, mediaEngine.RegisterCodecFunc(func() RTPCodecParameters {
+		calls++
+
+		return RTPCodecParameters{
+			RTPCodecCapability: RTPCodecCapability{
+				MimeType:    MimeTypeH264,
+				ClockRate:   90000,
+				SDPFmtpLine: "level-asymmetry-allowed=1;packetization-mode=1;profile-level-id=42e034",
+			},
+			PayloadType: 102,
+		}
+	}, RTPCodecTypeVideo))
+	assert.ErrorIs(t, mediaEngine.RegisterCodecFunc(nil, RTPCodecType(0)), ErrUnknownType)
+	assert.ErrorIs(t, mediaEngine.RegisterCodecFunc(nil, RTPCodecTypeVideo), ErrNilCodecFunc)
+	assert.Equal(t, 0, calls)
+
+	for i := 0; i < 2; i++ {
+		params := mediaEngine.copy().getRTPParametersByKind(
+			RTPCodecTypeVideo, []RTPTransceiverDirection{RTPTransceiverDirectionSendrecv},
+		)
+		if assert.Len(t, params.Codecs, 1) {
+			assert.Equal(t, "level-asymmetry-allowed=1;packetization-mode=1;profile-level-id=42e034",
+				params.Codecs[0].SDPFmtpLine)
+		}
+	}
+
+	// Lookups of registered codecs generate the codec too
+	_, _, err := mediaEngine.copy().getCodecByPayload(102)
+	assert.NoError(t, err)
+	encoded, err := mediaEngine.copy().MarshalJSON()
+	assert.NoError(t, err)
+	assert.Contains(t, string(encoded), "profile-level-id=42e034")
+
+	assert.Len(t, mediaEngine.getCodecsByKind(RTPCodecTypeVideo), 1)
+	assert.Equal(t, 1, calls)
+}
+
+func TestMediaEngineRegisterCodecFuncReaders(t *testing.T) {
+	lazyVP8 := func() RTPCodecParameters {
+		return RTPCodecParameters{
+			RTPCodecCapability: RTPCodecCapability{
+				MimeType:     MimeTypeVP8,
+				ClockRate:    90000,
+				RTCPFeedback: []RTCPFeedback{{Type: TypeRTCPFBNACK}},
+			},
+			PayloadType: 96,
+		}
+	}
+	lazyRTX := func() RTPCodecParameters {
+		return RTPCodecParameters{
+			RTPCodecCapability: RTPCodecCapability{
+				MimeType: MimeTypeRTX, ClockRate: 90000, SDPFmtpLine: "apt=96",
+			},
+			PayloadType: 97,
+		}
+	}
+	newEngine := func() *MediaEngine {
+		mediaEngine := &MediaEngine{}
+		assert.NoError(t, mediaEngine.RegisterCodecFunc(lazyVP8, RTPCodecTypeVideo))
+		assert.NoError(t, mediaEngine.RegisterCodecFunc(lazyRTX, RTPCodecTypeVideo))
+
+		return mediaEngine
+	}
+
+	assert.Len(t, newEngine().CodecsByMimeType(MimeTypeVP8, RTPCodecTypeVideo), 1)
+	assert.Len(t, newEngine().CodecsWithFeedback(RTCPFeedback{Type: TypeRTCPFBNACK}, RTPCodecTypeVideo), 1)
+	assert.Equal(t, uint32(90000), newEngine().RTPClockRate(MimeTypeVP8))
+	assert.True(t, newEngine().ScalabilityModeSupported(MimeTypeVP8, "L1T2"))
+	assert.True(t, newEngine().ResilienceCapabilities(RTPCodecTypeVideo).RTX)
+	assert.NoError(t, newEngine().ForceSingleCodec(MimeTypeVP8, RTPCodecTypeVideo))
+	assert.NotEqual(t, (&MediaEngine{}).ConfigFingerprint(), newEngine().ConfigFingerprint())
+
+	// Decoding replaces the lazily registered codecs
+	encoded, err := (&MediaEngine{}).MarshalJSON()
+	assert.NoError(t, err)
+	decoded := newEngine()
+	assert.NoError(t, decoded.UnmarshalJSON(encoded))
+	assert.Empty(t, decoded.CodecsByMimeType(MimeTypeVP8, RTPCodecTypeVideo))
+}
+
+func TestMediaEnginePayloadTypeForCodec(t *testing.T) {
+	const offerSdp = sdpHeader + `m=video 60323 UDP/TLS/RTP/SAVPF 120 121
+a=rtpmap:120 H264/90000
+a=fmtp:120 level-asymmetry-allowed=1;packetization-mode=1;profile-level-id=42e01f
+a=rtpmap:121 H264/90000
+a=fmtp:121 level-asymmetry-allowed=1;packetization-mode=0;profile-level-id=42e01f
+`
+
+	h264 := RTPCodecCapability{
+		MimeType:    MimeTypeH264,
+		ClockRate:   90000,
+		SDPFmtpLine: "level-asymmetry-allowed=1;packetization-mode=1;profile-level-id=42e01f",
+	}
+
+	mediaEngine := MediaEngine{}
+	assert.NoError(t, mediaEngine.RegisterCodec(RTPCodecParameters{RTPCodecCapability: h264, PayloadType: 102},
+		RTPCodecTypeVideo))
+
+	payloadType, ok := mediaEngine.PayloadTypeForCodec(h264)
+	assert.True(t, ok)
+	assert.Equal(t, PayloadType(102), payloadType)
+
+	s := mustParseSDP(t, offerSdp)
+	assert.NoError(t, mediaEngine.updateFromRemoteDescription(s))
+
+	payloadType, ok = mediaEngine.PayloadTypeForCodec(h264)
+	assert.True(t, ok)
+	assert.Equal(t, PayloadType(120), payloadType)
+
+	_, ok = mediaEngine.PayloadTypeForCodec(RTPCodecCapability{MimeType: MimeTypeVP8, ClockRate: 90000})
+	assert.False(t, ok)
+	_, ok = mediaEngine.PayloadTypeForCodec(RTPCodecCapability{MimeType: "text/plain", ClockRate: 90000})
+	assert.False(t, ok)
+}
+
+func TestMediaEngineJSON(t *testing.T) {
+	mediaEngine := &MediaEngine{}
+	assert.NoError(t, mediaEngine.RegisterDefaultCodecs())
+	assert.NoError(t, mediaEngine.RegisterNamedCodec(RTPCodecParameters{
+		RTPCodecCapability: RTPCodecCapability{
+			MimeType:     MimeTypeH265,
+			ClockRate:    90000,
+			SDPFmtpLine:  "level-id=93;profile-id=1;tier-flag=0;tx-mode=SRST",
+			RTCPFeedback: []RTCPFeedback{{Type: TypeRTCPFBNACK}, {Type: TypeRTCPFBNACK, Parameter: "pli"}},
+		},
+		PayloadType: 126,
+	}, RTPCodecTypeVideo, "H265-main"))
+	assert.NoError(t, mediaEngine.RegisterCodecWithTags(RTPCodecParameters{
+		RTPCodecCapability: RTPCodecCapability{MimeTypeVP8, 90000, 0, "", nil}, PayloadType: 96,
+	}, RTPCodecTypeVideo, "desktop"))
+	assert.NoError(t, mediaEngine.SetCodecDirection(126, RTPCodecTypeVideo, RTPTransceiverDirectionRecvonly))
+	assert.NoError(t, mediaEngine.SetCodecEnabled(MimeTypeVP9, RTPCodecTypeVideo, false))
+	mediaEngine.PinFmtpParameter(MimeTypeOpus, "useinbandfec", "0")
+	mediaEngine.AddReceiveAlternative(126, RTPCodecTypeVideo, "level-id=120;profile-id=1;tier-flag=0;tx-mode=SRST")
+	mediaEngine.RegisterFeedback(RTCPFeedback{Type: TypeRTCPFBTransportCC}, RTPCodecTypeAudio)
+	for _, typ := range []RTPCodecType{RTPCodecTypeAudio, RTPCodecTypeVideo} {
+		assert.NoError(t, mediaEngine.RegisterHeaderExtension(RTPHeaderExtensionCapability{URI: sdp.TransportCCURI}, typ))
+	}
+	assert.NoError(t, mediaEngine.RegisterHeaderExtension(
+		RTPHeaderExtensionCapability{URI: sdp.SDESMidURI}, RTPCodecTypeVideo, RTPTransceiverDirectionRecvonly,
+	))
+
+	encoded, err := json.Marshal(mediaEngine)
+	assert.NoError(t, err)
+
+	// Configuration of codecs set before unmarshaling doesn't apply to the decoded codecs
+	decoded := &MediaEngine{}
+	assert.NoError(t, decoded.SetCodecDirection(111, RTPCodecTypeAudio, RTPTransceiverDirectionSendonly))
+	assert.NoError(t, json.Unmarshal(encoded, decoded))
+	assert.True(t, decoded.Equal(mediaEngine))
+	assert.True(t, mediaEngine.Equal(decoded))
+	h265 := findCodecByPayload(decoded.videoCodecs, 126)
+	if assert.NotNil(t, h265) {
+		assert.Equal(t, "H265-main", h265.Name())
+	}
+	if tagged := decoded.CodecsByTag("desktop", RTPCodecTypeVideo); assert.Len(t, tagged, 2) {
+		assert.Equal(t, PayloadType(96), tagged[0].PayloadType)
+	}
+	_, ok := decoded.codecDirections[payloadTypeKey{RTPCodecTypeAudio, 111}]
+	assert.False(t, ok)
+
+	other := mediaEngine.copy()
+	assert.True(t, other.Equal(mediaEngine))
+	assert.NoError(t, other.SetCodecEnabled(MimeTypeVP9, RTPCodecTypeVideo, true))
+	assert.False(t, other.Equal(mediaEngine))
+
+	// Invalid configuration leaves the MediaEngine as it was
+	assert.ErrorIs(t, decoded.UnmarshalJSON([]byte(`{"headerExtensions":[{"uri":"`+sdp.SDESMidURI+
+		`","video":true,"allowedDirections":["sendrecv"]}]}`)), ErrRegisterHeaderExtensionInvalidDirection)
+	assert.ErrorIs(t, decoded.UnmarshalJSON([]byte(`{"videoCodecs":[{"mimeType":"audio/opus","clockRate":48000,`+
+		`"payloadType":111}]}`)), ErrCodecMimeTypeMismatch)
+	assert.ErrorIs(t, decoded.UnmarshalJSON([]byte(`{"videoCodecs":[{"mimeType":"video/VP8","clockRate":90000,`+
+		`"payloadType":96,"direction":"inactive"}]}`)), ErrInvalidCodecDirection)
+	assert.True(t, decoded.Equal(mediaEngine))
+}
+
+func TestMediaEngineRequiresTwoByteExtensions(t *testing.T) {
+	const offerSdp = sdpHeader + `a=extmap-allow-mixed
+m=audio 9 UDP/TLS/RTP/SAVPF 111
+a=extmap:1 urn:example:extension-0
+a=rtpmap:111 opus/48000/2
+m=video 9 UDP/TLS/RTP/SAVPF 96
+a=extmap:16 urn:example:extension-0
+a=rtpmap:96 VP8/90000
+`
+
+	mediaEngine := &MediaEngine{}
+	assert.NoError(t, mediaEngine.RegisterDefaultCodecs())
+	assert.NoError(t, mediaEngine.RegisterHeaderExtension(
+		RTPHeaderExtensionCapability{URI: "urn:example:extension-0"}, RTPCodecTypeAudio,
+	))
+	for i := 0; i < 14; i++ {
+		assert.NoError(t, mediaEngine.RegisterHeaderExtension(
+			RTPHeaderExtensionCapability{URI: fmt.Sprintf("urn:example:extension-%d", i)}, RTPCodecTypeVideo,
+		))
+	}
+	assert.False(t, mediaEngine.RequiresTwoByteExtensions(RTPCodecTypeVideo))
+
+	assert.NoError(t, mediaEngine.RegisterHeaderExtension(
+		RTPHeaderExtensionCapability{URI: "urn:example:extension-14"}, RTPCodecTypeVideo,
+	))
+	assert.False(t, mediaEngine.RequiresTwoByteExtensions(RTPCodecTypeVideo))
+	assert.Len(t, mediaEngine.getRTPParametersByKind(
+		RTPCodecTypeVideo, []RTPTransceiverDirection{RTPTransceiverDirectionSendrecv},
+	).HeaderExtensions, 14)
+
+	mediaEngine.SetTwoByteHeaderExtensionIDs(true)
+	assert.True(t, mediaEngine.RequiresTwoByteExtensions(RTPCodecTypeVideo))
+	assert.False(t, mediaEngine.RequiresTwoByteExtensions(RTPCodecTypeAudio))
+	params := mediaEngine.getRTPParametersByKind(
+		RTPCodecTypeVideo, []RTPTransceiverDirection{RTPTransceiverDirectionSendrecv},
+	)
+	assert.Len(t, params.HeaderExtensions, 15)
+	assert.Contains(t, params.HeaderExtensions, RTPHeaderExtensionParameter{URI: "urn:example:extension-14", ID: 15})
+
+	negotiated := mediaEngine.copy()
+	s := mustParseSDP(t, offerSdp)
+	assert.NoError(t, negotiated.updateFromRemoteDescription(s))
+	assert.True(t, negotiated.RequiresTwoByteExtensions(RTPCodecTypeVideo))
+	assert.False(t, negotiated.RequiresTwoByteExtensions(RTPCodecTypeAudio))
+}
+
+func TestMediaEngineHeaderExtensionOrder(t *testing.T) {
+	const offerSdp = sdpHeader + `m=video 9 UDP/TLS/RTP/SAVPF 96
+a=extmap:9 urn:example:extension-0
+a=extmap:2 urn:example:extension-1
+a=extmap:12 urn:example:extension-2
+a=extmap:5 urn:example:extension-3
+a=extmap:1 urn:example:extension-4
+a=rtpmap:96 VP8/90000
+`
+
+	mediaEngine := &MediaEngine{}
+	assert.NoError(t, mediaEngine.RegisterDefaultCodecs())
+	for i := 0; i < 5; i++ {
+		assert.NoError(t, mediaEngine.RegisterHeaderExtension(
+			RTPHeaderExtensionCapability{URI: fmt.Sprintf("urn:example:extension-%d", i)}, RTPCodecTypeVideo,
+		))
+	}
+	mediaEngine = mediaEngine.copy()
+
+	s := mustParseSDP(t, offerSdp)
+	assert.NoError(t, mediaEngine.updateFromRemoteDescription(s))
+
+	ids := func(headerExtensions []RTPHeaderExtensionParameter) []int {
+		var ids []int
+		for _, extension := range headerExtensions {
+			ids = append(ids, extension.ID)
+		}
+
+		return ids
+	}
+	for i := 0; i < 10; i++ {
+		params := mediaEngine.getRTPParametersByKind(
+			RTPCodecTypeVideo, []RTPTransceiverDirection{RTPTransceiverDirectionSendrecv},
+		)
+		assert.Equal(t, []int{1, 2, 5, 9, 12}, ids(params.HeaderExtensions))
+
+		params, err := mediaEngine.getRTPParametersByPayloadType(96)
+		assert.NoError(t, err)
+		assert.Equal(t, []int{1, 2, 5, 9, 12}, ids(params.HeaderExtensions))
+	}
+}
+
+func TestMediaEngineCodecMaxBitrate(t *testing.T) {
+	mediaEngine := &MediaEngine{}
+	assert.NoError(t, mediaEngine.RegisterDefaultCodecs())
+
+	_, ok := mediaEngine.CodecMaxBitrate(DefaultPayloadTypeOpus)
+	assert.False(t, ok)
+
+	mediaEngine.SetCodecMaxBitrate("AUDIO/OPUS", 32000)
+	bps, ok := mediaEngine.CodecMaxBitrate(DefaultPayloadTypeOpus)
+	assert.True(t, ok)
+	assert.Equal(t, 32000, bps)
+
+	_, ok = mediaEngine.CodecMaxBitrate(DefaultPayloadTypeVP8)
+	assert.False(t, ok)
+	_, ok = mediaEngine.CodecMaxBitrate(127)
+	assert.False(t, ok)
+
+	bps, ok = mediaEngine.copy().CodecMaxBitrate(DefaultPayloadTypeOpus)
+	assert.True(t, ok)
+	assert.Equal(t, 32000, bps)
+
+	mediaEngine.SetCodecMaxBitrate(MimeTypeOpus, 0)
+	_, ok = mediaEngine.CodecMaxBitrate(DefaultPayloadTypeOpus)
+	assert.False(t, ok)
+}
+
+func TestMediaEngineRemoteCodecFilter(t *testing.T) {
+	const offerSdp = sdpHeader + `m=video 9 UDP/TLS/RTP/SAVPF 102 103 112 113
+a=rtpmap:102 H264/90000
+a=fmtp:102 level-asymmetry-allowed=1;packetization-mode=1;profile-level-id=42e015
+a=rtpmap:103 rtx/90000
+a=fmtp:103 apt=102
+a=rtpmap:112 H264/90000
+a=fmtp:112 level-asymmetry-allowed=1;packetization-mode=1;profile-level-id=42e01f
+a=rtpmap:113 rtx/90000
+a=fmtp:113 apt=112
+`
+	const minLevel = 0x1f
+
+	mediaEngine := &MediaEngine{}
+	assert.NoError(t, mediaEngine.RegisterDefaultCodecs())
+	mediaEngine.SetRemoteCodecFilter(func(codec RTPCodecParameters, typ RTPCodecType) bool {
+		assert.Equal(t, RTPCodecTypeVideo, typ)
+		if !strings.EqualFold(codec.MimeType, MimeTypeH264) {
+			return true
+		}
+
+		_, profileLevelID, _ := strings.Cut(codec.SDPFmtpLine, "profile-level-id=")
+		level, err := strconv.ParseUint(profileLevelID[4:6], 16, 8)
+
+		return err == nil && level >= minLevel
+	})
+
+	s := mustParseSDP(t, offerSdp)
+	assert.NoError(t, mediaEngine.PreflightRemoteDescription(s))
+	assert.NoError(t, mediaEngine.updateFromRemoteDescription(s))
+
+	assert.Equal(t, []PayloadType{112, 113}, codecPayloadTypes(mediaEngine.negotiatedVideoCodecs))
+
+	// The filter is run without the MediaEngine locked and may call into it
+	mediaEngine = &MediaEngine{}
+	assert.NoError(t, mediaEngine.RegisterDefaultCodecs())
+	mediaEngine.SetRemoteCodecFilter(func(_ RTPCodecParameters, typ RTPCodecType) bool {
+		return len(mediaEngine.CodecsByTag("hardware", typ)) == 0
+	})
+	assert.NoError(t, mediaEngine.PreflightRemoteDescription(s))
+	assert.NoError(t, mediaEngine.updateFromRemoteDescription(s))
+	assert.Len(t, mediaEngine.negotiatedVideoCodecs, 4)
+}
+
+func TestMediaEngineOpusDTXNegotiated(t *testing.T) {
+	const offerSdp = sdpHeader + `m=audio 9 UDP/TLS/RTP/SAVPF 111
+a=rtpmap:111 opus/48000/2
+a=fmtp:111 %s
+`
+
+	negotiate := func(fmtpLine, registered string) *MediaEngine {
+		mediaEngine := &MediaEngine{}
+		assert.NoError(t, mediaEngine.RegisterCodec(RTPCodecParameters{
+			RTPCodecCapability: RTPCodecCapability{MimeTypeOpus, 48000, 2, registered, nil},
+			PayloadType:        111,
+		}, RTPCodecTypeAudio))
+		assert.False(t, mediaEngine.OpusDTXNegotiated())
+
+		s := mustParseSDP(t, fmt.Sprintf(offerSdp, fmtpLine))
+		assert.NoError(t, mediaEngine.updateFromRemoteDescription(s))
+		assert.Len(t, mediaEngine.negotiatedAudioCodecs, 1)
+
+		return mediaEngine
+	}
+
+	t.Run("DTX", func(t *testing.T) {
+		mediaEngine := negotiate("minptime=10;useinbandfec=1;usedtx=1", "minptime=10;usedtx=1")
+		assert.True(t, mediaEngine.OpusDTXNegotiated())
+
+		mediaEngine.ResetNegotiation()
+		assert.False(t, mediaEngine.OpusDTXNegotiated())
+	})
+
+	t.Run("Without DTX", func(t *testing.T) {
+		assert.False(t, negotiate("minptime=10;useinbandfec=1", "minptime=10;usedtx=1").OpusDTXNegotiated())
+	})
+
+	t.Run("DTX Declined", func(t *testing.T) {
+		// usedtx doesn't prevent the codecs from matching, ours ends up in the negotiated codec
+		mediaEngine := negotiate("minptime=10;usedtx=0", "minptime=10;usedtx=1")
+		assert.False(t, mediaEngine.OpusDTXNegotiated())
+		assert.Equal(t, "minptime=10;usedtx=1", mediaEngine.negotiatedAudioCodecs[0].SDPFmtpLine)
+	})
+}
+
+func TestMediaEngineNegotiatedPayloadTypes(t *testing.T) {
+	const offerSdp = sdpHeader + `m=audio 9 UDP/TLS/RTP/SAVPF 111 0
+a=rtpmap:111 opus/48000/2
+a=rtpmap:0 PCMU/8000
+m=video 9 UDP/TLS/RTP/SAVPF 98 96 97
+a=rtpmap:98 VP9/90000
+a=fmtp:98 profile-id=0
+a=rtpmap:96 VP8/90000
+a=rtpmap:97 rtx/90000
+a=fmtp:97 apt=96
+`
+
+	mediaEngine := &MediaEngine{}
+	assert.NoError(t, mediaEngine.RegisterDefaultCodecs())
+	assert.Empty(t, mediaEngine.NegotiatedPayloadTypes())
+
+	s := mustParseSDP(t, offerSdp)
+	assert.NoError(t, mediaEngine.updateFromRemoteDescription(s))
+	assert.Equal(t, []PayloadType{0, 96, 97, 98, 111}, mediaEngine.NegotiatedPayloadTypes())
+}
+
+func TestMediaEnginePLISupported(t *testing.T) {
+	const offerSdp = sdpHeader + `m=video 9 UDP/TLS/RTP/SAVPF 96 98
+a=rtpmap:96 VP8/90000
+a=rtcp-fb:96 nack
+a=rtcp-fb:96 nack pli
+a=rtpmap:98 VP9/90000
+a=fmtp:98 profile-id=0
+a=rtcp-fb:98 nack
+a=rtcp-fb:98 nack pli
+`
+
+	mediaEngine := &MediaEngine{}
+	assert.NoError(t, mediaEngine.RegisterCodec(RTPCodecParameters{
+		RTPCodecCapability: RTPCodecCapability{MimeTypeVP8, 90000, 0, "", []RTCPFeedback{{Type: TypeRTCPFBNACK}}},
+		PayloadType:        96,
+	}, RTPCodecTypeVideo))
+	assert.NoError(t, mediaEngine.RegisterCodec(RTPCodecParameters{
+		RTPCodecCapability: RTPCodecCapability{
+			MimeTypeVP9, 90000, 0, "profile-id=0",
+			[]RTCPFeedback{{Type: TypeRTCPFBNACK}, {Type: TypeRTCPFBNACK, Parameter: "pli"}},
+		},
+		PayloadType: 98,
+	}, RTPCodecTypeVideo))
+	assert.False(t, mediaEngine.PLISupported(96))
+	assert.True(t, mediaEngine.PLISupported(98))
+
+	s := mustParseSDP(t, offerSdp)
+	assert.NoError(t, mediaEngine.updateFromRemoteDescription(s))
+
+	codec, _, err := mediaEngine.getCodecByPayload(96)
+	assert.NoError(t, err)
+	assert.Equal(t, []RTCPFeedback{{Type: TypeRTCPFBNACK}}, codec.RTCPFeedback)
+	assert.False(t, mediaEngine.PLISupported(96))
+	assert.True(t, mediaEngine.PLISupported(98))
+	assert.False(t, mediaEngine.PLISupported(100))
+}
+
+func TestMediaEngineNegotiationError(t *testing.T) {
+	const offerSdp = sdpHeader + `m=audio 9 UDP/TLS/RTP/SAVPF 111
+a=rtpmap:111 opus/48000/2
+m=video 9 UDP/TLS/RTP/SAVPF 96 97
+a=rtpmap:96 VP8/90000
+a=rtpmap:97 rtx/90000
+a=fmtp:97 apt=vp8
+`
+
+	mediaEngine := &MediaEngine{}
+	assert.NoError(t, mediaEngine.RegisterDefaultCodecs())
+
+	s := mustParseSDP(t, offerSdp)
+
+	for _, err := range []error{mediaEngine.PreflightRemoteDescription(s), mediaEngine.updateFromRemoteDescription(s)} {
+		var negotiationErr *NegotiationError
+		if assert.ErrorAs(t, err, &negotiationErr) {
+			assert.Equal(t, 1, negotiationErr.MediaIndex)
+			assert.Equal(t, RTPCodecTypeVideo, negotiationErr.Kind)
+			assert.True(t, negotiationErr.HasPayloadType)
+			assert.Equal(t, PayloadType(97), negotiationErr.PayloadType)
+			assert.Empty(t, negotiationErr.URI)
+			assert.ErrorIs(t, err, strconv.ErrSyntax)
+		}
+		assert.EqualError(t, err, `media section 1 (video): payload type 97: invalid apt "vp8": `+
+			`strconv.ParseUint: parsing "vp8": invalid syntax`)
+	}
+
+	// Errors about a kind rather than a media section
+	required := &MediaEngine{}
+	required.SetRequireUsableCodecs(true)
+	assert.NoError(t, required.RegisterCodec(RTPCodecParameters{
+		RTPCodecCapability: RTPCodecCapability{MimeType: MimeTypePCMU, ClockRate: 8000},
+		PayloadType:        0,
+	}, RTPCodecTypeAudio))
+	s = mustParseSDP(t, strings.ReplaceAll(offerSdp, "a=fmtp:97 apt=vp8\n", "a=fmtp:97 apt=96\n"))
+	err := required.updateFromRemoteDescription(s)
+	var negotiationErr *NegotiationError
+	if assert.ErrorAs(t, err, &negotiationErr) {
+		assert.Equal(t, -1, negotiationErr.MediaIndex)
+		assert.Equal(t, RTPCodecTypeAudio, negotiationErr.Kind)
+		assert.False(t, negotiationErr.HasPayloadType)
+		assert.ErrorIs(t, err, ErrNoCommonCodecs)
+	}
+}
+
+func TestMediaEngineAsymmetricCodecs(t *testing.T) {
+	const offerSdp = sdpHeader + `m=video 9 UDP/TLS/RTP/SAVPF 102 103
+a=mid:0
+a=sendonly
+a=rtpmap:102 H264/90000
+a=fmtp:102 level-asymmetry-allowed=1;packetization-mode=1;profile-level-id=42e01f
+a=rtpmap:103 rtx/90000
+a=fmtp:103 apt=102
+m=video 9 UDP/TLS/RTP/SAVPF 96
+a=mid:1
+a=recvonly
+a=rtpmap:96 VP8/90000
+m=video 9 UDP/TLS/RTP/SAVPF 98
+a=mid:2
+a=rtpmap:98 VP9/90000
+a=fmtp:98 profile-id=0
+`
+
+	mediaEngine := &MediaEngine{}
+	assert.NoError(t, mediaEngine.RegisterDefaultCodecs())
+
+	s := mustParseSDP(t, offerSdp)
+	assert.NoError(t, mediaEngine.updateFromRemoteDescription(s))
+
+	// VP9 of the sendrecv section isn't added, only directional sections add codecs. VP8 is
+	// kept out of the codecs transceivers use for video.
+	assert.Equal(t, []PayloadType{102, 103}, codecPayloadTypes(mediaEngine.negotiatedVideoCodecs))
+	assert.Equal(t, []PayloadType{102, 103}, codecPayloadTypes(mediaEngine.getCodecsByKind(RTPCodecTypeVideo)))
+	assert.Equal(t, []PayloadType{102, 103},
+		codecPayloadTypes(mediaEngine.NegotiatedCodecsForDirection(RTPCodecTypeVideo, RTPTransceiverDirectionRecvonly)))
+	assert.Equal(t, []PayloadType{96},
+		codecPayloadTypes(mediaEngine.NegotiatedCodecsForDirection(RTPCodecTypeVideo, RTPTransceiverDirectionSendonly)))
+	assert.Empty(t, mediaEngine.NegotiatedCodecsForDirection(RTPCodecTypeVideo, RTPTransceiverDirectionSendrecv))
+
+	// Once the remote sends and receives VP8 it is used in both directions
+	s = mustParseSDP(t, strings.Replace(offerSdp, "a=recvonly", "a=sendrecv", 1))
+	assert.NoError(t, mediaEngine.updateFromRemoteDescription(s))
+	assert.Equal(t, []PayloadType{102, 103, 96},
+		codecPayloadTypes(mediaEngine.NegotiatedCodecsForDirection(RTPCodecTypeVideo, RTPTransceiverDirectionRecvonly)))
+	assert.Equal(t, []PayloadType{96},
+		codecPayloadTypes(mediaEngine.NegotiatedCodecsForDirection(RTPCodecTypeVideo, RTPTransceiverDirectionSendrecv)))
+
+	// Negotiating multiple codecs adds the codecs of every section to the codecs of the kind
+	mediaEngine = &MediaEngine{}
+	assert.NoError(t, mediaEngine.RegisterDefaultCodecs())
+	mediaEngine.setMultiCodecNegotiation(true)
+	s = mustParseSDP(t, offerSdp)
+	assert.NoError(t, mediaEngine.updateFromRemoteDescription(s))
+	assert.Equal(t, []PayloadType{102, 103, 96, 98}, codecPayloadTypes(mediaEngine.negotiatedVideoCodecs))
+	assert.Equal(t, []PayloadType{96, 98},
+		codecPayloadTypes(mediaEngine.NegotiatedCodecsForDirection(RTPCodecTypeVideo, RTPTransceiverDirectionSendonly)))
+}
+
+func TestMediaEngineSeedNegotiatedPayloadTypes(t *testing.T) {
+	const answerSdp = sdpHeader + `m=video 9 UDP/TLS/RTP/SAVPF 96 101
+a=rtpmap:96 VP8/90000
+a=rtpmap:101 rtx/90000
+a=fmtp:101 apt=96
+`
+	newMediaEngine := func() *MediaEngine {
+		mediaEngine := &MediaEngine{}
+		for _, codec := range []RTPCodecParameters{
+			{RTPCodecCapability: RTPCodecCapability{MimeTypeVP9, 90000, 0, "profile-id=0", nil}, PayloadType: 96},
+			{RTPCodecCapability: RTPCodecCapability{MimeTypeRTX, 90000, 0, "apt=96", nil}, PayloadType: 97},
+			{RTPCodecCapability: RTPCodecCapability{MimeTypeVP8, 90000, 0, "", nil}, PayloadType: 100},
+			{RTPCodecCapability: RTPCodecCapability{MimeTypeRTX, 90000, 0, "apt=100", nil}, PayloadType: 101},
+		} {
+			assert.NoError(t, mediaEngine.RegisterCodec(codec, RTPCodecTypeVideo))
+		}
+
+		return mediaEngine
+	}
+
+	mediaEngine := newMediaEngine()
+	mediaEngine.SeedNegotiatedPayloadTypes(map[string]PayloadType{"video/vp8": 96})
+	assert.Equal(t, "96 VP8/90000\n97 rtx/90000 apt=100\n100 VP9/90000 profile-id=0\n101 rtx/90000 apt=96\n",
+		mediaEngine.CodecTable(RTPCodecTypeVideo))
+
+	// The answer keeps the seeded payload type
+	s := mustParseSDP(t, answerSdp)
+	assert.NoError(t, mediaEngine.updateFromRemoteDescription(s))
+	assert.Equal(t, "96 VP8/90000\n101 rtx/90000 apt=96\n", mediaEngine.CodecTable(RTPCodecTypeVideo))
+
+	// Without the seed the offer uses the registered payload types
+	assert.Equal(t, "96 VP9/90000 profile-id=0\n97 rtx/90000 apt=96\n100 VP8/90000\n101 rtx/90000 apt=100\n",
+		newMediaEngine().CodecTable(RTPCodecTypeVideo))
+
+	// Seeds colliding with codecs of the other kind are ignored
+	mediaEngine = newMediaEngine()
+	assert.NoError(t, mediaEngine.RegisterCodec(RTPCodecParameters{
+		RTPCodecCapability: RTPCodecCapability{MimeType: MimeTypeOpus, ClockRate: 48000, Channels: 2}, PayloadType: 111,
+	}, RTPCodecTypeAudio))
+	mediaEngine.SeedNegotiatedPayloadTypes(map[string]PayloadType{"video/VP9 profile-id=0": 111, "video/VP8": 102})
+	assert.Equal(t, "96 VP9/90000 profile-id=0\n97 rtx/90000 apt=96\n101 rtx/90000 apt=102\n102 VP8/90000\n",
+		mediaEngine.CodecTable(RTPCodecTypeVideo))
+
+	// Settings made for the registered payload types follow the codecs they swapped
+	mediaEngine = newMediaEngine()
+	assert.NoError(t, mediaEngine.SetCodecDirection(100, RTPCodecTypeVideo, RTPTransceiverDirectionSendonly))
+	mediaEngine.SetCodecMaxBitrate(MimeTypeVP8, 500_000)
+	mediaEngine.SeedNegotiatedPayloadTypes(map[string]PayloadType{"video/VP8": 96})
+	assert.Equal(t, []PayloadType{100, 97},
+		codecPayloadTypes(mediaEngine.NegotiatedCodecsForDirection(RTPCodecTypeVideo, RTPTransceiverDirectionRecvonly)))
+	assert.Equal(t, []PayloadType{100, 97, 96, 101},
+		codecPayloadTypes(mediaEngine.NegotiatedCodecsForDirection(RTPCodecTypeVideo, RTPTransceiverDirectionSendonly)))
+	bps, ok := mediaEngine.CodecMaxBitrate(96)
+	assert.True(t, ok)
+	assert.Equal(t, 500_000, bps)
+	_, ok = mediaEngine.CodecMaxBitrate(100)
+	assert.False(t, ok)
+}
+
+func TestMediaEngineNegotiatedClockRate(t *testing.T) {
+	const offerSdp = sdpHeader + `m=audio 9 UDP/TLS/RTP/SAVPF 0 9
+a=rtpmap:0 PCMU/8000
+a=rtpmap:9 G722/8000
+m=video 9 UDP/TLS/RTP/SAVPF 96
+a=rtpmap:96 VP8/90000
+`
+
+	mediaEngine := &MediaEngine{}
+	assert.NoError(t, mediaEngine.RegisterCodec(RTPCodecParameters{
+		RTPCodecCapability: RTPCodecCapability{MimeTypeVP8, 0, 0, "", nil},
+		PayloadType:        100,
+	}, RTPCodecTypeVideo))
+	for _, codec := range []RTPCodecParameters{
+		{RTPCodecCapability: RTPCodecCapability{MimeTypePCMU, 0, 0, "", nil}, PayloadType: 0},
+		{RTPCodecCapability: RTPCodecCapability{MimeTypeG722, 8000, 0, "", nil}, PayloadType: 9},
+	} {
+		assert.NoError(t, mediaEngine.RegisterCodec(codec, RTPCodecTypeAudio))
+	}
+
+	_, ok := mediaEngine.NegotiatedClockRate(100, RTPCodecTypeVideo)
+	assert.False(t, ok)
+
+	s := mustParseSDP(t, offerSdp)
+	assert.NoError(t, mediaEngine.updateFromRemoteDescription(s))
+
+	for _, test := range []struct {
+		payloadType PayloadType
+		typ         RTPCodecType
+		clockRate   uint32
+	}{
+		{96, RTPCodecTypeVideo, 90000},
+		{0, RTPCodecTypeAudio, 8000},
+		{9, RTPCodecTypeAudio, 8000},
+	} {
+		clockRate, ok := mediaEngine.NegotiatedClockRate(test.payloadType, test.typ)
+		assert.True(t, ok)
+		assert.Equal(t, test.clockRate, clockRate)
+	}
+	_, ok = mediaEngine.NegotiatedClockRate(100, RTPCodecTypeVideo)
+	assert.False(t, ok)
+	_, ok = mediaEngine.NegotiatedClockRate(96, RTPCodecTypeAudio)
+	assert.False(t, ok)
+}
+
+func TestMediaEnginePayloadTypeOfBothKinds(t *testing.T) {
+	const offerSdp = sdpHeader + `m=audio 9 UDP/TLS/RTP/SAVPF 96
+a=rtpmap:96 opus/48000/2
+a=fmtp:96 usedtx=1
+a=sendonly
+m=video 9 UDP/TLS/RTP/SAVPF 96 97
+a=rtpmap:96 VP8/90000
+a=rtpmap:97 rtx/90000
+a=fmtp:97 apt=96
+`
+
+	mediaEngine := &MediaEngine{}
+	assert.NoError(t, mediaEngine.RegisterCodec(RTPCodecParameters{
+		RTPCodecCapability: RTPCodecCapability{MimeTypeOpus, 48000, 2, "", nil}, PayloadType: 111,
+	}, RTPCodecTypeAudio))
+	for _, codec := range []RTPCodecParameters{
+		{RTPCodecCapability: RTPCodecCapability{MimeTypeVP8, 90000, 0, "", nil}, PayloadType: 111},
+		{RTPCodecCapability: RTPCodecCapability{MimeTypeRTX, 90000, 0, "apt=111", nil}, PayloadType: 112},
+	} {
+		assert.NoError(t, mediaEngine.RegisterCodec(codec, RTPCodecTypeVideo))
+	}
+	assert.NoError(t, mediaEngine.SetCodecDirection(111, RTPCodecTypeVideo, RTPTransceiverDirectionSendonly))
+	assert.NoError(t, mediaEngine.updateFromRemoteDescription(mustParseSDP(t, offerSdp)))
+
+	// Each kind keeps its own state for payload type 96
+	for _, test := range []struct {
+		typ       RTPCodecType
+		mime      string
+		clockRate uint32
+	}{
+		{RTPCodecTypeAudio, MimeTypeOpus, 48000},
+		{RTPCodecTypeVideo, MimeTypeVP8, 90000},
+	} {
+		clockRate, ok := mediaEngine.NegotiatedClockRate(96, test.typ)
+		assert.True(t, ok)
+		assert.Equal(t, test.clockRate, clockRate)
+
+		local, ok := mediaEngine.LocalCapabilityForPayloadType(96, test.typ)
+		assert.True(t, ok)
+		assert.Equal(t, test.mime, local.MimeType)
+	}
+	rtxPayloadType, ok := mediaEngine.RTXPayloadType(96, RTPCodecTypeVideo)
+	assert.True(t, ok)
+	assert.Equal(t, PayloadType(97), rtxPayloadType)
+	_, ok = mediaEngine.RTXPayloadType(96, RTPCodecTypeAudio)
+	assert.False(t, ok)
+	assert.True(t, mediaEngine.OpusDTXNegotiated())
+
+	// The remote only sends audio, video 111 is restricted to sending
+	assert.Equal(t, []PayloadType{96},
+		codecPayloadTypes(mediaEngine.NegotiatedCodecsForDirection(RTPCodecTypeAudio, RTPTransceiverDirectionRecvonly)))
+	assert.Empty(t, mediaEngine.NegotiatedCodecsForDirection(RTPCodecTypeAudio, RTPTransceiverDirectionSendonly))
+	assert.Equal(t, []PayloadType{96, 97},
+		codecPayloadTypes(mediaEngine.NegotiatedCodecsForDirection(RTPCodecTypeVideo, RTPTransceiverDirectionSendonly)))
+	assert.Empty(t, mediaEngine.NegotiatedCodecsForDirection(RTPCodecTypeVideo, RTPTransceiverDirectionRecvonly))
+}
+
+func TestMediaEngineRegisterHeaderExtensions(t *testing.T) {
+	extensions := []RTPHeaderExtensionCapability{
+		{URI: sdp.SDESMidURI},
+		{URI: sdp.SDESRTPStreamIDURI},
+		{URI: GenericFrameDescriptorURI},
+	}
+
+	t.Run("Success", func(t *testing.T) {
+		mediaEngine := &MediaEngine{}
+		assert.NoError(t, mediaEngine.RegisterHeaderExtensions(
+			extensions, RTPCodecTypeVideo, RTPTransceiverDirectionSendonly,
+		))
+		assert.Len(t, mediaEngine.headerExtensions, 3)
+	})
+
+	t.Run("Invalid Direction", func(t *testing.T) {
+		mediaEngine := &MediaEngine{}
+		assert.ErrorIs(t, mediaEngine.RegisterHeaderExtensions(
+			extensions, RTPCodecTypeVideo, RTPTransceiverDirectionSendrecv,
+		), ErrRegisterHeaderExtensionInvalidDirection)
+		assert.Empty(t, mediaEngine.headerExtensions)
+	})
+
+	t.Run("Rollback", func(t *testing.T) {
+		mediaEngine := &MediaEngine{}
+		assert.NoError(t, mediaEngine.RegisterHeaderExtension(
+			RTPHeaderExtensionCapability{URI: sdp.AudioLevelURI}, RTPCodecTypeAudio,
+		))
+
+		// The generic frame descriptor can't be used for audio
+		assert.ErrorIs(t, mediaEngine.RegisterHeaderExtensions(
+			extensions, RTPCodecTypeAudio,
+		), ErrHeaderExtensionInvalidKind)
+		assert.Len(t, mediaEngine.headerExtensions, 1)
+		assert.Equal(t, sdp.AudioLevelURI, mediaEngine.headerExtensions[0].uri)
+	})
+}
+
+func TestMediaEngineHeaderExtensionAllowsDirection(t *testing.T) {
+	mediaEngine := &MediaEngine{}
+	assert.NoError(t, mediaEngine.RegisterHeaderExtension(
+		RTPHeaderExtensionCapability{URI: sdp.SDESMidURI}, RTPCodecTypeVideo, RTPTransceiverDirectionSendonly,
+	))
+	assert.NoError(t, mediaEngine.RegisterHeaderExtension(
+		RTPHeaderExtensionCapability{URI: sdp.TransportCCURI}, RTPCodecTypeVideo,
+	))
+
+	assert.True(t, mediaEngine.HeaderExtensionAllowsDirection(sdp.SDESMidURI, RTPTransceiverDirectionSendonly))
+	assert.False(t, mediaEngine.HeaderExtensionAllowsDirection(sdp.SDESMidURI, RTPTransceiverDirectionRecvonly))
+	assert.False(t, mediaEngine.HeaderExtensionAllowsDirection(sdp.SDESMidURI, RTPTransceiverDirectionSendrecv))
+
+	assert.True(t, mediaEngine.HeaderExtensionAllowsDirection(sdp.TransportCCURI, RTPTransceiverDirectionSendrecv))
+
+	assert.False(t, mediaEngine.HeaderExtensionAllowsDirection(sdp.AudioLevelURI, RTPTransceiverDirectionSendonly))
+}
+
+func TestMediaEngineMaxNegotiatedCodecs(t *testing.T) {
+	// Payload types are 7 bits, so offer as many distinct ones as fit. The fmtp lines
+	// differ, identical codecs would be negotiated once
+	var formats, rtpmaps strings.Builder
+	codecCount := 0
+	for payloadType := 1; payloadType < 128; payloadType++ {
+		if payloadType == 8 || payloadType == 9 {
+			continue
+		}
+
+		fmt.Fprintf(&formats, " %d", payloadType)
+		fmt.Fprintf(&rtpmaps, "a=rtpmap:%d VP8/90000\na=fmtp:%d max-fr=%d\n", payloadType, payloadType, payloadType)
+		codecCount++
+	}
+	offerSdp := sdpHeader +
+		"m=video 60323 UDP/TLS/RTP/SAVPF" + formats.String() + "\n" + rtpmaps.String()
+
+	s := mustParseSDP(t, offerSdp)
+
+	mediaEngine := MediaEngine{}
+	assert.NoError(t, mediaEngine.RegisterDefaultCodecs())
+	unlimited := mediaEngine.copy()
+	assert.NoError(t, unlimited.updateFromRemoteDescription(s))
+	assert.Len(t, unlimited.negotiatedVideoCodecs, codecCount)
+
+	mediaEngine.SetMaxNegotiatedCodecs(10)
+	limited := mediaEngine.copy()
+	assert.NoError(t, limited.updateFromRemoteDescription(s))
+	assert.Len(t, limited.negotiatedVideoCodecs, 10)
+}
+
+func TestMediaEngineNegotiationMetrics(t *testing.T) {
+	const offerSdp = sdpHeader + `m=audio 9 UDP/TLS/RTP/SAVPF 111 112
+a=rtpmap:111 opus/48000/2
+a=rtpmap:112 L16/48000/2
+m=video 9 UDP/TLS/RTP/SAVPF 96 97 98 99
+a=rtpmap:96 VP8/90000
+a=rtpmap:97 rtx/90000
+a=fmtp:97 apt=96
+a=rtpmap:98 VP9/90000
+a=fmtp:98 profile-id=1
+a=rtpmap:99 VVC/90000
+`
+	mediaEngine := &MediaEngine{}
+	assert.NoError(t, mediaEngine.RegisterDefaultCodecs())
+	mediaEngine = mediaEngine.copy()
+	assert.Equal(t, NegotiationMetrics{}, mediaEngine.NegotiationMetrics())
+
+	s := mustParseSDP(t, offerSdp)
+	assert.NoError(t, mediaEngine.updateFromRemoteDescription(s))
+	assert.Equal(t, NegotiationMetrics{
+		RemoteDescriptions: 1,
+		ExactMatches:       3,
+		PartialMatches:     1,
+		DroppedCodecs:      2,
+	}, mediaEngine.NegotiationMetrics())
+
+	// Sections of a renegotiation are counted even if they don't add codecs
+	assert.NoError(t, mediaEngine.updateFromRemoteDescription(s))
+	assert.Equal(t, NegotiationMetrics{
+		RemoteDescriptions: 2,
+		ExactMatches:       6,
+		PartialMatches:     2,
+		DroppedCodecs:      4,
+	}, mediaEngine.NegotiationMetrics())
+
+	mediaEngine.ResetNegotiation()
+	assert.Equal(t, NegotiationMetrics{}, mediaEngine.NegotiationMetrics())
+
+	// Remote descriptions that fail to apply aren't counted
+	mediaEngine = &MediaEngine{}
+	assert.NoError(t, mediaEngine.RegisterDefaultCodecs())
+	mediaEngine.SetRequireUsableCodecs(true)
+	assert.ErrorIs(t, mediaEngine.updateFromRemoteDescription(mustParseSDP(t, sdpHeader+`m=video 9 UDP/TLS/RTP/SAVPF 99
+a=rtpmap:99 VVC/90000
+`)), ErrNoCommonCodecs)
+	assert.Equal(t, NegotiationMetrics{}, mediaEngine.NegotiationMetrics())
+}
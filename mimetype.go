@@ -13,6 +13,9 @@ const (
 	// MimeTypeOpus Opus MIME type
 	// Note: Matching should be case insensitive.
 	MimeTypeOpus = "audio/opus"
+	// MimeTypeMultiopus multi-channel Opus MIME type
+	// Note: Matching should be case insensitive.
+	MimeTypeMultiopus = "audio/multiopus"
 	// MimeTypeVP8 VP8 MIME type
 	// Note: Matching should be case insensitive.
 	MimeTypeVP8 = "video/VP8"
@@ -2983,7 +2983,9 @@ func (pc *PeerConnection) generateMatchedSDP(
 	if pc.pendingRemoteDescription != nil {
 		remoteDescription = pc.pendingRemoteDescription
 	}
-	isExtmapAllowMixed := isExtMapAllowMixedSet(remoteDescription.parsed)
+	isExtmapAllowMixed := isExtMapAllowMixedSet(remoteDescription.parsed) ||
+		includeUnmatched && (pc.api.mediaEngine.RequiresTwoByteExtensions(RTPCodecTypeAudio) ||
+			pc.api.mediaEngine.RequiresTwoByteExtensions(RTPCodecTypeVideo))
 	localTransceivers := append([]*RTPTransceiver{}, transceivers...)
 
 	detectedPlanB := descriptionIsPlanB(remoteDescription, pc.log)
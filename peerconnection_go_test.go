@@ -1785,25 +1785,25 @@ a=fmtp:49 level-id=93;profile-id=1;tier-flag=0;tx-mode=SRST
 
 		codecsOfTr1 := pc.GetTransceivers()[0].getCodecs()
 		_, matchType := codecParametersFuzzySearch(codecsOfTr1[0], codecs)
-		assert.Equal(t, codecMatchExact, matchType)
+		assert.Equal(t, CodecMatchExact, matchType)
 		assert.EqualValues(t, 98, codecsOfTr1[0].PayloadType)
 		_, matchType = codecParametersFuzzySearch(codecsOfTr1[1], codecs)
-		assert.Equal(t, codecMatchExact, matchType)
+		assert.Equal(t, CodecMatchExact, matchType)
 		assert.EqualValues(t, 94, codecsOfTr1[1].PayloadType)
 		_, matchType = codecParametersFuzzySearch(codecsOfTr1[2], codecs)
-		assert.Equal(t, codecMatchExact, matchType)
+		assert.Equal(t, CodecMatchExact, matchType)
 		assert.EqualValues(t, 49, codecsOfTr1[2].PayloadType)
 
 		codecsOfTr2 := pc.GetTransceivers()[1].getCodecs()
 		_, matchType = codecParametersFuzzySearch(codecsOfTr2[0], codecs)
-		assert.Equal(t, codecMatchExact, matchType)
+		assert.Equal(t, CodecMatchExact, matchType)
 		assert.EqualValues(t, 94, codecsOfTr2[0].PayloadType)
 		_, matchType = codecParametersFuzzySearch(codecsOfTr2[1], codecs)
-		assert.Equal(t, codecMatchExact, matchType)
+		assert.Equal(t, CodecMatchExact, matchType)
 		assert.EqualValues(t, 98, codecsOfTr2[1].PayloadType)
 		// as H.265 (49) is a partial match, it gets pushed to the end
 		_, matchType = codecParametersFuzzySearch(codecsOfTr2[2], codecs)
-		assert.Equal(t, codecMatchPartial, matchType)
+		assert.Equal(t, CodecMatchPartial, matchType)
 		assert.EqualValues(t, 49, codecsOfTr2[2].PayloadType)
 
 		assert.NoError(t, pc.Close())
@@ -1866,19 +1866,19 @@ a=sendonly
 
 		codecsOfTr1 := pc.GetTransceivers()[0].getCodecs()
 		_, matchType := codecParametersFuzzySearch(codecsOfTr1[0], codecs)
-		assert.Equal(t, codecMatchExact, matchType)
+		assert.Equal(t, CodecMatchExact, matchType)
 		assert.EqualValues(t, 98, codecsOfTr1[0].PayloadType)
 		_, matchType = codecParametersFuzzySearch(codecsOfTr1[1], codecs)
-		assert.Equal(t, codecMatchExact, matchType)
+		assert.Equal(t, CodecMatchExact, matchType)
 		assert.EqualValues(t, 106, codecsOfTr1[1].PayloadType)
 
 		codecsOfTr2 := pc.GetTransceivers()[1].getCodecs()
 		_, matchType = codecParametersFuzzySearch(codecsOfTr2[0], codecs)
-		assert.Equal(t, codecMatchExact, matchType)
+		assert.Equal(t, CodecMatchExact, matchType)
 		// h.264/profile-id=640032 should be remap to 106 as same as transceiver 1
 		assert.EqualValues(t, 106, codecsOfTr2[0].PayloadType)
 		_, matchType = codecParametersFuzzySearch(codecsOfTr2[1], codecs)
-		assert.Equal(t, codecMatchExact, matchType)
+		assert.Equal(t, CodecMatchExact, matchType)
 		assert.EqualValues(t, 98, codecsOfTr2[1].PayloadType)
 
 		assert.NoError(t, pc.Close())
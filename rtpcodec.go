@@ -4,10 +4,10 @@
 package webrtc
 
 import (
-	"fmt"
 	"strconv"
 	"strings"
 
+	"github.com/pion/rtp"
 	"github.com/pion/webrtc/v4/internal/fmtp"
 )
 
@@ -84,6 +84,45 @@ type RTPCodecParameters struct {
 	PayloadType PayloadType
 
 	statsID string
+	name    string
+}
+
+// Name returns the name the codec was registered with by MediaEngine.RegisterNamedCodec,
+// or an empty string. It is kept by the local codecs passed to the handler of
+// MediaEngine.OnCodecMatch.
+func (c RTPCodecParameters) Name() string {
+	return c.name
+}
+
+// displayName returns the name the codec was registered with, or one derived
+// from its MimeType and fmtp line.
+func (c RTPCodecParameters) displayName() string {
+	switch {
+	case c.name != "":
+		return c.name
+	case c.SDPFmtpLine != "":
+		return c.MimeType + ";" + c.SDPFmtpLine
+	default:
+		return c.MimeType
+	}
+}
+
+// HasStaticPayloadType returns true if the payload type of the codec is in the
+// static range assigned by RFC 3551, e.g. 0 for PCMU. These payload types are
+// fixed, the MediaEngine never assigns them to another codec.
+func (c RTPCodecParameters) HasStaticPayloadType() bool {
+	return c.PayloadType < rtp.PayloadTypeFirstDynamic
+}
+
+// EqualIgnoringFeedback returns true if c and other have the same MimeType, ClockRate,
+// Channels and SDPFmtpLine. Their RTCPFeedback is not compared, it often depends on the
+// interceptors of the environment rather than the codec. Neither is the PayloadType,
+// which is assigned per MediaEngine or negotiation.
+func (c RTPCodecParameters) EqualIgnoringFeedback(other RTPCodecParameters) bool {
+	return strings.EqualFold(c.MimeType, other.MimeType) &&
+		c.ClockRate == other.ClockRate &&
+		c.Channels == other.Channels &&
+		c.SDPFmtpLine == other.SDPFmtpLine
 }
 
 // RTPParameters is a list of negotiated codecs and header extensions
@@ -94,21 +133,33 @@ type RTPParameters struct {
 	Codecs           []RTPCodecParameters
 }
 
-type codecMatchType int
+// CodecMatchType describes how well a remote codec matches a local one.
+type CodecMatchType int
 
 const (
-	codecMatchNone    codecMatchType = 0
-	codecMatchPartial codecMatchType = 1
-	codecMatchExact   codecMatchType = 2
+	// CodecMatchNone means the codecs don't match.
+	CodecMatchNone CodecMatchType = 0
+	// CodecMatchPartial means MimeType, ClockRate and Channels match but the fmtp parameters don't.
+	CodecMatchPartial CodecMatchType = 1
+	// CodecMatchExact means the codecs, including their fmtp parameters, match.
+	CodecMatchExact CodecMatchType = 2
 )
 
+// FmtpEqual returns true if the fmtp lines a and b of a codec with mimeType,
+// clockRate and channels describe the same media format. These are the semantics
+// used to match codecs in negotiation: the order of parameters doesn't matter, and
+// per codec rules apply, e.g. the level of an H264 profile-level-id is ignored.
+func FmtpEqual(mimeType string, clockRate uint32, channels uint16, a, b string) bool {
+	return fmtp.Parse(mimeType, clockRate, channels, a).Match(fmtp.Parse(mimeType, clockRate, channels, b))
+}
+
 // Do a fuzzy find for a codec in the list of codecs
 // Used for lookup up a codec in an existing list to find a match
-// Returns codecMatchExact, codecMatchPartial, or codecMatchNone.
+// Returns CodecMatchExact, CodecMatchPartial, or CodecMatchNone.
 func codecParametersFuzzySearch(
 	needle RTPCodecParameters,
 	haystack []RTPCodecParameters,
-) (RTPCodecParameters, codecMatchType) {
+) (RTPCodecParameters, CodecMatchType) {
 	needleFmtp := fmtp.Parse(
 		needle.RTPCodecCapability.MimeType,
 		needle.RTPCodecCapability.ClockRate,
@@ -124,10 +175,15 @@ func codecParametersFuzzySearch(
 			c.RTPCodecCapability.SDPFmtpLine)
 
 		if needleFmtp.Match(cfmtp) {
-			return c, codecMatchExact
+			return c, CodecMatchExact
 		}
 	}
 
+	// Multiopus channel mappings must agree, there is no partial match
+	if strings.EqualFold(needle.RTPCodecCapability.MimeType, MimeTypeMultiopus) {
+		return RTPCodecParameters{}, CodecMatchNone
+	}
+
 	// Fallback to just MimeType + ClockRate + Channels
 	for _, c := range haystack {
 		if strings.EqualFold(c.RTPCodecCapability.MimeType, needle.RTPCodecCapability.MimeType) &&
@@ -137,18 +193,17 @@ func codecParametersFuzzySearch(
 			fmtp.ChannelsEqual(c.RTPCodecCapability.MimeType,
 				c.RTPCodecCapability.Channels,
 				needle.RTPCodecCapability.Channels) {
-			return c, codecMatchPartial
+			return c, CodecMatchPartial
 		}
 	}
 
-	return RTPCodecParameters{}, codecMatchNone
+	return RTPCodecParameters{}, CodecMatchNone
 }
 
 // Given a CodecParameters find the RTX CodecParameters if one exists.
 func findRTXPayloadType(needle PayloadType, haystack []RTPCodecParameters) PayloadType {
-	aptStr := fmt.Sprintf("apt=%d", needle)
 	for _, c := range haystack {
-		if aptStr == c.SDPFmtpLine {
+		if apt, ok := rtxAssociatedPayloadType(c); ok && apt == needle {
 			return c.PayloadType
 		}
 	}
@@ -156,6 +211,30 @@ func findRTXPayloadType(needle PayloadType, haystack []RTPCodecParameters) Paylo
 	return PayloadType(0)
 }
 
+// Given an RTX codec, returns the payload type of the primary codec it is associated with.
+func rtxAssociatedPayloadType(codec RTPCodecParameters) (PayloadType, bool) {
+	if !strings.EqualFold(codec.MimeType, MimeTypeRTX) {
+		return 0, false
+	}
+
+	// Scan the parameters in place, this is called from hot paths
+	for parameter := range strings.SplitSeq(codec.SDPFmtpLine, ";") {
+		key, value, _ := strings.Cut(strings.TrimSpace(parameter), "=")
+		if !strings.EqualFold(key, "apt") {
+			continue
+		}
+
+		primaryPayloadType, err := strconv.ParseUint(value, 10, 8)
+		if err != nil {
+			return 0, false
+		}
+
+		return PayloadType(primaryPayloadType), true
+	}
+
+	return 0, false
+}
+
 // Given needle CodecParameters, returns if needle is RTX and
 // if primary codec corresponding to that needle is in the haystack of codecs.
 func primaryPayloadTypeForRTXExists(needle RTPCodecParameters, haystack []RTPCodecParameters) (
@@ -225,3 +304,56 @@ func rtcpFeedbackIntersection(a, b []RTCPFeedback) (out []RTCPFeedback) {
 
 	return
 }
+
+func rtcpFeedbackUnion(a, b []RTCPFeedback) []RTCPFeedback {
+	out := append([]RTCPFeedback{}, a...)
+	for _, bFeedback := range b {
+		found := false
+		for _, aFeedback := range out {
+			if strings.EqualFold(aFeedback.Type, bFeedback.Type) &&
+				strings.EqualFold(aFeedback.Parameter, bFeedback.Parameter) {
+				found = true
+
+				break
+			}
+		}
+
+		if !found {
+			out = append(out, bFeedback)
+		}
+	}
+
+	return out
+}
+
+// setFmtpParameter sets key to value in a fmtp line. Other parameters are kept byte
+// for byte, only the parameter named key is rewritten. Comparing parameter names
+// instead of replacing "key=" substrings keeps e.g. x-apt intact when setting apt.
+func setFmtpParameter(line, key, value string) string {
+	params := []string{}
+	found := false
+	for param := range strings.SplitSeq(line, ";") {
+		trimmed := strings.TrimSpace(param)
+		if trimmed == "" {
+			continue
+		}
+
+		paramKey, _, _ := strings.Cut(trimmed, "=")
+		if strings.EqualFold(paramKey, key) {
+			if found {
+				continue
+			}
+
+			found = true
+			param = key + "=" + value
+		}
+
+		params = append(params, param)
+	}
+
+	if !found {
+		params = append(params, key+"="+value)
+	}
+
+	return strings.Join(params, ";")
+}
@@ -276,3 +276,66 @@ func TestFindFECPayloadType(t *testing.T) {
 		assert.Equal(t, test.ResultPayloadType, findFECPayloadType(test.Haystack))
 	}
 }
+
+func TestSetFmtpParameter(t *testing.T) {
+	for _, test := range []struct {
+		Name     string
+		Line     string
+		Key      string
+		Value    string
+		Expected string
+	}{
+		{"empty line", "", "useinbandfec", "0", "useinbandfec=0"},
+		{"append", "minptime=10", "useinbandfec", "0", "minptime=10;useinbandfec=0"},
+		{"replace", "minptime=10; useinbandfec=1", "useinbandfec", "0", "minptime=10;useinbandfec=0"},
+		{"case insensitive key", "minptime=10;UseInbandFec=1", "useinbandfec", "0", "minptime=10;useinbandfec=0"},
+		{"other parameters kept", "apt=6; rtx-time=60", "apt", "96", "apt=96; rtx-time=60"},
+		{"parameter name suffix", "x-apt=6;apt=6;rtx-time=60", "apt", "96", "x-apt=6;apt=96;rtx-time=60"},
+	} {
+		t.Run(test.Name, func(t *testing.T) {
+			assert.Equal(t, test.Expected, setFmtpParameter(test.Line, test.Key, test.Value))
+		})
+	}
+}
+
+func TestRTPCodecParametersEqualIgnoringFeedback(t *testing.T) {
+	codec := RTPCodecParameters{
+		RTPCodecCapability: RTPCodecCapability{
+			MimeTypeVP8, 90000, 0, "max-fr=30", []RTCPFeedback{{Type: TypeRTCPFBNACK}},
+		},
+		PayloadType: 96,
+	}
+
+	other := codec
+	other.MimeType = "video/vp8"
+	other.RTCPFeedback = []RTCPFeedback{{Type: TypeRTCPFBTransportCC}, {Type: TypeRTCPFBGoogREMB}}
+	other.PayloadType = 97
+	other.statsID = "RTPCodec-1"
+	assert.True(t, codec.EqualIgnoringFeedback(other))
+	assert.True(t, other.EqualIgnoringFeedback(codec))
+
+	for _, modify := range []func(*RTPCodecParameters){
+		func(c *RTPCodecParameters) { c.MimeType = MimeTypeVP9 },
+		func(c *RTPCodecParameters) { c.ClockRate = 48000 },
+		func(c *RTPCodecParameters) { c.Channels = 2 },
+		func(c *RTPCodecParameters) { c.SDPFmtpLine = "max-fr=60" },
+	} {
+		different := other
+		modify(&different)
+		assert.False(t, codec.EqualIgnoringFeedback(different))
+	}
+}
+
+func TestFmtpEqual(t *testing.T) {
+	assert.True(t, FmtpEqual(MimeTypeH264, 90000, 0,
+		"level-asymmetry-allowed=1;packetization-mode=1;profile-level-id=42e01f",
+		"profile-level-id=42e01f;packetization-mode=1;level-asymmetry-allowed=1",
+	))
+	assert.False(t, FmtpEqual(MimeTypeH264, 90000, 0,
+		"packetization-mode=1;profile-level-id=42e01f",
+		"packetization-mode=0;profile-level-id=42e01f",
+	))
+
+	assert.True(t, FmtpEqual(MimeTypeOpus, 48000, 2, "minptime=10;useinbandfec=1", "useinbandfec=1; minptime=10"))
+	assert.False(t, FmtpEqual(MimeTypeOpus, 48000, 2, "minptime=10;useinbandfec=1", "minptime=10;useinbandfec=0"))
+}
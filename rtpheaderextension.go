@@ -0,0 +1,262 @@
+// SPDX-FileCopyrightText: 2026 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package webrtc
+
+import (
+	"encoding/binary"
+
+	"github.com/pion/rtp"
+)
+
+const (
+	// GenericFrameDescriptorURI is the URI of the generic frame descriptor RTP header extension.
+	// It carries codec agnostic frame dependency information for forwarding. For AV1 it has been
+	// superseded by the dependency descriptor, both can be registered at the same time.
+	GenericFrameDescriptorURI = "http://www.webrtc.org/experiments/rtp-hdrext/generic-frame-descriptor-00"
+
+	// DependencyDescriptorURI is the URI of the AV1 dependency descriptor RTP header extension.
+	DependencyDescriptorURI = "https://aomediacodec.github.io/av1-rtp-spec/#dependency-descriptor-rtp-header-extension"
+
+	// TransmissionOffsetURI is the URI of the transmission time offset RTP header extension, see RFC 5450.
+	TransmissionOffsetURI = "urn:ietf:params:rtp-hdrext:toffset"
+
+	// VideoContentTypeURI is the URI of the video content type RTP header extension.
+	// It tells screen shares apart from camera video.
+	VideoContentTypeURI = "http://www.webrtc.org/experiments/rtp-hdrext/video-content-type"
+
+	// VideoTimingURI is the URI of the video timing RTP header extension. It carries
+	// timestamps of the steps a frame went through on the sender.
+	VideoTimingURI = "http://www.webrtc.org/experiments/rtp-hdrext/video-timing"
+
+	// AbsCaptureTimeURI is the URI of the absolute capture time RTP header extension,
+	// its payload is rtp.AbsCaptureTimeExtension. The payload is 8 bytes with only the
+	// capture timestamp, or 16 bytes if the estimated capture clock offset is set.
+	AbsCaptureTimeURI = "http://www.webrtc.org/experiments/rtp-hdrext/abs-capture-time"
+
+	// CSRCAudioLevelURI is the URI of the mixer-to-client audio level RTP header extension,
+	// see RFC 6465. It carries the level of each contributing source of mixed audio.
+	CSRCAudioLevelURI = "urn:ietf:params:rtp-hdrext:csrc-audio-level"
+
+	// VideoLayersAllocationURI is the URI of the video layers allocation RTP header extension,
+	// its payload is VideoLayersAllocationExtension. It tells forwarders the target bitrate
+	// and resolution of each simulcast or SVC layer the sender is producing.
+	VideoLayersAllocationURI = "http://www.webrtc.org/experiments/rtp-hdrext/video-layers-allocation00"
+)
+
+// VideoContentType is the content type carried by the video content type RTP header extension.
+type VideoContentType uint8
+
+const (
+	// VideoContentTypeUnspecified is used for camera and other regular video.
+	VideoContentTypeUnspecified VideoContentType = 0
+	// VideoContentTypeScreenshare is used for screen shares.
+	VideoContentTypeScreenshare VideoContentType = 1
+)
+
+const videoContentTypeExtensionSize = 1
+
+// VideoTimingFlags tell why the timing of a frame was reported in the video timing RTP header extension.
+type VideoTimingFlags uint8
+
+const (
+	// VideoTimingFlagNotTriggered is used for frames whose timing wasn't requested.
+	VideoTimingFlagNotTriggered VideoTimingFlags = 0
+	// VideoTimingFlagTriggeredByTimer is used for frames reported periodically.
+	VideoTimingFlagTriggeredByTimer VideoTimingFlags = 1 << 0
+	// VideoTimingFlagTriggeredBySize is used for frames reported for being unusually large.
+	VideoTimingFlagTriggeredBySize VideoTimingFlags = 1 << 1
+	// VideoTimingFlagInvalid is used when the timestamps are invalid.
+	VideoTimingFlagInvalid VideoTimingFlags = 0xff
+)
+
+const videoTimingExtensionSize = 13
+
+const (
+	transmissionOffsetExtensionSize = 3
+
+	// Range of the signed 24-bit transmission time offset.
+	minTransmissionOffset = -(1 << 23)
+	maxTransmissionOffset = 1<<23 - 1
+)
+
+// TransmissionOffsetExtension is the payload of the transmission time offset
+// RTP header extension. Offset is the difference between the transmission time
+// of the packet and its RTP timestamp, in RTP timestamp units.
+type TransmissionOffsetExtension struct {
+	Offset int32
+}
+
+// Marshal serializes the members to buffer.
+func (t TransmissionOffsetExtension) Marshal() ([]byte, error) {
+	if t.Offset < minTransmissionOffset || t.Offset > maxTransmissionOffset {
+		return nil, errTransmissionOffsetOutOfRange
+	}
+
+	return []byte{byte(t.Offset >> 16), byte(t.Offset >> 8), byte(t.Offset)}, nil
+}
+
+// Unmarshal parses the passed byte slice and stores the result in the members.
+func (t *TransmissionOffsetExtension) Unmarshal(rawData []byte) error {
+	if len(rawData) < transmissionOffsetExtensionSize {
+		return errTransmissionOffsetTooShort
+	}
+
+	// Shift into the top of an int32 and back down to sign extend the 24-bit value
+	t.Offset = int32(uint32(rawData[0])<<24|uint32(rawData[1])<<16|uint32(rawData[2])<<8) >> 8 //nolint:gosec // G115
+
+	return nil
+}
+
+const (
+	// A RTP packet has at most 15 CSRCs.
+	maxCSRCAudioLevels = 15
+	maxCSRCAudioLevel  = 127
+)
+
+// CSRCAudioLevelExtension is the payload of the CSRC audio level RTP header extension.
+// Levels has one entry per CSRC of the packet, in the order of the CSRC list. A level
+// is the audio level of the contributing source in -dBov, from 0 (loudest) to 127.
+type CSRCAudioLevelExtension struct {
+	Levels []uint8
+}
+
+// Marshal serializes the members to buffer.
+func (c CSRCAudioLevelExtension) Marshal() ([]byte, error) {
+	if len(c.Levels) == 0 {
+		return nil, errCSRCAudioLevelTooShort
+	}
+	if len(c.Levels) > maxCSRCAudioLevels {
+		return nil, errCSRCAudioLevelTooMany
+	}
+
+	buf := make([]byte, len(c.Levels))
+	for i, level := range c.Levels {
+		if level > maxCSRCAudioLevel {
+			return nil, errCSRCAudioLevelOutOfRange
+		}
+		buf[i] = level
+	}
+
+	return buf, nil
+}
+
+// Unmarshal parses the passed byte slice and stores the result in the members.
+func (c *CSRCAudioLevelExtension) Unmarshal(rawData []byte) error {
+	if len(rawData) == 0 {
+		return errCSRCAudioLevelTooShort
+	}
+	if len(rawData) > maxCSRCAudioLevels {
+		return errCSRCAudioLevelTooMany
+	}
+
+	c.Levels = make([]uint8, len(rawData))
+	for i, b := range rawData {
+		// The top bit is reserved
+		c.Levels[i] = b & maxCSRCAudioLevel
+	}
+
+	return nil
+}
+
+// LevelsByCSRC pairs the levels with the CSRCs of the packet they were received in.
+// CSRCs without a level, or levels without a CSRC, are left out.
+func (c CSRCAudioLevelExtension) LevelsByCSRC(csrc []uint32) map[uint32]uint8 {
+	levels := make(map[uint32]uint8, min(len(csrc), len(c.Levels)))
+	for i := 0; i < len(csrc) && i < len(c.Levels); i++ {
+		levels[csrc[i]] = c.Levels[i]
+	}
+
+	return levels
+}
+
+// VideoLayersAllocationExtension is the payload of the video layers allocation RTP header
+// extension. The layers are the active spatial layers of all RTP streams, their target
+// bitrates are in kbps per temporal layer. Width, Height and Framerate are only set if
+// HasResolutionAndFramerate is true. An empty payload means no layers are active.
+type VideoLayersAllocationExtension struct {
+	rtp.VLA
+}
+
+// Unmarshal parses the passed byte slice and stores the result in the members.
+func (v *VideoLayersAllocationExtension) Unmarshal(rawData []byte) error {
+	v.VLA = rtp.VLA{}
+	if len(rawData) == 0 {
+		return nil
+	}
+	_, err := v.VLA.Unmarshal(rawData)
+
+	return err
+}
+
+// VideoContentTypeExtension is the payload of the video content type RTP header extension.
+type VideoContentTypeExtension struct {
+	ContentType VideoContentType
+}
+
+// Marshal serializes the members to buffer.
+func (v VideoContentTypeExtension) Marshal() ([]byte, error) {
+	return []byte{byte(v.ContentType)}, nil
+}
+
+// Unmarshal parses the passed byte slice and stores the result in the members.
+func (v *VideoContentTypeExtension) Unmarshal(rawData []byte) error {
+	if len(rawData) < videoContentTypeExtensionSize {
+		return errVideoContentTypeTooShort
+	}
+	v.ContentType = VideoContentType(rawData[0])
+
+	return nil
+}
+
+// VideoTimingExtension is the payload of the video timing RTP header extension.
+// The deltas are in milliseconds since the capture time of the frame. The network
+// timestamps are free for use by middleboxes along the path.
+type VideoTimingExtension struct {
+	Flags                      VideoTimingFlags
+	EncodeStartDeltaMs         uint16
+	EncodeFinishDeltaMs        uint16
+	PacketizationFinishDeltaMs uint16
+	PacerExitDeltaMs           uint16
+	NetworkTimestampDeltaMs    uint16
+	Network2TimestampDeltaMs   uint16
+}
+
+// Marshal serializes the members to buffer.
+func (v VideoTimingExtension) Marshal() ([]byte, error) {
+	buf := make([]byte, videoTimingExtensionSize)
+	buf[0] = byte(v.Flags)
+	for i, delta := range []uint16{
+		v.EncodeStartDeltaMs,
+		v.EncodeFinishDeltaMs,
+		v.PacketizationFinishDeltaMs,
+		v.PacerExitDeltaMs,
+		v.NetworkTimestampDeltaMs,
+		v.Network2TimestampDeltaMs,
+	} {
+		binary.BigEndian.PutUint16(buf[1+2*i:], delta)
+	}
+
+	return buf, nil
+}
+
+// Unmarshal parses the passed byte slice and stores the result in the members.
+func (v *VideoTimingExtension) Unmarshal(rawData []byte) error {
+	if len(rawData) < videoTimingExtensionSize {
+		return errVideoTimingTooShort
+	}
+
+	v.Flags = VideoTimingFlags(rawData[0])
+	for i, delta := range []*uint16{
+		&v.EncodeStartDeltaMs,
+		&v.EncodeFinishDeltaMs,
+		&v.PacketizationFinishDeltaMs,
+		&v.PacerExitDeltaMs,
+		&v.NetworkTimestampDeltaMs,
+		&v.Network2TimestampDeltaMs,
+	} {
+		*delta = binary.BigEndian.Uint16(rawData[1+2*i:])
+	}
+
+	return nil
+}
@@ -0,0 +1,84 @@
+// SPDX-FileCopyrightText: 2026 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package webrtc
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTransmissionOffsetExtension(t *testing.T) {
+	for _, test := range []struct {
+		offset  int32
+		payload []byte
+	}{
+		{0, []byte{0x00, 0x00, 0x00}},
+		{1, []byte{0x00, 0x00, 0x01}},
+		{-1, []byte{0xff, 0xff, 0xff}},
+		{90000, []byte{0x01, 0x5f, 0x90}},
+		{-90000, []byte{0xfe, 0xa0, 0x70}},
+		{maxTransmissionOffset, []byte{0x7f, 0xff, 0xff}},
+		{minTransmissionOffset, []byte{0x80, 0x00, 0x00}},
+	} {
+		payload, err := TransmissionOffsetExtension{Offset: test.offset}.Marshal()
+		assert.NoError(t, err)
+		assert.Equal(t, test.payload, payload)
+
+		var extension TransmissionOffsetExtension
+		assert.NoError(t, extension.Unmarshal(payload))
+		assert.Equal(t, test.offset, extension.Offset)
+	}
+
+	_, err := TransmissionOffsetExtension{Offset: maxTransmissionOffset + 1}.Marshal()
+	assert.ErrorIs(t, err, errTransmissionOffsetOutOfRange)
+	_, err = TransmissionOffsetExtension{Offset: minTransmissionOffset - 1}.Marshal()
+	assert.ErrorIs(t, err, errTransmissionOffsetOutOfRange)
+
+	var extension TransmissionOffsetExtension
+	assert.ErrorIs(t, extension.Unmarshal([]byte{0x00, 0x01}), errTransmissionOffsetTooShort)
+}
+
+func TestVideoContentTypeExtension(t *testing.T) {
+	for _, contentType := range []VideoContentType{VideoContentTypeUnspecified, VideoContentTypeScreenshare} {
+		payload, err := VideoContentTypeExtension{ContentType: contentType}.Marshal()
+		assert.NoError(t, err)
+		assert.Equal(t, []byte{byte(contentType)}, payload)
+
+		var extension VideoContentTypeExtension
+		assert.NoError(t, extension.Unmarshal(payload))
+		assert.Equal(t, contentType, extension.ContentType)
+	}
+
+	var extension VideoContentTypeExtension
+	assert.ErrorIs(t, extension.Unmarshal([]byte{}), errVideoContentTypeTooShort)
+}
+
+func TestVideoTimingExtension(t *testing.T) {
+	extension := VideoTimingExtension{
+		Flags:                      VideoTimingFlagTriggeredByTimer | VideoTimingFlagTriggeredBySize,
+		EncodeStartDeltaMs:         0x0102,
+		EncodeFinishDeltaMs:        0x0304,
+		PacketizationFinishDeltaMs: 0x0506,
+		PacerExitDeltaMs:           0x0708,
+		NetworkTimestampDeltaMs:    0x090a,
+		Network2TimestampDeltaMs:   0xfffe,
+	}
+	payload, err := extension.Marshal()
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0x03, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0a, 0xff, 0xfe}, payload)
+
+	var decoded VideoTimingExtension
+	assert.NoError(t, decoded.Unmarshal(payload))
+	assert.Equal(t, extension, decoded)
+
+	for _, flags := range []VideoTimingFlags{VideoTimingFlagNotTriggered, VideoTimingFlagInvalid} {
+		payload, err = VideoTimingExtension{Flags: flags}.Marshal()
+		assert.NoError(t, err)
+		assert.NoError(t, decoded.Unmarshal(payload))
+		assert.Equal(t, flags, decoded.Flags)
+	}
+
+	assert.ErrorIs(t, decoded.Unmarshal(payload[:12]), errVideoTimingTooShort)
+}
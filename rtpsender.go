@@ -64,6 +64,10 @@ func (api *API) NewRTPSender(track TrackLocal, transport *DTLSTransport) (*RTPSe
 		return nil, errRTPSenderDTLSTransportNil
 	}
 
+	if err := api.mediaEngine.validateRID(track.RID()); err != nil {
+		return nil, err
+	}
+
 	id, err := randutil.GenerateCryptoRandomString(32, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ")
 	if err != nil {
 		return nil, err
@@ -162,6 +166,10 @@ func (r *RTPSender) AddEncoding(track TrackLocal) error { //nolint:cyclop
 		return errRTPSenderRidNil
 	}
 
+	if err := r.api.mediaEngine.validateRID(track.RID()); err != nil {
+		return err
+	}
+
 	if r.hasStopped() {
 		return errRTPSenderStopped
 	}
@@ -277,6 +285,7 @@ func (r *RTPSender) ReplaceTrack(track TrackLocal) error { //nolint:cyclop
 		ssrcFEC:         context.SSRCForwardErrorCorrection(),
 		writeStream:     context.WriteStream(),
 		rtcpInterceptor: context.RTCPReader(),
+		payloader:       r.api.mediaEngine.newPayloader,
 	})
 	if err != nil {
 		// Re-bind the original track
@@ -339,6 +348,7 @@ func (r *RTPSender) Send(parameters RTPSendParameters) error {
 			ssrcRTX:         parameters.Encodings[idx].RTX.SSRC,
 			writeStream:     writeStream,
 			rtcpInterceptor: trackEncoding.rtcpInterceptor,
+			payloader:       r.api.mediaEngine.newPayloader,
 		}
 
 		codec, err := trackEncoding.track.Bind(trackEncoding.context)
@@ -421,6 +421,34 @@ func Test_RTPSender_Add_Encoding(t *testing.T) {
 	assert.NoError(t, peerConnection.Close())
 }
 
+func Test_RTPSender_MaxRIDLength(t *testing.T) {
+	mediaEngine := &MediaEngine{}
+	assert.NoError(t, mediaEngine.RegisterDefaultCodecs())
+	mediaEngine.SetMaxRIDLength(8)
+
+	peerConnection, err := NewAPI(WithMediaEngine(mediaEngine)).NewPeerConnection(Configuration{})
+	assert.NoError(t, err)
+
+	newTrack := func(rid string) TrackLocal {
+		track, err := NewTrackLocalStaticSample(
+			RTPCodecCapability{MimeType: MimeTypeVP8}, "video", "pion", WithRTPStreamID(rid),
+		)
+		assert.NoError(t, err)
+
+		return track
+	}
+
+	_, err = peerConnection.AddTrack(newTrack("0123456789abcdef"))
+	assert.ErrorIs(t, err, ErrRIDTooLong)
+
+	rtpSender, err := peerConnection.AddTrack(newTrack("q"))
+	assert.NoError(t, err)
+	assert.ErrorIs(t, rtpSender.AddEncoding(newTrack("0123456789abcdef")), ErrRIDTooLong)
+	assert.NoError(t, rtpSender.AddEncoding(newTrack("01234567")))
+
+	assert.NoError(t, peerConnection.Close())
+}
+
 // nolint: dupl
 func Test_RTPSender_FEC_Support(t *testing.T) {
 	t.Run("FEC disabled by default", func(t *testing.T) {
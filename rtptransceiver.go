@@ -58,7 +58,7 @@ func (t *RTPTransceiver) SetCodecPreferences(codecs []RTPCodecParameters) error
 	for _, codec := range codecs {
 		if _, matchType := codecParametersFuzzySearch(
 			codec, t.api.mediaEngine.getCodecsByKind(t.kind),
-		); matchType == codecMatchNone {
+		); matchType == CodecMatchNone {
 			return fmt.Errorf("%w %s", errRTPTransceiverCodecUnsupported, codec.MimeType)
 		}
 	}
@@ -75,12 +75,12 @@ func (t *RTPTransceiver) getCodecs() []RTPCodecParameters {
 
 	mediaEngineCodecs := t.api.mediaEngine.getCodecsByKind(t.kind)
 	if len(t.codecs) == 0 {
-		return filterUnattachedRTX(mediaEngineCodecs)
+		return t.api.mediaEngine.filterRestrictedFEC(filterUnattachedRTX(mediaEngineCodecs))
 	}
 
 	filteredCodecs := []RTPCodecParameters{}
 	for _, codec := range t.codecs {
-		if c, matchType := codecParametersFuzzySearch(codec, mediaEngineCodecs); matchType != codecMatchNone {
+		if c, matchType := codecParametersFuzzySearch(codec, mediaEngineCodecs); matchType != CodecMatchNone {
 			if codec.PayloadType == 0 {
 				codec.PayloadType = c.PayloadType
 			}
@@ -89,7 +89,7 @@ func (t *RTPTransceiver) getCodecs() []RTPCodecParameters {
 		}
 	}
 
-	return filterUnattachedRTX(filteredCodecs)
+	return t.api.mediaEngine.filterRestrictedFEC(filterUnattachedRTX(filteredCodecs))
 }
 
 // match codecs from remote description, used when remote is offerer and creating a transceiver
@@ -107,7 +107,7 @@ func (t *RTPTransceiver) setCodecPreferencesFromRemoteDescription(media *sdp.Med
 	// the transceivers codecs and use payload type registered to
 	// media engine.
 	payloadMapping := make(map[PayloadType]PayloadType) // for RTX re-mapping later
-	filterByMatchType := func(matchFilter codecMatchType) []RTPCodecParameters {
+	filterByMatchType := func(matchFilter CodecMatchType) []RTPCodecParameters {
 		filteredCodecs := []RTPCodecParameters{}
 		for remoteCodecIdx := len(remoteCodecs) - 1; remoteCodecIdx >= 0; remoteCodecIdx-- {
 			remoteCodec := remoteCodecs[remoteCodecIdx]
@@ -156,8 +156,8 @@ func (t *RTPTransceiver) setCodecPreferencesFromRemoteDescription(media *sdp.Med
 		return filteredCodecs
 	}
 
-	filteredCodecs := filterByMatchType(codecMatchExact)
-	filteredCodecs = append(filteredCodecs, filterByMatchType(codecMatchPartial)...)
+	filteredCodecs := filterByMatchType(CodecMatchExact)
+	filteredCodecs = append(filteredCodecs, filterByMatchType(CodecMatchPartial)...)
 
 	// find RTX associations and add those
 	for remotePayloadType, mediaEnginePayloadType := range payloadMapping {
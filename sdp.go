@@ -18,6 +18,7 @@ import (
 
 	"github.com/pion/ice/v4"
 	"github.com/pion/logging"
+	"github.com/pion/rtp"
 	"github.com/pion/sdp/v3"
 )
 
@@ -1106,7 +1107,7 @@ func codecsFromMediaDescription(mediaDescr *sdp.MediaDescription) (out []RTPCode
 	for _, payloadStr := range mediaDescr.MediaName.Formats {
 		payloadType, err := strconv.ParseUint(payloadStr, 10, 8)
 		if err != nil {
-			return nil, err
+			return nil, fmt.Errorf("invalid payload type %q: %w", payloadStr, err)
 		}
 
 		codec, err := s.GetCodecForPayloadType(uint8(payloadType))
@@ -1115,7 +1116,16 @@ func codecsFromMediaDescription(mediaDescr *sdp.MediaDescription) (out []RTPCode
 				continue
 			}
 
-			return nil, err
+			if attrs := codecAttributesForPayloadType(mediaDescr, payloadStr); len(attrs) > 0 {
+				return nil, fmt.Errorf("payload type %d (%s): %w", payloadType, strings.Join(attrs, ", "), err)
+			}
+
+			return nil, fmt.Errorf("payload type %d: %w", payloadType, err)
+		}
+
+		// Some endpoints leave out the clock rate of static payload types
+		if codec.ClockRate == 0 {
+			codec.ClockRate = staticPayloadTypeClockRate(uint8(payloadType))
 		}
 
 		channels := uint16(0)
@@ -1150,6 +1160,41 @@ func codecsFromMediaDescription(mediaDescr *sdp.MediaDescription) (out []RTPCode
 	return out, nil
 }
 
+// staticPayloadTypeClockRate returns the clock rate of a static payload type as
+// assigned by RFC 3551 section 6, 0 for dynamic and unassigned payload types.
+func staticPayloadTypeClockRate(payloadType uint8) uint32 {
+	switch payloadType {
+	case rtp.PayloadTypePCMU, rtp.PayloadTypeGSM, rtp.PayloadTypeG723, rtp.PayloadTypeDVI4_8000,
+		rtp.PayloadTypeLPC, rtp.PayloadTypePCMA, rtp.PayloadTypeG722, rtp.PayloadTypeQCELP,
+		rtp.PayloadTypeCN, rtp.PayloadTypeG728, rtp.PayloadTypeG729:
+		return 8000
+	case rtp.PayloadTypeDVI4_16000:
+		return 16000
+	case rtp.PayloadTypeL16Stereo, rtp.PayloadTypeL16Mono:
+		return 44100
+	case rtp.PayloadTypeDVI4_11025:
+		return 11025
+	case rtp.PayloadTypeDVI4_22050:
+		return 22050
+	case rtp.PayloadTypeMPA, rtp.PayloadTypeCELLB, rtp.PayloadTypeJPEG, rtp.PayloadTypeNV,
+		rtp.PayloadTypeH261, rtp.PayloadTypeMPV, rtp.PayloadTypeMP2T, rtp.PayloadTypeH263:
+		return 90000
+	default:
+		return 0
+	}
+}
+
+// codecAttributesForPayloadType returns the rtpmap and fmtp attributes of a payload type.
+func codecAttributesForPayloadType(mediaDescr *sdp.MediaDescription, payloadStr string) (out []string) {
+	for _, a := range mediaDescr.Attributes {
+		if (a.Key == "rtpmap" || a.Key == "fmtp") && strings.HasPrefix(a.Value, payloadStr+" ") {
+			out = append(out, a.String())
+		}
+	}
+
+	return out
+}
+
 func rtpExtensionsFromMediaDescription(m *sdp.MediaDescription) (map[string]int, error) {
 	out := map[string]int{}
 
@@ -1160,7 +1205,10 @@ func rtpExtensionsFromMediaDescription(m *sdp.MediaDescription) (map[string]int,
 				return nil, err
 			}
 
-			out[e.URI.String()] = e.Value
+			// Prefer the lowest ID if a URI is declared multiple times
+			if id, ok := out[e.URI.String()]; !ok || e.Value < id {
+				out[e.URI.String()] = e.Value
+			}
 		}
 	}
 
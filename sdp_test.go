@@ -905,8 +905,8 @@ func TestPopulateSDP(t *testing.T) { //nolint:gocyclo,cyclop,maintidx
 		me := &MediaEngine{}
 		assert.NoError(t, me.RegisterDefaultCodecs())
 		api := NewAPI(WithMediaEngine(me))
-		assert.NoError(t, me.pushCodecs(me.videoCodecs, RTPCodecTypeVideo))
-		assert.NoError(t, me.pushCodecs(me.audioCodecs, RTPCodecTypeAudio))
+		assert.NoError(t, me.pushCodecs(me.videoCodecs, RTPCodecTypeVideo, CodecMatchExact))
+		assert.NoError(t, me.pushCodecs(me.audioCodecs, RTPCodecTypeAudio, CodecMatchExact))
 
 		tr := &RTPTransceiver{kind: RTPCodecTypeVideo, api: api, codecs: me.videoCodecs}
 		tr.setDirection(RTPTransceiverDirectionRecvonly)
@@ -1650,3 +1650,21 @@ func TestSctpInit(t *testing.T) {
 		assert.ErrorAs(t, err, &corruptInputError)
 	})
 }
+
+func TestRtpExtensionsFromMediaDescriptionDuplicateURI(t *testing.T) {
+	extensions, err := rtpExtensionsFromMediaDescription(&sdp.MediaDescription{
+		MediaName: sdp.MediaName{
+			Media:   "video",
+			Formats: []string{"96"},
+		},
+		Attributes: []sdp.Attribute{
+			{Key: "extmap", Value: "6 " + sdp.SDESMidURI},
+			{Key: "extmap", Value: "2 " + sdp.SDESMidURI},
+			{Key: "extmap", Value: "9 " + sdp.SDESMidURI},
+		},
+	})
+
+	assert.NoError(t, err)
+	assert.Len(t, extensions, 1)
+	assert.Equal(t, 2, extensions[sdp.SDESMidURI])
+}
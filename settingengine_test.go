@@ -500,7 +500,7 @@ func TestSetFireOnTrackBeforeFirstRTP(t *testing.T) {
 			SDPFmtpLine:  "",
 			RTCPFeedback: nil,
 		},
-		PayloadType: 200,
+		PayloadType: 120,
 	}, RTPCodecTypeVideo))
 
 	offerer, err := NewAPI(WithMediaEngine(mediaEngineOne), WithSettingEngine(settingEngine)).NewPeerConnection(
@@ -285,6 +285,14 @@ type CodecStats struct {
 	// Implementation identifies the implementation used. This is useful for diagnosing
 	// interoperability issues.
 	Implementation string `json:"implementation"`
+
+	// Name is the name the codec was registered with using MediaEngine.RegisterNamedCodec.
+	// It defaults to the MIME type followed by the fmtp line.
+	Name string `json:"name,omitempty"`
+
+	// AssociatedPayloadType is the payload type of the codec a RTX codec repairs,
+	// taken from the apt fmtp parameter. It is nil for all other codecs.
+	AssociatedPayloadType *PayloadType `json:"associatedPayloadType,omitempty"`
 }
 
 func (s CodecStats) statsMarker() {}
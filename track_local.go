@@ -54,6 +54,9 @@ type baseTrackLocalContext struct {
 	ssrc, ssrcRTX, ssrcFEC SSRC
 	writeStream            TrackLocalWriter
 	rtcpInterceptor        interceptor.RTCPReader
+
+	// Payloader of the MediaEngine, for tracks that don't bring their own.
+	payloader func(RTPCodecCapability) (rtp.Payloader, error)
 }
 
 // CodecParameters returns the negotiated RTPCodecParameters. These are the codecs supported by both
@@ -6,8 +6,10 @@
 package webrtc
 
 import (
+	"slices"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/pion/rtp"
 	"github.com/pion/webrtc/v4/internal/util"
@@ -22,6 +24,48 @@ type trackBinding struct {
 	ssrc, ssrcRTX, ssrcFEC      SSRC
 	payloadType, payloadTypeRTX PayloadType
 	writeStream                 TrackLocalWriter
+
+	// IDs of negotiated header extensions added by the track, 0 if not negotiated.
+	transmissionOffsetID, videoContentTypeID uint8
+}
+
+// setHeaderExtensions adds the header extensions with a payload that the binding negotiated to header.
+// Header extensions the header already carries are kept, the header is switched to the two-byte
+// profile when an ID does not fit the one-byte one. header.Extensions may be shared with the
+// packet of the caller, it is cloned before it is modified.
+func (b *trackBinding) setHeaderExtensions(header *rtp.Header, transmissionOffset, videoContentType []byte) error {
+	cloned := false
+	for _, extension := range []struct {
+		id      uint8
+		payload []byte
+	}{
+		{b.transmissionOffsetID, transmissionOffset},
+		{b.videoContentTypeID, videoContentType},
+	} {
+		if extension.payload == nil || extension.id == 0 || header.GetExtension(extension.id) != nil {
+			continue
+		}
+
+		if !cloned {
+			header.Extensions, cloned = slices.Clone(header.Extensions), true
+		}
+		var err error
+		switch {
+		case extension.id <= maxHeaderExtensionID:
+			err = header.SetExtension(extension.id, extension.payload)
+		case !header.Extension:
+			// IDs above 14 only fit the two-byte profile, SetExtension would pick the one-byte one.
+			header.Extension, header.ExtensionProfile = true, rtp.ExtensionProfileTwoByte
+			err = header.SetExtension(extension.id, extension.payload)
+		default:
+			err = header.SetExtensionWithProfile(extension.id, extension.payload, rtp.ExtensionProfileTwoByte)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
 
 // TrackLocalStaticRTP  is a TrackLocal that has a pre-set codec and accepts RTP Packets.
@@ -34,6 +78,9 @@ type TrackLocalStaticRTP struct {
 	id, rid, streamID string
 	initalTimestamp   *uint32
 	initialSeqNumber  *uint16
+
+	// Payload of the video content type header extension, nil until set.
+	videoContentType []byte
 }
 
 // NewTrackLocalStaticRTP returns a TrackLocalStaticRTP.
@@ -95,7 +142,7 @@ func (s *TrackLocalStaticRTP) Bind(trackContext TrackLocalContext) (RTPCodecPara
 	if codec, matchType := codecParametersFuzzySearch(
 		parameters,
 		trackContext.CodecParameters(),
-	); matchType != codecMatchNone {
+	); matchType != CodecMatchNone {
 		s.bindings = append(s.bindings, trackBinding{
 			ssrc:           trackContext.SSRC(),
 			ssrcRTX:        trackContext.SSRCRetransmission(),
@@ -104,6 +151,9 @@ func (s *TrackLocalStaticRTP) Bind(trackContext TrackLocalContext) (RTPCodecPara
 			payloadTypeRTX: findRTXPayloadType(codec.PayloadType, trackContext.CodecParameters()),
 			writeStream:    trackContext.WriteStream(),
 			id:             trackContext.ID(),
+
+			transmissionOffsetID: headerExtensionID(trackContext.HeaderExtensions(), TransmissionOffsetURI),
+			videoContentTypeID:   headerExtensionID(trackContext.HeaderExtensions(), VideoContentTypeURI),
 		})
 
 		return codec, nil
@@ -112,6 +162,16 @@ func (s *TrackLocalStaticRTP) Bind(trackContext TrackLocalContext) (RTPCodecPara
 	return RTPCodecParameters{}, ErrUnsupportedCodec
 }
 
+func headerExtensionID(headerExtensions []RTPHeaderExtensionParameter, uri string) uint8 {
+	for _, h := range headerExtensions {
+		if h.URI == uri {
+			return uint8(h.ID) //nolint:gosec // G115
+		}
+	}
+
+	return 0
+}
+
 // Unbind implements the teardown logic when the track is no longer needed. This happens
 // because a track has been stopped.
 func (s *TrackLocalStaticRTP) Unbind(t TrackLocalContext) error {
@@ -191,13 +251,36 @@ func (s *TrackLocalStaticRTP) WriteRTP(p *rtp.Packet) error {
 	return s.writeRTP(packet)
 }
 
+// SetVideoContentType sets the content type sent in the video content type header
+// extension, e.g. VideoContentTypeScreenshare for a screen share. The extension is
+// only added to packets once a content type has been set, and only for
+// PeerConnections that negotiated it.
+func (s *TrackLocalStaticRTP) SetVideoContentType(contentType VideoContentType) {
+	payload, _ := VideoContentTypeExtension{ContentType: contentType}.Marshal()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.videoContentType = payload
+}
+
 // writeRTP is like WriteRTP, except that it may modify the packet p.
 func (s *TrackLocalStaticRTP) writeRTP(packet *rtp.Packet) error {
+	return s.writeRTPWithTransmissionOffset(packet, nil)
+}
+
+// writeRTPWithTransmissionOffset is like writeRTP, if transmissionOffset is set
+// it is added to the packets of bindings that negotiated the transmission time
+// offset header extension.
+func (s *TrackLocalStaticRTP) writeRTPWithTransmissionOffset(packet *rtp.Packet, transmissionOffset []byte) error {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
 	writeErrs := []error{}
 
+	// Restored after every binding, so header extensions only reach the bindings that negotiated them
+	extension, extensionProfile, extensions := packet.Extension, packet.ExtensionProfile, packet.Extensions
+
 	for _, b := range s.bindings {
 		packet.Header.SSRC = uint32(b.ssrc)
 		packet.Header.PayloadType = uint8(b.payloadType)
@@ -206,9 +289,16 @@ func (s *TrackLocalStaticRTP) writeRTP(packet *rtp.Packet) error {
 		if packet.PaddingSize != 0 && packet.Header.PaddingSize == 0 {
 			packet.Header.PaddingSize = packet.PaddingSize
 		}
-		if _, err := b.writeStream.WriteRTP(&packet.Header, packet.Payload); err != nil {
+
+		err := b.setHeaderExtensions(&packet.Header, transmissionOffset, s.videoContentType)
+		if err == nil {
+			_, err = b.writeStream.WriteRTP(&packet.Header, packet.Payload)
+		}
+		if err != nil {
 			writeErrs = append(writeErrs, err)
 		}
+
+		packet.Extension, packet.ExtensionProfile, packet.Extensions = extension, extensionProfile, extensions
 	}
 
 	return util.FlattenErrs(writeErrs)
@@ -296,6 +386,9 @@ func (s *TrackLocalStaticSample) Bind(t TrackLocalContext) (RTPCodecParameters,
 	payloadHandler := s.rtpTrack.payloader
 	if payloadHandler == nil {
 		payloadHandler = payloaderForCodec
+		if context, ok := t.(*baseTrackLocalContext); ok && context.payloader != nil {
+			payloadHandler = context.payloader
+		}
 	}
 
 	payloader, err := payloadHandler(codec.RTPCodecCapability)
@@ -336,6 +429,12 @@ func (s *TrackLocalStaticSample) Unbind(t TrackLocalContext) error {
 	return s.rtpTrack.Unbind(t)
 }
 
+// SetVideoContentType sets the content type sent in the video content type header
+// extension, see TrackLocalStaticRTP.SetVideoContentType.
+func (s *TrackLocalStaticSample) SetVideoContentType(contentType VideoContentType) {
+	s.rtpTrack.SetVideoContentType(contentType)
+}
+
 // WriteSample writes a Sample to the TrackLocalStaticSample
 // If one PeerConnection fails the packets will still be sent to
 // all PeerConnections. The error message will contain the ID of the failed
@@ -375,11 +474,29 @@ func (s *TrackLocalStaticSample) WriteSample(sample media.Sample) error {
 	packets := packetizer.Packetize(sample.Data, curTicks)
 	s.mu.Unlock()
 
+	// Packets are sent right after packetization, so the transmission time offset
+	// is the time elapsed since the sample was captured. Without a capture time
+	// the offset is unknown and the header extension is left out.
+	var transmissionOffsetPayload []byte
+	if !sample.Timestamp.IsZero() {
+		offset := time.Since(sample.Timestamp).Seconds() * clockRate
+		var err error
+		transmissionOffsetPayload, err = TransmissionOffsetExtension{
+			Offset: int32(max(min(offset, maxTransmissionOffset), minTransmissionOffset)),
+		}.Marshal()
+		if err != nil {
+			return err
+		}
+	}
+
 	writeErrs := []error{}
 	for _, p := range packets {
-		if err := s.rtpTrack.WriteRTP(p); err != nil {
+		packet := getPacketAllocationFromPool()
+		*packet = *p
+		if err := s.rtpTrack.writeRTPWithTransmissionOffset(packet, transmissionOffsetPayload); err != nil {
 			writeErrs = append(writeErrs, err)
 		}
+		resetPacketPoolAllocation(packet)
 	}
 
 	return util.FlattenErrs(writeErrs)
@@ -150,7 +150,7 @@ func Test_TrackLocalStatic_PayloadType(t *testing.T) {
 			SDPFmtpLine:  "",
 			RTCPFeedback: nil,
 		},
-		PayloadType: 200,
+		PayloadType: 120,
 	}, RTPCodecTypeVideo))
 
 	offerer, err := NewAPI(WithMediaEngine(mediaEngineOne)).NewPeerConnection(Configuration{})
@@ -326,7 +326,7 @@ func Test_TrackLocalStatic_Padding(t *testing.T) {
 			SDPFmtpLine:  "",
 			RTCPFeedback: nil,
 		},
-		PayloadType: 200,
+		PayloadType: 120,
 	}, RTPCodecTypeVideo))
 
 	offerer, err := NewAPI(WithMediaEngine(mediaEngineOne)).NewPeerConnection(Configuration{})
@@ -1027,3 +1027,229 @@ func (p *countingPacketizer) EnableAbsSendTime(value int)                  {}
 func (p *countingPacketizer) SkipSamples(skippedSamples uint32) {
 	p.totalSamples += uint64(skippedSamples)
 }
+
+type headerRecordingWriter struct {
+	headers []rtp.Header
+}
+
+func (w *headerRecordingWriter) WriteRTP(header *rtp.Header, _ []byte) (int, error) {
+	w.headers = append(w.headers, header.Clone())
+
+	return 0, nil
+}
+
+func (w *headerRecordingWriter) Write(_ []byte) (int, error) { return 0, nil }
+
+type headerExtensionTrackLocalContext struct {
+	dummyTrackLocalContext
+	writer           *headerRecordingWriter
+	headerExtensions []RTPHeaderExtensionParameter
+}
+
+func (c headerExtensionTrackLocalContext) WriteStream() TrackLocalWriter { return c.writer }
+
+func (c headerExtensionTrackLocalContext) HeaderExtensions() []RTPHeaderExtensionParameter {
+	return c.headerExtensions
+}
+
+func TestTrackLocalStaticSample_WriteSample_TransmissionOffset(t *testing.T) {
+	track, err := NewTrackLocalStaticSample(
+		RTPCodecCapability{MimeType: MimeTypeVP8, ClockRate: 90000},
+		"video", "pion",
+	)
+	require.NoError(t, err)
+
+	writer := &headerRecordingWriter{}
+	_, err = track.Bind(headerExtensionTrackLocalContext{
+		dummyTrackLocalContext{id: "toffset"}, writer, []RTPHeaderExtensionParameter{{URI: TransmissionOffsetURI, ID: 5}},
+	})
+	require.NoError(t, err)
+
+	transmissionOffset := func(header rtp.Header) int32 {
+		var extension TransmissionOffsetExtension
+		assert.NoError(t, extension.Unmarshal(header.GetExtension(5)))
+
+		return extension.Offset
+	}
+
+	// Without a capture time the offset is unknown and left out
+	assert.NoError(t, track.WriteSample(media.Sample{Data: []byte{0x00}, Duration: time.Second / 30}))
+	require.Len(t, writer.headers, 1)
+	assert.Nil(t, writer.headers[0].GetExtension(5))
+
+	// Captured 100ms ago, 9000 ticks at 90kHz
+	assert.NoError(t, track.WriteSample(media.Sample{
+		Data:      []byte{0x00},
+		Duration:  time.Second / 30,
+		Timestamp: time.Now().Add(-100 * time.Millisecond),
+	}))
+	require.Len(t, writer.headers, 2)
+	assert.GreaterOrEqual(t, transmissionOffset(writer.headers[1]), int32(9000))
+
+	// RTP packets written by the application are forwarded untouched
+	plainWriter := &headerRecordingWriter{}
+	rtpTrack, err := NewTrackLocalStaticRTP(RTPCodecCapability{MimeType: MimeTypeVP8}, "video", "pion")
+	require.NoError(t, err)
+	_, err = rtpTrack.Bind(headerExtensionTrackLocalContext{
+		dummyTrackLocalContext{id: "plain"}, plainWriter, []RTPHeaderExtensionParameter{{URI: TransmissionOffsetURI, ID: 5}},
+	})
+	require.NoError(t, err)
+	assert.NoError(t, rtpTrack.WriteRTP(&rtp.Packet{Header: rtp.Header{Version: 2}, Payload: []byte{0x00}}))
+	require.Len(t, plainWriter.headers, 1)
+	assert.Nil(t, plainWriter.headers[0].GetExtension(5))
+}
+
+func TestTrackLocalStaticRTP_VideoContentType(t *testing.T) {
+	track, err := NewTrackLocalStaticRTP(RTPCodecCapability{MimeType: MimeTypeVP8}, "video", "pion")
+	require.NoError(t, err)
+
+	writer, unnegotiatedWriter := &headerRecordingWriter{}, &headerRecordingWriter{}
+	_, err = track.Bind(headerExtensionTrackLocalContext{
+		dummyTrackLocalContext{id: "negotiated"}, writer, []RTPHeaderExtensionParameter{{URI: VideoContentTypeURI, ID: 7}},
+	})
+	require.NoError(t, err)
+	_, err = track.Bind(headerExtensionTrackLocalContext{
+		dummyTrackLocalContext{id: "unnegotiated"}, unnegotiatedWriter, nil,
+	})
+	require.NoError(t, err)
+
+	packet := &rtp.Packet{Header: rtp.Header{Version: 2}, Payload: []byte{0x00}}
+
+	// Not sent until a content type is set
+	assert.NoError(t, track.WriteRTP(packet))
+	require.Len(t, writer.headers, 1)
+	assert.Nil(t, writer.headers[0].GetExtension(7))
+
+	track.SetVideoContentType(VideoContentTypeScreenshare)
+	assert.NoError(t, track.WriteRTP(packet))
+	require.Len(t, writer.headers, 2)
+	assert.Equal(t, []byte{byte(VideoContentTypeScreenshare)}, writer.headers[1].GetExtension(7))
+
+	require.Len(t, unnegotiatedWriter.headers, 2)
+	assert.False(t, unnegotiatedWriter.headers[1].Extension)
+
+	// The packet of the caller isn't modified
+	assert.False(t, packet.Header.Extension)
+}
+
+func TestTrackLocalStaticRTP_HeaderExtensionsOfCaller(t *testing.T) {
+	track, err := NewTrackLocalStaticRTP(RTPCodecCapability{MimeType: MimeTypeVP8}, "video", "pion")
+	require.NoError(t, err)
+	track.SetVideoContentType(VideoContentTypeScreenshare)
+
+	// The first binding negotiated the ID the application already uses
+	clashingWriter, writer := &headerRecordingWriter{}, &headerRecordingWriter{}
+	_, err = track.Bind(headerExtensionTrackLocalContext{
+		dummyTrackLocalContext{id: "clashing"}, clashingWriter, []RTPHeaderExtensionParameter{{URI: VideoContentTypeURI, ID: 7}},
+	})
+	require.NoError(t, err)
+	_, err = track.Bind(headerExtensionTrackLocalContext{
+		dummyTrackLocalContext{id: "other"}, writer, []RTPHeaderExtensionParameter{{URI: VideoContentTypeURI, ID: 8}},
+	})
+	require.NoError(t, err)
+
+	packet := &rtp.Packet{Header: rtp.Header{Version: 2}, Payload: []byte{0x00}}
+	require.NoError(t, packet.Header.SetExtension(3, []byte{0x03}))
+	require.NoError(t, packet.Header.SetExtension(7, []byte{0xaa}))
+	original := packet.Header.Clone()
+
+	for range 2 {
+		assert.NoError(t, track.WriteRTP(packet))
+	}
+	assert.Equal(t, original, packet.Header)
+
+	require.Len(t, clashingWriter.headers, 2)
+	for _, header := range clashingWriter.headers {
+		assert.Equal(t, original.Extensions, header.Extensions)
+	}
+
+	require.Len(t, writer.headers, 2)
+	for _, header := range writer.headers {
+		assert.Equal(t, []byte{0x03}, header.GetExtension(3))
+		assert.Equal(t, []byte{0xaa}, header.GetExtension(7))
+		assert.Equal(t, []byte{byte(VideoContentTypeScreenshare)}, header.GetExtension(8))
+	}
+}
+
+func TestTrackLocalStaticRTP_TwoByteHeaderExtensionID(t *testing.T) {
+	track, err := NewTrackLocalStaticRTP(RTPCodecCapability{MimeType: MimeTypeVP8}, "video", "pion")
+	require.NoError(t, err)
+	track.SetVideoContentType(VideoContentTypeScreenshare)
+
+	writer := &headerRecordingWriter{}
+	_, err = track.Bind(headerExtensionTrackLocalContext{
+		dummyTrackLocalContext{id: "two-byte"}, writer, []RTPHeaderExtensionParameter{{URI: VideoContentTypeURI, ID: 16}},
+	})
+	require.NoError(t, err)
+
+	withOneByte := &rtp.Packet{Header: rtp.Header{Version: 2}, Payload: []byte{0x00}}
+	require.NoError(t, withOneByte.Header.SetExtension(3, []byte{0x03}))
+
+	assert.NoError(t, track.WriteRTP(&rtp.Packet{Header: rtp.Header{Version: 2}, Payload: []byte{0x00}}))
+	assert.NoError(t, track.WriteRTP(withOneByte))
+	require.Len(t, writer.headers, 2)
+	for _, header := range writer.headers {
+		assert.Equal(t, uint16(rtp.ExtensionProfileTwoByte), header.ExtensionProfile)
+		assert.Equal(t, []byte{byte(VideoContentTypeScreenshare)}, header.GetExtension(16))
+
+		// The header is still valid on the wire
+		raw, err := header.Marshal()
+		require.NoError(t, err)
+		var parsed rtp.Header
+		_, err = parsed.Unmarshal(raw)
+		require.NoError(t, err)
+		assert.Equal(t, []byte{byte(VideoContentTypeScreenshare)}, parsed.GetExtension(16))
+	}
+	assert.Equal(t, []byte{0x03}, writer.headers[1].GetExtension(3))
+
+	// The packet of the caller keeps its profile
+	assert.Equal(t, uint16(rtp.ExtensionProfileOneByte), withOneByte.Header.ExtensionProfile)
+}
+
+type payloadRecordingWriter struct {
+	payloads [][]byte
+}
+
+func (w *payloadRecordingWriter) WriteRTP(_ *rtp.Header, payload []byte) (int, error) {
+	w.payloads = append(w.payloads, append([]byte{}, payload...))
+
+	return len(payload), nil
+}
+
+func (w *payloadRecordingWriter) Write(b []byte) (int, error) { return len(b), nil }
+
+func TestTrackLocalStaticSample_PayloaderOptions(t *testing.T) {
+	mediaEngine := &MediaEngine{}
+	require.NoError(t, mediaEngine.RegisterDefaultCodecs())
+
+	vp8 := RTPCodecParameters{
+		RTPCodecCapability: RTPCodecCapability{MimeType: MimeTypeVP8, ClockRate: 90000},
+		PayloadType:        DefaultPayloadTypeVP8,
+	}
+	// The payloader leaves out the picture ID 0 of the first frame
+	secondPayload := func() []byte {
+		track, err := NewTrackLocalStaticSample(vp8.RTPCodecCapability, "video", "pion")
+		require.NoError(t, err)
+
+		writer := &payloadRecordingWriter{}
+		_, err = track.Bind(&baseTrackLocalContext{
+			id:          "payloader",
+			params:      RTPParameters{Codecs: []RTPCodecParameters{vp8}},
+			ssrc:        1,
+			writeStream: writer,
+			payloader:   mediaEngine.newPayloader,
+		})
+		require.NoError(t, err)
+		for range 2 {
+			require.NoError(t, track.WriteSample(media.Sample{Data: []byte{0x00, 0x01}, Duration: time.Second / 30}))
+		}
+		require.Len(t, writer.payloads, 2)
+
+		return writer.payloads[1]
+	}
+
+	assert.Equal(t, []byte{0x90, 0x80, 0x01, 0x00, 0x01}, secondPayload())
+
+	mediaEngine.SetPayloaderOptions("VIDEO/VP8", PayloaderOptions{DisablePictureID: true})
+	assert.Equal(t, []byte{0x10, 0x00, 0x01}, secondPayload())
+}